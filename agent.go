@@ -1,13 +1,17 @@
 package pinpoint
 
 import (
+	"context"
+	"encoding/json"
 	"errors"
 	"strconv"
+	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
 
 	lru "github.com/hashicorp/golang-lru"
+	pb "github.com/pinpoint-apm/pinpoint-go-agent/protobuf"
 	"github.com/sirupsen/logrus"
 	prefixed "github.com/x-cray/logrus-prefixed-formatter"
 )
@@ -44,6 +48,9 @@ type agent struct {
 	metaChan   chan interface{}
 	wg         sync.WaitGroup
 	sampler    traceSampler
+	keySampler *keySampler
+	recent     *traceRing
+	custom     *customStats
 
 	exceptionIdCache *lru.Cache
 	exceptionIdGen   int32
@@ -60,7 +67,26 @@ type agent struct {
 	statStreamReq      bool
 	statStreamReqCount uint64
 
-	enable bool
+	pingStream *pingStream
+	pingMux    sync.Mutex
+
+	cmdWg sync.WaitGroup
+
+	streamRecorder streamRecorder
+
+	spanChanMux  sync.RWMutex //guards spanChan from being closed while a span is queued
+	metaChanMux  sync.RWMutex //guards metaChan from being closed while a metadata is queued
+	connMux      sync.Mutex
+	collectorMux sync.RWMutex //guards the config, the sampler and the grpc clients, which are swapped while the workers use them
+	connCtx      context.Context
+	connCancel   context.CancelFunc
+	shutdownOnce sync.Once
+	drain        drainResult
+	registered   chan struct{}
+	enable       bool
+
+	enableMux       sync.RWMutex
+	enableObservers []func(enabled bool)
 }
 
 type apiMeta struct {
@@ -81,6 +107,7 @@ type sqlMeta struct {
 
 func NewAgent(config *Config) (Agent, error) {
 	agent := agent{}
+	agent.connCtx, agent.connCancel = context.WithCancel(context.Background())
 
 	if config == nil {
 		return &agent, errors.New("configuration is missing")
@@ -97,7 +124,10 @@ func NewAgent(config *Config) (Agent, error) {
 	}
 
 	var err error
-	agent.spanChan = make(chan *span, 5*1024)
+	if agent.config.Span.QueueSize <= 0 {
+		agent.config.Span.QueueSize = 5 * 1024
+	}
+	agent.spanChan = make(chan *span, agent.config.Span.QueueSize)
 	agent.metaChan = make(chan interface{}, 1*1024)
 
 	agent.exceptionIdGen = 0
@@ -118,69 +148,104 @@ func NewAgent(config *Config) (Agent, error) {
 		return &agent, err
 	}
 
-	baseSampler := newRateSampler(uint64(config.Sampling.Rate))
-	if config.Sampling.NewThroughput > 0 || config.Sampling.ContinueThroughput > 0 {
-		agent.sampler = newThroughputLimitTraceSampler(baseSampler, config.Sampling.NewThroughput, config.Sampling.ContinueThroughput)
-	} else {
-		agent.sampler = newBasicTraceSampler(baseSampler)
-	}
+	agent.sampler = newTraceSampler(config)
+	agent.keySampler = newKeySampler(config)
+	agent.recent = newTraceRing(config.Span.RecentTraces)
+	agent.custom = newCustomStats(config.Stat.MaxCustomStats)
+	setAnnotationLimits(config)
+
+	if config.Span.DebugExport {
+		agent.startSpanDebugExport()
+	} else if !config.OffGrpc {
+		if c := config.Collector.Compression; c != "" && c != "none" && streamCompressor(agent.config) == "" {
+			log("agent").Warnf("unknown collector compression %s, the streams are not compressed", c)
+		}
 
-	if !config.OffGrpc {
+		//the agent stays disabled if it can't connect to the collector as configured
+		if _, err := collectorCredentials(agent.config); err != nil {
+			log("agent").Errorf("fail to load collector TLS credentials: %v", err)
+			return &agent, err
+		}
+
+		agent.registered = make(chan struct{})
 		go connectGrpc(&agent)
+
+		if config.StartupTimeout > 0 {
+			if err := agent.waitRegistered(time.Duration(config.StartupTimeout) * time.Millisecond); err != nil {
+				return &agent, err
+			}
+		}
 	}
 	return &agent, nil
 }
 
+// waitRegistered waits until the agent connects to the collector and registers the agent information.
+// If it takes longer than the timeout, the agent stops connecting.
+func (agent *agent) waitRegistered(timeout time.Duration) error {
+	select {
+	case <-agent.registered:
+		return nil
+	case <-time.After(timeout):
+		agent.connCancel()
+		log("agent").Errorf("fail to register agent in startup timeout %v", timeout)
+		return errors.New("agent is not registered in startup timeout")
+	}
+}
+
 func connectGrpc(agent *agent) {
 	var err error
 
 	for true {
-		agent.agentGrpc, err = newAgentGrpc(agent)
-		if err != nil {
-			continue
-		}
-
-		agent.spanGrpc, err = newSpanGrpc(agent)
-		if err != nil {
-			agent.agentGrpc.close()
-			continue
-		}
-
-		agent.statGrpc, err = newStatGrpc(agent)
-		if err != nil {
-			agent.agentGrpc.close()
-			agent.spanGrpc.close()
-			continue
+		if agent.isShutdown() {
+			return
 		}
 
-		agent.cmdGrpc, err = newCommandGrpc(agent)
+		conns, err := dialGrpcConns(agent.connCtx, agent)
 		if err != nil {
-			agent.agentGrpc.close()
-			agent.spanGrpc.close()
-			agent.statGrpc.close()
+			if agent.Config().Collector.MaxConnectAttempts > 0 {
+				log("agent").Errorf("fail to connect to collector, agent is disabled: %v", err)
+				return
+			}
 			continue
 		}
 
+		agent.setGrpc(conns)
 		break
 	}
 
 	for true {
-		err = agent.agentGrpc.sendAgentInfo()
+		var result *pb.PResult
+		result, err = agent.grpc().agent.sendAgentInfo()
 		if err == nil {
+			agent.applyCollectorConfig(result)
+			close(agent.registered)
 			break
 		}
-		time.Sleep(1 * time.Second)
+		if !agent.sleep(1 * time.Second) {
+			agent.closeGrpc()
+			return
+		}
 	}
 
 	for true {
-		err = agent.agentGrpc.sendApiMetadata(asyncApiId, "Asynchronous Invocation", -1, ApiTypeInvocation)
+		err = agent.grpc().agent.sendApiMetadata(asyncApiId, "Asynchronous Invocation", -1, ApiTypeInvocation)
 		if err == nil {
 			break
 		}
-		time.Sleep(1 * time.Second)
+		if !agent.sleep(1 * time.Second) {
+			agent.closeGrpc()
+			return
+		}
+	}
+
+	if agent.isShutdown() {
+		agent.closeGrpc()
+		return
 	}
 
-	agent.enable = true
+	agent.setEnable(true)
+	agent.wg.Add(2)
+	agent.cmdWg.Add(1)
 	go agent.sendPingWorker()
 	go agent.sendSpanWorker()
 	go agent.sendStatsWorker()
@@ -194,80 +259,332 @@ func connectGrpc(agent *agent) {
 	agent.statStreamReq = false
 	agent.statStreamReqCount = 0
 	go agent.statStreamMonitor()
+}
 
-	agent.wg.Add(7)
+type drainResult struct {
+	deadline  time.Time
+	flushed   int
+	undrained int
 }
 
+// Shutdown shuts down the agent after sending the queued spans, up to the timeout set by WithShutdownTimeout.
 func (agent *agent) Shutdown() {
-	if !agent.enable {
-		return
+	timeout := time.Duration(agent.Config().ShutdownTimeout) * time.Millisecond
+	agent.shutdownOnce.Do(func() { agent.doShutdown(timeout) })
+}
+
+// ShutdownWithTimeout shuts down the agent like Shutdown, but stops sending the queued spans when the timeout passes.
+// It returns the number of spans sent while draining and the number of spans left unsent.
+// The timeout is checked between spans, so a send which is blocked by the collector is not interrupted.
+func (agent *agent) ShutdownWithTimeout(timeout time.Duration) (flushed int, undrained int) {
+	agent.shutdownOnce.Do(func() { flushed, undrained = agent.doShutdown(timeout) })
+	return flushed, undrained
+}
+
+// isShutdown reports whether the agent is shut down or gave up connecting to the collector.
+func (agent *agent) isShutdown() bool {
+	return agent.connCtx.Err() != nil
+}
+
+// sleep pauses the calling worker for d, and returns false without waiting further if the agent is shut down.
+func (agent *agent) sleep(d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return true
+	case <-agent.connCtx.Done():
+		return false
+	}
+}
+
+func (agent *agent) doShutdown(drainTimeout time.Duration) (int, int) {
+	agent.connCancel()
+	if !agent.Enable() {
+		return 0, 0
 	}
 
-	agent.enable = false
+	if drainTimeout > 0 {
+		agent.drain.deadline = time.Now().Add(drainTimeout)
+	}
+	agent.setEnable(false)
 	time.Sleep(1 * time.Second)
 
+	//wait for the span and meta workers to send what they hold,
+	//the other workers exit when their connections are closed
+	agent.spanChanMux.Lock()
 	close(agent.spanChan)
+	agent.spanChanMux.Unlock()
+	agent.metaChanMux.Lock()
+	close(agent.metaChan)
+	agent.metaChanMux.Unlock()
 	agent.wg.Wait()
 
-	agent.agentGrpc.close()
-	agent.spanGrpc.close()
-	agent.statGrpc.close()
+	agent.closeCommandStreams(3 * time.Second)
+	agent.closePingStream(3 * time.Second)
+	agent.closeGrpc()
+
+	log("agent").Infof("shutdown: %d spans flushed, %d spans undrained", agent.drain.flushed, agent.drain.undrained)
+	return agent.drain.flushed, agent.drain.undrained
 }
 
-func (agent *agent) NewSpanTracer(operation string) Tracer {
-	var tracer Tracer
+func (agent *agent) closeGrpc() {
+	conns := agent.grpc()
+	conns.close()
+}
 
-	if agent.enable {
-		reader := &noopDistributedTracingContextReader{}
-		tracer = agent.NewSpanTracerWithReader(operation, reader)
-		tracer.Extract(reader)
-	} else {
-		tracer = newNoopSpan(agent)
+// grpc returns the grpc clients of the collector, which ReconnectCollector may swap at any time.
+func (agent *agent) grpc() grpcConns {
+	agent.collectorMux.RLock()
+	defer agent.collectorMux.RUnlock()
+	return grpcConns{agent.agentGrpc, agent.spanGrpc, agent.statGrpc, agent.cmdGrpc}
+}
+
+func (agent *agent) setGrpc(conns grpcConns) {
+	agent.collectorMux.Lock()
+	defer agent.collectorMux.Unlock()
+	agent.agentGrpc, agent.spanGrpc, agent.statGrpc, agent.cmdGrpc = conns.agent, conns.span, conns.stat, conns.cmd
+}
+
+func (agent *agent) setConfig(config Config) {
+	agent.collectorMux.Lock()
+	defer agent.collectorMux.Unlock()
+	agent.config = config
+}
+
+func (agent *agent) ReconnectCollector(host string, agentPort int, spanPort int, statPort int) error {
+	if !agent.Enable() {
+		return errors.New("agent is disabled")
+	}
+
+	oldConfig := agent.Config()
+	newConfig := oldConfig
+	newConfig.Collector.Host = host
+	newConfig.Collector.AgentHost = ""
+	newConfig.Collector.SpanHost = ""
+	newConfig.Collector.StatHost = ""
+	newConfig.Collector.CommandHost = ""
+	newConfig.Collector.AgentPort = agentPort
+	newConfig.Collector.SpanPort = spanPort
+	newConfig.Collector.StatPort = statPort
+
+	log("agent").Infof("reconnect to collector: %s (agent=%d, span=%d, stat=%d)", host, agentPort, spanPort, statPort)
+
+	agent.setConfig(newConfig)
+	conns, err := dialGrpcConns(agent.connCtx, agent)
+	if err != nil {
+		agent.setConfig(oldConfig)
+		return err
+	}
+
+	//made before connMux is held, so that the span worker is not blocked while the stream is retried
+	stream := conns.span.newSpanStreamWithRetry()
+
+	agent.connMux.Lock()
+	if agent.spanStream != nil {
+		//the span worker has not made the stream yet otherwise, and makes it on the new collector
+		agent.sendSpanBuffer()
+		agent.drainSpanChan()
+		agent.spanStream.close()
+	}
+
+	oldConns := agent.grpc()
+	agent.setGrpc(conns)
+
+	agent.spanStream = stream
+	agent.connMux.Unlock()
+
+	//ping, stat and command workers reconnect to the new collector when their streams on the old one break
+	oldConns.close()
+
+	agent.exceptionIdCache.Purge()
+	agent.sqlCache.Purge()
+	agent.apiCache.Purge()
+
+	result, err := conns.agent.sendAgentInfo()
+	if err != nil {
+		return err
+	}
+	agent.applyCollectorConfig(result)
+
+	return conns.agent.sendApiMetadata(asyncApiId, "Asynchronous Invocation", -1, ApiTypeInvocation)
+}
+
+// collectorConfig is the settings a collector may return in the result message of the agent info, as a JSON object.
+// It is a convention of this agent, not a part of the Pinpoint collector protocol,
+// and the result message which is not a JSON object, such as that of the Pinpoint collector, is ignored.
+type collectorConfig struct {
+	Sampling *struct {
+		Rate               int
+		NewThroughput      int
+		ContinueThroughput int
+	}
+}
+
+func (agent *agent) applyCollectorConfig(result *pb.PResult) {
+	if result == nil {
+		return
+	}
+
+	if !result.Success {
+		log("agent").Warn("collector rejected agent info: ", result.Message)
+		return
+	}
+
+	if !strings.HasPrefix(result.Message, "{") {
+		return
+	}
+
+	var cc collectorConfig
+	if err := json.Unmarshal([]byte(result.Message), &cc); err != nil {
+		log("agent").Errorf("fail to parse collector config: %v", err)
+		return
+	}
+
+	if cc.Sampling == nil || cc.Sampling.Rate <= 0 {
+		return
+	}
+
+	//the config and the sampler made from it are published together, so that no span is sampled by one of them alone
+	agent.collectorMux.Lock()
+	defer agent.collectorMux.Unlock()
+
+	if agent.sameSampling(cc) {
+		return
+	}
+
+	config := agent.config
+	config.Sampling.Rate = cc.Sampling.Rate
+	config.Sampling.NewThroughput = cc.Sampling.NewThroughput
+	config.Sampling.ContinueThroughput = cc.Sampling.ContinueThroughput
+	agent.config = config
+	agent.sampler = newTraceSampler(&config)
+
+	log("agent").Info("apply collector sampling config: ", result.Message)
+}
+
+// collectorMux must be held by the caller
+func (agent *agent) sameSampling(cc collectorConfig) bool {
+	return cc.Sampling.Rate == agent.config.Sampling.Rate &&
+		cc.Sampling.NewThroughput == agent.config.Sampling.NewThroughput &&
+		cc.Sampling.ContinueThroughput == agent.config.Sampling.ContinueThroughput
+}
+
+// traceSampler returns the sampler, which applyCollectorConfig may replace at any time.
+func (agent *agent) traceSampler() traceSampler {
+	agent.collectorMux.RLock()
+	defer agent.collectorMux.RUnlock()
+	return agent.sampler
+}
+
+func (agent *agent) drainSpanChan() {
+	for len(agent.spanChan) > 0 {
+		span, ok := <-agent.spanChan
+		if !ok {
+			return
+		}
+
+		err := agent.spanStream.sendSpan(span)
+		if err != nil {
+			log("agent").Errorf("fail to sendSpan() while draining: %v", err)
+		}
 	}
+}
+
+func (agent *agent) NewSpanTracer(operation string) Tracer {
+	tracer, _ := agent.NewSpanTracerWithStatus(operation)
 	return tracer
 }
 
+func (agent *agent) NewSpanTracerWithStatus(operation string) (Tracer, SpanStatus) {
+	if !agent.Enable() {
+		return newNoopSpan(agent), SpanStatusDisabled
+	}
+
+	reader := &noopDistributedTracingContextReader{}
+	tracer, status := agent.NewSpanTracerWithReaderAndStatus(operation, reader)
+	tracer.Extract(reader)
+	return tracer, status
+}
+
 func (agent *agent) NewSpanTracerWithReader(operation string, reader DistributedTracingContextReader) Tracer {
-	if !agent.enable {
-		return newNoopSpan(agent)
+	tracer, _ := agent.NewSpanTracerWithReaderAndStatus(operation, reader)
+	return tracer
+}
+
+func (agent *agent) NewSpanTracerWithReaderAndStatus(operation string, reader DistributedTracingContextReader) (Tracer, SpanStatus) {
+	if !agent.Enable() {
+		return newNoopSpan(agent), SpanStatusDisabled
+	}
+	if agent.Config().Propagation.W3C {
+		reader = newW3CReader(reader)
 	}
 
 	atomic.AddInt64(&agent.sequence, 1)
 
+	flags, _ := strconv.Atoi(reader.Get(HttpFlags))
 	sampled := reader.Get(HttpSampled)
-	if sampled == "s0" {
+	if sampled == "s0" || flags&FlagDropSample != 0 {
 		incrUnsampleCont()
-		return newNoopSpan(agent)
+		return newNoopSpan(agent), SpanStatusUnsampled
 	}
 
-	var tracer Tracer
-	isSampled := false
-
+	var status SpanStatus
 	tid := reader.Get(HttpTraceId)
-	if tid == "" {
-		if agent.sampler.isNewSampled() {
-			tracer = newSampledSpan(agent, operation)
-			isSampled = true
+	if flags&FlagForceSample != 0 {
+		if tid == "" {
+			incrSampleNew()
 		} else {
-			tracer = newNoopSpan(agent)
+			incrSampleCont()
+		}
+		status = SpanStatusSampled
+	} else if tid == "" {
+		var keyed bool
+		if status, keyed = agent.keySampler.sampleNew(reader); !keyed {
+			status = agent.traceSampler().sampleNew()
 		}
 	} else {
-		if agent.sampler.isContinueSampled() {
-			tracer = newSampledSpan(agent, operation)
-			isSampled = true
-		} else {
-			tracer = newNoopSpan(agent)
+		status = agent.traceSampler().sampleContinue()
+	}
+
+	var tracer Tracer
+	if status == SpanStatusSampled {
+		tracer = newSampledSpan(agent, operation)
+	} else if tid == "" {
+		if tracer = agent.newCandidateSpan(operation); tracer != nil {
+			status = SpanStatusCandidate
 		}
 	}
 
-	if isSampled {
-		tracer.Extract(reader)
+	if tracer == nil {
+		return newNoopSpan(agent), status
 	}
-	return tracer
+
+	tracer.Extract(reader)
+	return tracer, status
+}
+
+func (agent *agent) newCandidateSpan(operation string) Tracer {
+	if agent.Config().Sampling.KeepSlowThreshold <= 0 {
+		return nil
+	}
+
+	if atomic.AddInt32(&candidateSpanCount, 1) > int32(agent.Config().Sampling.KeepMaxBuffered) {
+		atomic.AddInt32(&candidateSpanCount, -1)
+		return nil
+	}
+
+	span := defaultSpan()
+	span.agent = agent
+	span.operationName = operation
+	span.candidate = true
+
+	return span
 }
 
 func (agent *agent) RegisterSpanApiId(descriptor string, apiType int) int32 {
-	if !agent.enable {
+	if !agent.Enable() {
 		return 0
 	}
 
@@ -276,55 +593,280 @@ func (agent *agent) RegisterSpanApiId(descriptor string, apiType int) int32 {
 }
 
 func (agent *agent) Config() Config {
+	agent.collectorMux.RLock()
+	defer agent.collectorMux.RUnlock()
 	return agent.config
 }
 
 func (agent *agent) GenerateTransactionId() TransactionId {
-	return TransactionId{agent.config.AgentId, agent.startTime, agent.sequence}
+	return TransactionId{agent.Config().AgentId, agent.startTime, agent.sequence}
+}
+
+func (agent *agent) StreamStats() StreamStats {
+	return agent.streamRecorder.stats()
+}
+
+func (agent *agent) streams() *streamRecorder {
+	return &agent.streamRecorder
+}
+
+// SamplerState reads the settings and the sampler under the same lock, as the collector config may replace both of them.
+// The counts are read atomically, so they may be updated by the requests in between.
+func (agent *agent) SamplerState() SamplerState {
+	agent.collectorMux.RLock()
+	sampling := agent.config.Sampling
+	sampler := agent.sampler
+	agent.collectorMux.RUnlock()
+
+	state := SamplerState{
+		Rate:               sampling.Rate,
+		ContinuationRate:   sampling.ContinuationRate,
+		NewThroughput:      sampling.NewThroughput,
+		ContinueThroughput: sampling.ContinueThroughput,
+	}
+	if state.ContinuationRate <= 0 {
+		state.ContinuationRate = state.Rate
+	}
+
+	state.NewTokens, state.ContinueTokens = sampler.tokens()
+	state.SampledNew, state.SampledContinue, state.UnsampledNew, state.UnsampledContinue, state.SkippedNew, state.SkippedContinue = getSamplingCounts()
+	return state
+}
+
+// RecentTraces returns the summaries of the last spans, from the newest, if WithSpanRecentTraces is set.
+func (agent *agent) RecentTraces() []TraceSummary {
+	if agent.recent == nil {
+		return nil
+	}
+	return agent.recent.list()
+}
+
+// RecordCustomStat sets the value of a gauge sent with the agent stats at every stat collect interval.
+// The value is kept until it is recorded again.
+func (agent *agent) RecordCustomStat(name string, value float64) {
+	agent.custom.record(name, value)
 }
 
 func (agent *agent) Enable() bool {
+	agent.enableMux.RLock()
+	defer agent.enableMux.RUnlock()
 	return agent.enable
 }
 
+// OnEnableChange registers a function called with the new state whenever the agent is enabled or disabled.
+// The function is called synchronously, so it should return quickly.
+func (agent *agent) OnEnableChange(f func(enabled bool)) {
+	if f == nil {
+		return
+	}
+
+	agent.enableMux.Lock()
+	defer agent.enableMux.Unlock()
+	agent.enableObservers = append(agent.enableObservers, f)
+}
+
+func (agent *agent) setEnable(enable bool) {
+	agent.enableMux.Lock()
+	if agent.enable == enable {
+		agent.enableMux.Unlock()
+		return
+	}
+	agent.enable = enable
+	observers := agent.enableObservers
+	agent.enableMux.Unlock()
+
+	for _, f := range observers {
+		f(enable)
+	}
+}
+
 func (agent *agent) StartTime() int64 {
 	return agent.startTime
 }
 
 func (agent *agent) sendPingWorker() {
 	log("agent").Info("ping goroutine start")
-	defer agent.wg.Done()
-	stream := agent.agentGrpc.newPingStreamWithRetry()
+	stream := agent.grpc().agent.newPingStreamWithRetry()
+	agent.setPingStream(stream)
+
+	resendInterval := time.Duration(agent.Config().Collector.AgentInfoResendInterval) * time.Millisecond
+	pingInterval := time.Duration(agent.Config().Collector.PingInterval) * time.Millisecond
+	if pingInterval <= 0 {
+		pingInterval = 60 * time.Second
+	}
+	lastSent := time.Now()
 
 	for true {
-		if !agent.enable {
+		if !agent.Enable() {
 			break
 		}
 
 		err := stream.sendPing()
 		if err != nil {
 			log("agent").Errorf("fail to sendPing(): %v", err)
+			agent.streams().recordError(streamPing, err)
 			stream.close()
-			stream = agent.agentGrpc.newPingStreamWithRetry()
+			stream = agent.grpc().agent.newPingStreamWithRetry()
+			agent.setPingStream(stream)
+
+			//the collector may have lost the agent registration
+			agent.resendAgentInfo()
+			lastSent = time.Now()
+		} else {
+			agent.streams().recordSend(streamPing)
+			if resendInterval > 0 && time.Since(lastSent) >= resendInterval {
+				agent.resendAgentInfo()
+				lastSent = time.Now()
+			}
 		}
 
-		time.Sleep(60 * time.Second)
+		if !agent.sleep(pingInterval) {
+			break
+		}
 	}
 
 	stream.close()
 	log("agent").Info("ping goroutine finish")
 }
 
+func (agent *agent) setPingStream(stream *pingStream) {
+	agent.pingMux.Lock()
+	defer agent.pingMux.Unlock()
+	agent.pingStream = stream
+}
+
+// closePingStream ends the ping session before the connection is closed,
+// so that the collector shows the agent as shut down rather than disconnected.
+func (agent *agent) closePingStream(timeout time.Duration) {
+	agent.pingMux.Lock()
+	stream := agent.pingStream
+	agent.pingMux.Unlock()
+
+	if stream != nil && stream.closeGracefully(timeout) {
+		log("agent").Info("ping session closed")
+	}
+}
+
+func (agent *agent) resendAgentInfo() {
+	if !agent.Enable() {
+		return
+	}
+
+	result, err := agent.grpc().agent.sendAgentInfo()
+	if err == nil {
+		agent.applyCollectorConfig(result)
+	}
+}
+
 func (agent *agent) sendSpanWorker() {
 	log("agent").Info("span goroutine start")
 	defer agent.wg.Done()
-	agent.spanStream = agent.spanGrpc.newSpanStreamWithRetry()
+	stream := agent.grpc().span.newSpanStreamWithRetry()
+	agent.connMux.Lock()
+	agent.spanStream = stream
+	agent.connMux.Unlock()
+
+	config := agent.Config().Span
+	sizer := newBatchSizer(config.BatchSize, config.MaxBatchSize, time.Duration(config.SlowSendThreshold)*time.Millisecond, config.AdaptiveBatch)
+	agent.spanBuffer = make([]*span, 0, sizer.max)
+
+	idleInterval := time.Duration(agent.Config().Span.IdleFlushInterval) * time.Millisecond
+	var idleTimer <-chan time.Time
+	if idleInterval > 0 {
+		idleTimer = time.After(idleInterval)
+	}
 
-	for span := range agent.spanChan {
-		if !agent.enable {
-			break
+	for {
+		select {
+		case span, ok := <-agent.spanChan:
+			if !ok || !agent.Enable() {
+				if ok {
+					agent.drainOnShutdown(span)
+				} else {
+					agent.drainOnShutdown(nil)
+				}
+				agent.spanStream.close()
+				log("agent").Info("span goroutine finish")
+				return
+			}
+
+			sent := true
+			agent.connMux.Lock()
+			agent.spanBuffer = append(agent.spanBuffer, span)
+			if len(agent.spanBuffer) >= sizer.current() {
+				start := time.Now()
+				sent = agent.sendSpanBuffer()
+				sizer.adjust(time.Since(start))
+			}
+			agent.connMux.Unlock()
+
+			if !sent {
+				agent.remakeSpanStream()
+			}
+		case <-idleTimer:
+			agent.flushSpanBuffer()
 		}
 
+		if idleInterval > 0 {
+			idleTimer = time.After(idleInterval)
+		}
+	}
+}
+
+// drainOnShutdown sends the buffered and queued spans until the drain deadline, without reconnecting.
+func (agent *agent) drainOnShutdown(received *span) {
+	agent.connMux.Lock()
+	defer agent.connMux.Unlock()
+
+	pending := agent.spanBuffer
+	if received != nil {
+		pending = append(pending, received)
+	}
+	for more := true; more; {
+		select {
+		case span, ok := <-agent.spanChan:
+			if ok {
+				pending = append(pending, span)
+			} else {
+				more = false
+			}
+		default:
+			more = false
+		}
+	}
+
+	deadline := agent.drain.deadline
+	for _, span := range pending {
+		if !deadline.IsZero() && time.Now().After(deadline) {
+			agent.drain.undrained++
+			continue
+		}
+
+		if err := agent.spanStream.sendSpan(span); err != nil {
+			log("agent").Errorf("fail to sendSpan() while shutting down: %v", err)
+			agent.drain.undrained++
+		} else {
+			agent.drain.flushed++
+		}
+	}
+	agent.spanBuffer = agent.spanBuffer[:0]
+}
+
+func (agent *agent) flushSpanBuffer() {
+	agent.connMux.Lock()
+	sent := agent.sendSpanBuffer()
+	agent.connMux.Unlock()
+
+	if !sent {
+		agent.remakeSpanStream()
+	}
+}
+
+// sendSpanBuffer sends the buffered spans. connMux must be held by the caller.
+// If the stream breaks, it is closed and the spans after the failed one are kept in the buffer.
+// It returns false then, and the caller remakes the stream by remakeSpanStream after releasing connMux.
+func (agent *agent) sendSpanBuffer() bool {
+	for i, span := range agent.spanBuffer {
 		agent.spanStreamReq = true
 		err := agent.spanStream.sendSpan(span)
 		agent.spanStreamReq = false
@@ -332,39 +874,115 @@ func (agent *agent) sendSpanWorker() {
 
 		if err != nil {
 			log("agent").Errorf("fail to sendSpan(): %v", err)
+			agent.streams().recordError(streamSpan, err)
 			agent.spanStream.close()
-			agent.spanStream = agent.spanGrpc.newSpanStreamWithRetry()
+			agent.spanStream = &spanStream{nil}
+
+			n := copy(agent.spanBuffer, agent.spanBuffer[i+1:])
+			agent.spanBuffer = agent.spanBuffer[:n]
+			return false
 		}
 	}
 
-	agent.spanStream.close()
-	log("agent").Info("span goroutine finish")
+	agent.spanBuffer = agent.spanBuffer[:0]
+	return true
 }
 
+// remakeSpanStream makes the span stream again after it broke.
+// The retry backs off without connMux held, so that ReconnectCollector and Shutdown are not blocked meanwhile.
+func (agent *agent) remakeSpanStream() {
+	conn := agent.grpc().span
+	stream := conn.newSpanStreamWithRetry()
+
+	agent.connMux.Lock()
+	defer agent.connMux.Unlock()
+
+	if agent.grpc().span != conn {
+		//ReconnectCollector has made the stream on the new collector meanwhile
+		stream.close()
+		return
+	}
+
+	agent.spanStream = stream
+	if stream.stream == nil {
+		//the retry gave up or the agent is shut down
+		agent.spanBuffer = agent.spanBuffer[:0]
+	}
+}
+
+// The policies of the span queue when it is full, set by WithSpanQueueFullPolicy.
+const (
+	// SpanQueueDropOldest discards the oldest queued span to queue the new one.
+	SpanQueueDropOldest = "DROP_OLDEST"
+	// SpanQueueDropNewest discards the new span, keeping the queued ones.
+	SpanQueueDropNewest = "DROP_NEWEST"
+)
+
 func (agent *agent) TryEnqueueSpan(span *span) bool {
-	if !agent.enable {
+	agent.spanChanMux.RLock()
+	defer agent.spanChanMux.RUnlock()
+
+	if !agent.Enable() {
 		return false
 	}
 
+	//the summary is taken before the span is passed to the span worker,
+	//and kept only if the span is queued, so that the dropped spans are not listed
+	var summary TraceSummary
+	if agent.recent != nil {
+		summary = newTraceSummary(span)
+	}
+
 	select {
 	case agent.spanChan <- span:
+		agent.addRecentTrace(summary)
 		return true
 	default:
 		break
 	}
 
-	<-agent.spanChan
-	return false
+	dropped, queued := int64(1), false
+	if agent.Config().Span.QueueFullPolicy != SpanQueueDropNewest {
+		//the queue may be drained or refilled by other goroutines meanwhile, so neither is blocked on
+		select {
+		case <-agent.spanChan:
+			select {
+			case agent.spanChan <- span:
+				queued = true
+			default:
+				dropped = 2
+			}
+		default:
+		}
+	}
+
+	if queued {
+		agent.addRecentTrace(summary)
+	}
+	recordDroppedSpan(dropped, agent.statInterval())
+	return queued
+}
+
+func (agent *agent) addRecentTrace(summary TraceSummary) {
+	if agent.recent != nil {
+		agent.recent.add(summary)
+	}
+}
+
+func (agent *agent) statInterval() time.Duration {
+	return time.Duration(agent.Config().Stat.CollectInterval) * time.Millisecond
 }
 
 func (agent *agent) spanStreamMonitor() {
 	for true {
-		if !agent.enable {
+		if !agent.Enable() {
 			break
 		}
 
 		c := agent.spanStreamReqCount
-		time.Sleep(5 * time.Second)
+		if !agent.sleep(5 * time.Second) {
+			break
+		}
 
 		if agent.spanStreamReq == true && c == agent.spanStreamReqCount {
 			agent.spanStream.close()
@@ -374,12 +992,14 @@ func (agent *agent) spanStreamMonitor() {
 
 func (agent *agent) statStreamMonitor() {
 	for true {
-		if !agent.enable {
+		if !agent.Enable() {
 			break
 		}
 
 		c := agent.statStreamReqCount
-		time.Sleep(5 * time.Second)
+		if !agent.sleep(5 * time.Second) {
+			break
+		}
 
 		if agent.statStreamReq == true && c == agent.statStreamReqCount {
 			agent.statStream.close()
@@ -391,37 +1011,108 @@ func (agent *agent) sendMetaWorker() {
 	log("agent").Info("meta goroutine start")
 	defer agent.wg.Done()
 
-	for md := range agent.metaChan {
-		if !agent.enable {
-			break
+	window := time.Duration(agent.Config().Metadata.BatchWindow) * time.Millisecond
+	if window > 0 && agent.Config().Metadata.BatchSize > 1 {
+		agent.sendMetaBatches(window, agent.Config().Metadata.BatchSize)
+	} else {
+		for md := range agent.metaChan {
+			if !agent.Enable() {
+				break
+			}
+			agent.sendMeta(md)
 		}
+	}
 
-		var err error
-		switch md.(type) {
-		case apiMeta:
-			api := md.(apiMeta)
-			err = agent.agentGrpc.sendApiMetadata(api.id, api.descriptor, -1, api.apiType)
-			break
-		case stringMeta:
-			str := md.(stringMeta)
-			err = agent.agentGrpc.sendStringMetadata(str.id, str.funcname)
-			break
-		case sqlMeta:
-			sql := md.(sqlMeta)
-			err = agent.agentGrpc.sendSqlMetadata(sql.id, sql.sql)
+	log("agent").Info("meta goroutine finish")
+}
+
+// metaPipelineDepth is the number of metadata RPCs of a batch in flight at once.
+const metaPipelineDepth = 4
+
+// sendMetaBatches collects the metadata queued within the window, up to size, and sends them as a batch.
+// The collector has no batch RPC, so each metadata is still a unary call,
+// but up to metaPipelineDepth calls of a batch are pipelined over the connection instead of waiting for each other.
+func (agent *agent) sendMetaBatches(window time.Duration, size int) {
+	batch := make([]interface{}, 0, size)
+
+	for md := range agent.metaChan {
+		if !agent.Enable() {
 			break
 		}
 
-		if err != nil {
-			log("agent").Errorf("fail to sendMetadata(): %v", err)
+		batch = append(batch[:0], md)
+		timer := time.NewTimer(window)
+	collect:
+		for len(batch) < size {
+			select {
+			case md, ok := <-agent.metaChan:
+				if !ok {
+					break collect
+				}
+				batch = append(batch, md)
+			case <-timer.C:
+				break collect
+			}
 		}
+		timer.Stop()
+
+		agent.sendMetaPipelined(batch, metaPipelineDepth)
+		log("agent").Debugf("send metadata batch: %d", len(batch))
 	}
+}
 
-	log("agent").Info("meta goroutine finish")
+// sendMetaPipelined sends the batch with up to depth calls in flight, and returns when all of them are done.
+func (agent *agent) sendMetaPipelined(batch []interface{}, depth int) {
+	queue := make(chan interface{}, len(batch))
+	for _, md := range batch {
+		queue <- md
+	}
+	close(queue)
+
+	if depth > len(batch) {
+		depth = len(batch)
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(depth)
+	for i := 0; i < depth; i++ {
+		go func() {
+			defer wg.Done()
+			for md := range queue {
+				agent.sendMeta(md)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func (agent *agent) sendMeta(md interface{}) {
+	var err error
+	switch md.(type) {
+	case apiMeta:
+		api := md.(apiMeta)
+		err = agent.grpc().agent.sendApiMetadata(api.id, api.descriptor, -1, api.apiType)
+		break
+	case stringMeta:
+		str := md.(stringMeta)
+		err = agent.grpc().agent.sendStringMetadata(str.id, str.funcname)
+		break
+	case sqlMeta:
+		sql := md.(sqlMeta)
+		err = agent.grpc().agent.sendSqlMetadata(sql.id, sql.sql)
+		break
+	}
+
+	if err != nil {
+		log("agent").Errorf("fail to sendMetadata(): %v", err)
+	}
 }
 
 func (agent *agent) tryEnqueueMeta(md interface{}) bool {
-	if !agent.enable {
+	agent.metaChanMux.RLock()
+	defer agent.metaChanMux.RUnlock()
+
+	if !agent.Enable() {
 		return false
 	}
 
@@ -439,7 +1130,7 @@ func (agent *agent) tryEnqueueMeta(md interface{}) bool {
 func (agent *agent) CacheErrorFunc(funcname string) int32 {
 	var id int32
 
-	if !agent.enable {
+	if !agent.Enable() {
 		return -1
 	}
 
@@ -464,7 +1155,7 @@ func (agent *agent) CacheErrorFunc(funcname string) int32 {
 func (agent *agent) CacheSql(sql string) int32 {
 	var id int32
 
-	if !agent.enable {
+	if !agent.Enable() {
 		return -1
 	}
 
@@ -489,10 +1180,11 @@ func (agent *agent) CacheSql(sql string) int32 {
 func (agent *agent) CacheSpanApiId(descriptor string, apiType int) int32 {
 	var id int32
 
-	if !agent.enable {
+	if !agent.Enable() {
 		return -1
 	}
 
+	descriptor = truncateName(descriptor)
 	key := descriptor + "_" + strconv.Itoa(apiType)
 
 	if agent.apiCache.Contains(key) {
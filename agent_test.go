@@ -1,8 +1,17 @@
 package pinpoint
 
 import (
+	"context"
+	"errors"
+	"github.com/golang/mock/gomock"
+	pb "github.com/pinpoint-apm/pinpoint-go-agent/protobuf"
 	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"strconv"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 )
 
 func Test_agent_NewSpanTracer(t *testing.T) {
@@ -15,9 +24,9 @@ func Test_agent_NewSpanTracer(t *testing.T) {
 		WithAgentId("testagent"),
 	}
 	c, _ := NewConfig(opts...)
+	c.OffGrpc = true
 	a, _ := NewAgent(c)
 	agent := a.(*agent)
-	agent.config.OffGrpc = true
 	agent.enable = true
 
 	tests := []struct {
@@ -53,9 +62,9 @@ func Test_agent_NewSpanTracerWithReader(t *testing.T) {
 		WithAgentId("testagent"),
 	}
 	c, _ := NewConfig(opts...)
+	c.OffGrpc = true
 	a, _ := NewAgent(c)
 	agent := a.(*agent)
-	agent.config.OffGrpc = true
 	agent.enable = true
 
 	m := map[string]string{
@@ -85,3 +94,919 @@ func Test_agent_NewSpanTracerWithReader(t *testing.T) {
 		})
 	}
 }
+
+func Test_agent_NewSpanTracerWithReader_KeepUpstreamTransactionId(t *testing.T) {
+	type args struct {
+		reader DistributedTracingContextReader
+	}
+
+	opts := []ConfigOption{
+		WithAppName("test"),
+		WithAgentId("testagent"),
+	}
+	c, _ := NewConfig(opts...)
+	c.OffGrpc = true
+	a, _ := NewAgent(c)
+	agent := a.(*agent)
+	agent.enable = true
+
+	tests := []struct {
+		name string
+		args args
+		want TransactionId
+	}{
+		{"1", args{&DistributedTracingContextMap{map[string]string{HttpTraceId: "upstream^1600000000000^42"}}}, TransactionId{"upstream", 1600000000000, 42}},
+		{"2", args{&DistributedTracingContextMap{map[string]string{HttpTraceId: "testagent^1600000000000^7"}}}, TransactionId{"testagent", 1600000000000, 7}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			span := agent.NewSpanTracerWithReader("test", tt.args.reader)
+
+			txid := span.TransactionId()
+			assert.Equal(t, tt.want, txid, "TransactionId")
+			assert.NotEqual(t, agent.StartTime(), txid.StartTime, "StartTime")
+		})
+	}
+}
+
+func Test_agent_NewSpanTracerWithReader_InvalidTransactionId(t *testing.T) {
+	opts := []ConfigOption{
+		WithAppName("test"),
+		WithAgentId("testagent"),
+	}
+	c, _ := NewConfig(opts...)
+	c.OffGrpc = true
+	a, _ := NewAgent(c)
+	agent := a.(*agent)
+	agent.enable = true
+
+	reader := &DistributedTracingContextMap{map[string]string{HttpTraceId: "upstream^invalid"}}
+	span := agent.NewSpanTracerWithReader("test", reader)
+
+	txid := span.TransactionId()
+	assert.Equal(t, "testagent", txid.AgentId, "AgentId")
+	assert.Equal(t, agent.StartTime(), txid.StartTime, "StartTime")
+}
+
+func Test_agent_NewSpanTracerWithReader_Flags(t *testing.T) {
+	opts := []ConfigOption{
+		WithAppName("test"),
+		WithAgentId("testagent"),
+		WithSamplingRate(1000),
+	}
+	c, _ := NewConfig(opts...)
+	c.OffGrpc = true
+	a, _ := NewAgent(c)
+	agent := a.(*agent)
+	agent.enable = true
+
+	tests := []struct {
+		name    string
+		headers map[string]string
+		sampled bool
+	}{
+		{"1", map[string]string{}, false},
+		{"2", map[string]string{HttpFlags: "1"}, true},
+		{"3", map[string]string{HttpTraceId: "upstream^1600000000000^42", HttpFlags: "1"}, true},
+		{"4", map[string]string{HttpTraceId: "upstream^1600000000000^42", HttpFlags: "3"}, false},
+		{"5", map[string]string{HttpTraceId: "upstream^1600000000000^42", HttpFlags: "1", HttpSampled: "s0"}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tracer := agent.NewSpanTracerWithReader("test", &DistributedTracingContextMap{tt.headers})
+
+			_, ok := tracer.(*span)
+			assert.Equal(t, tt.sampled, ok, "sampled")
+		})
+	}
+}
+
+func Test_agent_NewSpanTracerWithReaderAndStatus(t *testing.T) {
+	opts := []ConfigOption{
+		WithAppName("test"),
+		WithAgentId("testagent"),
+		WithSamplingNewThroughput(1),
+	}
+	c, _ := NewConfig(opts...)
+	c.OffGrpc = true
+	a, _ := NewAgent(c)
+	agent := a.(*agent)
+	agent.enable = true
+
+	tests := []struct {
+		name    string
+		headers map[string]string
+		want    SpanStatus
+	}{
+		{"1", map[string]string{}, SpanStatusSampled},
+		{"2", map[string]string{}, SpanStatusDropped},
+		{"3", map[string]string{HttpSampled: "s0"}, SpanStatusUnsampled},
+		{"4", map[string]string{HttpTraceId: "upstream^1600000000000^42"}, SpanStatusSampled},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tracer, status := agent.NewSpanTracerWithReaderAndStatus("test", &DistributedTracingContextMap{tt.headers})
+			assert.Equal(t, tt.want, status, "status")
+
+			_, ok := tracer.(*span)
+			assert.Equal(t, tt.want == SpanStatusSampled, ok, "sampled")
+		})
+	}
+
+	agent.enable = false
+	_, status := agent.NewSpanTracerWithStatus("test")
+	assert.Equal(t, SpanStatusDisabled, status, "status")
+}
+
+func Test_agent_SamplerState_Skipped(t *testing.T) {
+	c, _ := NewConfig(WithAppName("test"), WithAgentId("testagent"), WithSamplingNewThroughput(1), WithSamplingContinueThroughput(1))
+	c.OffGrpc = true
+	a, _ := NewAgent(c)
+	agent := a.(*agent)
+	agent.enable = true
+
+	before := agent.SamplerState()
+	for i := 0; i < 3; i++ {
+		agent.NewSpanTracer("test")
+		agent.NewSpanTracerWithReader("test", &DistributedTracingContextMap{map[string]string{HttpTraceId: "upstream^1600000000000^42"}})
+	}
+	agent.NewSpanTracerWithReader("test", &DistributedTracingContextMap{map[string]string{HttpSampled: "s0"}})
+	after := agent.SamplerState()
+
+	assert.Equal(t, int64(2), after.SkippedNew-before.SkippedNew, "skipped new")
+	assert.Equal(t, int64(2), after.SkippedContinue-before.SkippedContinue, "skipped continue")
+	assert.Equal(t, int64(1), after.UnsampledContinue-before.UnsampledContinue, "unsampled continue")
+}
+
+func Test_agent_SamplerState_WhileApplyingCollectorConfig(t *testing.T) {
+	c, _ := NewConfig(WithAppName("test"), WithAgentId("testagent"), WithSamplingRate(1))
+	c.OffGrpc = true
+	a, _ := NewAgent(c)
+	agent := a.(*agent)
+	agent.enable = true
+
+	done := make(chan struct{})
+	checked := make(chan struct{})
+	go func() {
+		defer close(checked)
+		for {
+			select {
+			case <-done:
+				return
+			default:
+				agent.NewSpanTracer("test")
+				state := agent.SamplerState()
+				if state.Rate == 1 {
+					assert.Equal(t, float64(-1), state.NewTokens, "tokens of the initial sampler")
+				} else {
+					assert.Equal(t, 5, state.NewThroughput, "throughput of the collector config")
+					assert.GreaterOrEqual(t, state.NewTokens, float64(0), "tokens of the collector config sampler")
+				}
+			}
+		}
+	}()
+
+	time.Sleep(10 * time.Millisecond)
+	agent.applyCollectorConfig(&pb.PResult{Success: true, Message: `{"Sampling": {"Rate": 10, "NewThroughput": 5}}`})
+	time.Sleep(10 * time.Millisecond)
+	close(done)
+	<-checked
+
+	assert.Equal(t, 10, agent.SamplerState().Rate, "Rate")
+}
+
+func Test_NewTransactionTracer(t *testing.T) {
+	opts := []ConfigOption{
+		WithAppName("test"),
+		WithAgentId("testagent"),
+	}
+	c, _ := NewConfig(opts...)
+	c.OffGrpc = true
+	a, _ := NewAgent(c)
+	agent := a.(*agent)
+	agent.enable = true
+
+	tracer := NewTransactionTracer(agent, "Order Workflow", ServiceTypeGoFunction)
+	s := tracer.(*span)
+	assert.Equal(t, int32(ServiceTypeGoFunction), s.serviceType, "serviceType")
+	assert.Equal(t, "Order Workflow", s.rpcName, "rpcName")
+	assert.Greater(t, s.apiId, int32(0), "apiId")
+
+	tracer = NewTransactionTracer(agent, "Order Workflow", 0)
+	assert.Equal(t, int32(ServiceTypeGoApp), tracer.(*span).serviceType, "serviceType")
+	assert.Equal(t, s.apiId, tracer.(*span).apiId, "apiId")
+}
+
+func Test_NewBatchTracer(t *testing.T) {
+	c, _ := NewConfig(WithAppName("test"), WithAgentId("testagent"))
+	c.OffGrpc = true
+	a, _ := NewAgent(c)
+	agent := a.(*agent)
+	agent.enable = true
+
+	s := NewBatchTracer(agent, "Nightly Report").(*span)
+	assert.Equal(t, int32(ServiceTypeGoApp), s.serviceType, "serviceType")
+	assert.Equal(t, "Nightly Report", s.rpcName, "rpcName")
+
+	web := NewTransactionTracer(agent, "Nightly Report", 0).(*span)
+	assert.Greater(t, s.apiId, int32(0), "apiId")
+	assert.NotEqual(t, web.apiId, s.apiId, "apiId of another api type")
+}
+
+func TestNewOrphanCallTracer(t *testing.T) {
+	for _, enable := range []bool{false, true} {
+		c, _ := NewConfig(WithAppName("test"), WithAgentId("testagent"), WithHttpTraceOrphanClientCalls(enable))
+		c.OffGrpc = true
+		a, _ := NewAgent(c)
+		a.(*agent).enable = true
+
+		tracer := NewOrphanCallTracer(a, "http.Client")
+		if enable {
+			assert.Equal(t, "http.Client", tracer.(*span).rpcName, "rpcName")
+		} else {
+			assert.Nil(t, tracer, "tracer")
+		}
+	}
+
+	assert.Nil(t, NewOrphanCallTracer(nil, "http.Client"), "no agent")
+}
+
+func Test_agent_ShutdownTwice(t *testing.T) {
+	opts := []ConfigOption{
+		WithAppName("test"),
+		WithAgentId("testagent"),
+	}
+	c, _ := NewConfig(opts...)
+	c.OffGrpc = true
+	a, _ := NewAgent(c)
+	agent := a.(*agent)
+	agent.enable = true
+
+	var wg sync.WaitGroup
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			agent.Shutdown()
+		}()
+	}
+	wg.Wait()
+
+	agent.Shutdown()
+	assert.False(t, agent.Enable(), "Enable")
+}
+
+func Test_agent_ShutdownWhileEnqueueMeta(t *testing.T) {
+	c, _ := NewConfig(WithAppName("test"), WithAgentId("testagent"))
+	c.OffGrpc = true
+	a, _ := NewAgent(c)
+	agent := a.(*agent)
+	agent.enable = true
+
+	//hold the queue as tryEnqueueMeta does between its Enable check and the send
+	agent.metaChanMux.RLock()
+	assert.True(t, agent.Enable(), "enable")
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		agent.Shutdown()
+	}()
+
+	select {
+	case <-done:
+		t.Fatal("metaChan is closed while a metadata is queued")
+	case <-time.After(1500 * time.Millisecond):
+	}
+	agent.metaChan <- apiMeta{id: 1}
+	agent.metaChanMux.RUnlock()
+
+	<-done
+	assert.False(t, agent.tryEnqueueMeta(apiMeta{id: 2}), "after shutdown")
+}
+
+func Test_agent_applyCollectorConfig(t *testing.T) {
+	opts := []ConfigOption{
+		WithAppName("test"),
+		WithAgentId("testagent"),
+		WithSamplingRate(1),
+	}
+	c, _ := NewConfig(opts...)
+	a, _ := NewAgent(c)
+	agent := a.(*agent)
+
+	agent.applyCollectorConfig(&pb.PResult{Success: true, Message: "success"})
+	assert.Equal(t, 1, agent.config.Sampling.Rate, "Sampling.Rate")
+
+	agent.applyCollectorConfig(&pb.PResult{Success: true, Message: `{"Sampling": {"Rate": 10}}`})
+	assert.Equal(t, 10, agent.config.Sampling.Rate, "Sampling.Rate")
+
+	agent.applyCollectorConfig(&pb.PResult{Success: true, Message: `{"Sampling": {"Rate": 0}}`})
+	assert.Equal(t, 10, agent.config.Sampling.Rate, "Sampling.Rate")
+}
+
+type resultAgentGrpcClient struct {
+	result *pb.PResult
+}
+
+func (c *resultAgentGrpcClient) RequestAgentInfo(ctx context.Context, agentinfo *pb.PAgentInfo) (*pb.PResult, error) {
+	return c.result, nil
+}
+
+func (c *resultAgentGrpcClient) PingSession(ctx context.Context) (pb.Agent_PingSessionClient, error) {
+	return nil, nil
+}
+
+func Test_agent_resendAgentInfo_ApplyCollectorConfig(t *testing.T) {
+	c, _ := NewConfig(WithAppName("test"), WithAgentId("testagent"), WithSamplingRate(1))
+	c.OffGrpc = true
+	a, _ := NewAgent(c)
+	agent := a.(*agent)
+	agent.enable = true
+
+	result := &pb.PResult{Success: true, Message: `{"Sampling": {"Rate": 10, "NewThroughput": 5}}`}
+	agent.agentGrpc = &agentGrpc{agentClient: &resultAgentGrpcClient{result}, pingSocketId: -1, agent: agent}
+
+	done := make(chan struct{})
+	sampled := make(chan struct{})
+	go func() {
+		defer close(sampled)
+		for {
+			select {
+			case <-done:
+				return
+			default:
+				agent.traceSampler().sampleNew()
+				agent.SamplerState()
+			}
+		}
+	}()
+
+	agent.resendAgentInfo()
+	close(done)
+	<-sampled
+
+	config := agent.Config()
+	assert.Equal(t, 10, config.Sampling.Rate, "Sampling.Rate")
+	assert.Equal(t, 5, config.Sampling.NewThroughput, "Sampling.NewThroughput")
+
+	sampler, ok := agent.traceSampler().(*throughputLimitTraceSampler)
+	assert.True(t, ok, "sampler")
+	if ok {
+		assert.Equal(t, uint64(10), sampler.baseSampler.(*rateSampler).samplingRate, "sampler rate")
+	}
+
+	before := agent.traceSampler()
+	agent.resendAgentInfo()
+	assert.True(t, before == agent.traceSampler(), "same config keeps the sampler")
+}
+
+func Test_agent_KeepSlowUnsampledSpan(t *testing.T) {
+	opts := []ConfigOption{
+		WithAppName("test"),
+		WithAgentId("testagent"),
+		WithSamplingRate(100),
+		WithSamplingKeepSlowThreshold(100),
+	}
+	c, _ := NewConfig(opts...)
+	c.OffGrpc = true
+	a, _ := NewAgent(c)
+	agent := a.(*agent)
+	agent.enable = true
+
+	fast, status := agent.NewSpanTracerWithStatus("fast")
+	assert.True(t, fast.(*span).candidate, "candidate")
+	assert.Equal(t, SpanStatusCandidate, status, "status")
+	assert.Equal(t, "Candidate", status.String(), "status string")
+	fast.EndSpan()
+	assert.Equal(t, 0, len(agent.spanChan), "fast span is dropped")
+
+	slow := agent.NewSpanTracer("slow")
+	time.Sleep(110 * time.Millisecond)
+	slow.EndSpan()
+	assert.Equal(t, 1, len(agent.spanChan), "slow span is kept")
+}
+
+func Test_agent_takeGoroutineDump(t *testing.T) {
+	opts := []ConfigOption{
+		WithAppName("test"),
+		WithAgentId("testagent"),
+		WithThreadDumpMinInterval(60000),
+	}
+	c, _ := NewConfig(opts...)
+	c.OffGrpc = true
+	a, _ := NewAgent(c)
+	agent := a.(*agent)
+
+	origDump, origDumpTime := gDump, gDumpTime
+	defer func() {
+		gDump, gDumpTime = origDump, origDumpTime
+	}()
+
+	last := NewGoroutineDump()
+	gDump, gDumpTime = last, time.Now()
+	assert.Equal(t, last, agent.takeGoroutineDump(), "reused")
+
+	gDumpTime = time.Now().Add(-time.Minute)
+	dump := agent.takeGoroutineDump()
+	assert.NotEqual(t, last, dump, "new dump")
+}
+
+func Test_agent_CacheSpanApiId_LongName(t *testing.T) {
+	opts := []ConfigOption{
+		WithAppName("test"),
+		WithAgentId("testagent"),
+		WithSpanMaxNameLength(16),
+	}
+	defer saveAnnotationLimits()()
+	c, _ := NewConfig(opts...)
+	c.OffGrpc = true
+	a, _ := NewAgent(c)
+	agent := a.(*agent)
+	agent.enable = true
+
+	id := agent.CacheSpanApiId("query { users { id name } }", ApiTypeWebRequest)
+	assert.Equal(t, id, agent.CacheSpanApiId("query { users { id email } }", ApiTypeWebRequest), "same truncated key")
+	assert.True(t, agent.apiCache.Contains("query { users..._"+strconv.Itoa(ApiTypeWebRequest)), "key")
+
+	tracer := newSampledSpan(agent, "query { users { id name } }")
+	tracer.Span().SetRpcName("/graphql/query/users/id/name")
+	assert.Equal(t, "query { users...", tracer.(*span).operationName, "operation name")
+	assert.Equal(t, "/graphql/quer...", tracer.(*span).rpcName, "rpc name")
+}
+
+func Test_NewAgent_StartupTimeout(t *testing.T) {
+	opts := []ConfigOption{
+		WithAppName("test"),
+		WithAgentId("testagent"),
+		WithCollectorHost("localhost"),
+		WithCollectorAgentPort(1),
+		WithStartupTimeout(100),
+	}
+	c, _ := NewConfig(opts...)
+
+	start := time.Now()
+	a, err := NewAgent(c)
+	assert.Error(t, err, "timeout")
+	assert.Less(t, int64(time.Since(start)), int64(time.Second), "bounded")
+	assert.False(t, a.Enable(), "enable")
+	assert.True(t, a.(*agent).isShutdown(), "stop connecting")
+}
+
+type failingMetaGrpcClient struct {
+	countingMetaGrpcClient
+}
+
+func (c *failingMetaGrpcClient) RequestApiMetaData(ctx context.Context, in *pb.PApiMetaData) (*pb.PResult, error) {
+	c.call()
+	return nil, errors.New("unavailable")
+}
+
+func Test_connectGrpc_ShutdownWhileSendingApiMetadata(t *testing.T) {
+	defer func() {
+		dialAgentGrpc, dialSpanGrpc, dialStatGrpc, dialCommandGrpc = newAgentGrpc, newSpanGrpc, newStatGrpc, newCommandGrpc
+	}()
+
+	c, _ := NewConfig(WithAppName("test"), WithAgentId("testagent"))
+	c.OffGrpc = true
+	a, _ := NewAgent(c)
+	agent := a.(*agent)
+	agent.registered = make(chan struct{})
+
+	dial := func() *grpc.ClientConn {
+		conn, _ := grpc.Dial("localhost:1", grpc.WithInsecure())
+		return conn
+	}
+	meta := &failingMetaGrpcClient{}
+	dialAgentGrpc = func(ctx context.Context, a Agent) (*agentGrpc, error) {
+		return &agentGrpc{agentConn: dial(), agentClient: &resultAgentGrpcClient{&pb.PResult{Success: true}}, metadataClient: meta, pingSocketId: -1, agent: agent}, nil
+	}
+	dialSpanGrpc = func(ctx context.Context, a Agent) (*spanGrpc, error) { return &spanGrpc{spanConn: dial()}, nil }
+	dialStatGrpc = func(ctx context.Context, a Agent) (*statGrpc, error) { return &statGrpc{statConn: dial()}, nil }
+	dialCommandGrpc = func(ctx context.Context, a Agent) (*cmdGrpc, error) { return &cmdGrpc{agentConn: dial()}, nil }
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		connectGrpc(agent)
+	}()
+	<-agent.registered
+
+	start := time.Now()
+	agent.Shutdown()
+	select {
+	case <-done:
+	case <-time.After(3 * time.Second):
+		t.Fatal("connectGrpc keeps retrying after shutdown")
+	}
+	assert.Less(t, int64(time.Since(start)), int64(time.Second), "retry sleep is interrupted")
+	assert.False(t, agent.Enable(), "enable")
+	meta.mu.Lock()
+	assert.Greater(t, meta.calls, 0, "api metadata is retried")
+	meta.mu.Unlock()
+}
+
+type countingSpanStreamInvoker struct {
+	mu     sync.Mutex
+	sent   int
+	closed int
+}
+
+func (invoker *countingSpanStreamInvoker) Send(span *pb.PSpanMessage) error {
+	invoker.mu.Lock()
+	defer invoker.mu.Unlock()
+	invoker.sent++
+	return nil
+}
+
+func (invoker *countingSpanStreamInvoker) CloseAndRecv() error {
+	invoker.mu.Lock()
+	defer invoker.mu.Unlock()
+	invoker.closed++
+	return nil
+}
+
+func (invoker *countingSpanStreamInvoker) CloseSend() error {
+	return nil
+}
+
+func Test_agent_drainOnShutdown(t *testing.T) {
+	tests := []struct {
+		name      string
+		deadline  time.Time
+		flushed   int
+		undrained int
+	}{
+		{"1", time.Time{}, 3, 0},
+		{"2", time.Now().Add(-time.Second), 0, 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := []ConfigOption{
+				WithAppName("test"),
+				WithAgentId("testagent"),
+			}
+			c, _ := NewConfig(opts...)
+			c.OffGrpc = true
+			a, _ := NewAgent(c)
+			agent := a.(*agent)
+			invoker := &countingSpanStreamInvoker{}
+			agent.spanStream = &spanStream{invoker}
+			agent.drain.deadline = tt.deadline
+
+			agent.spanBuffer = append(agent.spanBuffer, newTestSpan(agent))
+			agent.spanChan <- newTestSpan(agent)
+			agent.drainOnShutdown(newTestSpan(agent))
+
+			assert.Equal(t, tt.flushed, agent.drain.flushed, "flushed")
+			assert.Equal(t, tt.undrained, agent.drain.undrained, "undrained")
+			assert.Equal(t, tt.flushed, invoker.sent, "sent")
+			assert.Equal(t, 0, len(agent.spanChan), "spanChan")
+		})
+	}
+}
+
+func Test_agent_TryEnqueueSpan_QueueFull(t *testing.T) {
+	tests := []struct {
+		name      string
+		policy    string
+		want      bool
+		keepFirst bool
+	}{
+		{"oldest", SpanQueueDropOldest, true, false},
+		{"newest", SpanQueueDropNewest, false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, _ := NewConfig(WithAppName("test"), WithAgentId("testagent"), WithSpanQueueSize(1), WithSpanQueueFullPolicy(tt.policy))
+			c.OffGrpc = true
+			a, _ := NewAgent(c)
+			agent := a.(*agent)
+			agent.enable = true
+
+			first, second := defaultSpan(), defaultSpan()
+			second.spanId = first.spanId + 1
+			assert.True(t, agent.TryEnqueueSpan(first), "first")
+			assert.Equal(t, tt.want, agent.TryEnqueueSpan(second), "second")
+
+			queued := <-agent.spanChan
+			if tt.keepFirst {
+				assert.Equal(t, first, queued, "queued")
+			} else {
+				assert.Equal(t, second, queued, "queued")
+			}
+			assert.Equal(t, 0, len(agent.spanChan), "spanChan")
+		})
+	}
+}
+
+// madeSpanGrpcClient tells when the span stream is made, which the span worker does before taking spans.
+type madeSpanGrpcClient struct {
+	stream pb.Span_SendSpanClient
+	made   chan struct{}
+}
+
+func (c *madeSpanGrpcClient) SendSpan(ctx context.Context) (pb.Span_SendSpanClient, error) {
+	select {
+	case c.made <- struct{}{}:
+	default:
+	}
+	return c.stream, nil
+}
+
+func Test_agent_Shutdown_FlushQueuedSpans(t *testing.T) {
+	c, _ := NewConfig(WithAppName("test"), WithAgentId("testagent"), WithSpanBatchSize(10), WithShutdownTimeout(5000))
+	c.OffGrpc = true
+	a, _ := NewAgent(c)
+	agent := a.(*agent)
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	stream := NewMockSpan_SendSpanClient(ctrl)
+	stream.EXPECT().Send(gomock.Any()).Return(nil).Times(3)
+	stream.EXPECT().CloseAndRecv().Return(nil, nil)
+	client := &madeSpanGrpcClient{stream, make(chan struct{}, 1)}
+	agent.spanGrpc = &spanGrpc{nil, client, nil, agent, streamBackoff{}}
+
+	agent.enable = true
+	agent.wg.Add(1)
+	go agent.sendSpanWorker()
+	<-client.made
+
+	for i := 0; i < 3; i++ {
+		assert.True(t, agent.TryEnqueueSpan(newTestSpan(agent)), "enqueue")
+	}
+	agent.Shutdown()
+
+	assert.Equal(t, 3, agent.drain.flushed, "flushed")
+	assert.Equal(t, 0, agent.drain.undrained, "undrained")
+	assert.False(t, agent.TryEnqueueSpan(newTestSpan(agent)), "enqueue after shutdown")
+}
+
+func Test_agent_sendSpanWorker_IdleFlush(t *testing.T) {
+	c, _ := NewConfig(WithAppName("test"), WithAgentId("testagent"), WithSpanBatchSize(10), WithSpanIdleFlushInterval(200))
+	c.OffGrpc = true
+	a, _ := NewAgent(c)
+	agent := a.(*agent)
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	sent := make(chan struct{}, 2)
+	stream := NewMockSpan_SendSpanClient(ctrl)
+	stream.EXPECT().Send(gomock.Any()).DoAndReturn(func(*pb.PSpanMessage) error {
+		sent <- struct{}{}
+		return nil
+	}).Times(2)
+	stream.EXPECT().CloseAndRecv().Return(nil, nil)
+	client := &madeSpanGrpcClient{stream, make(chan struct{}, 1)}
+	agent.spanGrpc = &spanGrpc{nil, client, nil, agent, streamBackoff{}}
+
+	agent.enable = true
+	agent.wg.Add(1)
+	go agent.sendSpanWorker()
+	<-client.made
+
+	start := time.Now()
+	for i := 0; i < 2; i++ {
+		assert.True(t, agent.TryEnqueueSpan(newTestSpan(agent)), "enqueue")
+	}
+	for i := 0; i < 2; i++ {
+		select {
+		case <-sent:
+		case <-time.After(5 * time.Second):
+			t.Fatal("the partial batch is not flushed on idle")
+		}
+	}
+	assert.GreaterOrEqual(t, int64(time.Since(start)), int64(200*time.Millisecond), "flushed after the idle interval")
+
+	agent.Shutdown()
+	assert.Equal(t, 0, agent.drain.flushed, "nothing left to drain")
+}
+
+// retryingSpanGrpcClient makes the span stream once, and fails to make it again afterwards.
+type retryingSpanGrpcClient struct {
+	stream   pb.Span_SendSpanClient
+	calls    int32
+	made     chan struct{}
+	retrying chan struct{}
+}
+
+func (c *retryingSpanGrpcClient) SendSpan(ctx context.Context) (pb.Span_SendSpanClient, error) {
+	if atomic.AddInt32(&c.calls, 1) == 1 {
+		close(c.made)
+		return c.stream, nil
+	}
+
+	select {
+	case c.retrying <- struct{}{}:
+	default:
+	}
+	return nil, errors.New("unavailable")
+}
+
+func Test_agent_sendSpanWorker_RetryWithoutConnMux(t *testing.T) {
+	c, _ := NewConfig(WithAppName("test"), WithAgentId("testagent"), WithSpanBatchSize(1))
+	c.OffGrpc = true
+	a, _ := NewAgent(c)
+	agent := a.(*agent)
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	stream := NewMockSpan_SendSpanClient(ctrl)
+	stream.EXPECT().Send(gomock.Any()).Return(errors.New("broken"))
+	stream.EXPECT().CloseAndRecv().Return(nil, nil)
+	client := &retryingSpanGrpcClient{stream: stream, made: make(chan struct{}), retrying: make(chan struct{}, 1)}
+	backoff := streamBackoff{ctx: agent.connCtx, maxElapsed: time.Hour, base: time.Minute, max: time.Minute}
+	agent.spanGrpc = &spanGrpc{nil, client, nil, agent, backoff}
+
+	agent.enable = true
+	agent.wg.Add(1)
+	go agent.sendSpanWorker()
+	<-client.made
+
+	assert.True(t, agent.TryEnqueueSpan(newTestSpan(agent)), "enqueue")
+	<-client.retrying
+
+	locked := make(chan struct{})
+	go func() {
+		agent.connMux.Lock()
+		agent.connMux.Unlock()
+		close(locked)
+	}()
+	select {
+	case <-locked:
+	case <-time.After(5 * time.Second):
+		t.Fatal("connMux is held while the span stream is retried")
+	}
+
+	shutdown := make(chan struct{})
+	go func() {
+		agent.Shutdown()
+		close(shutdown)
+	}()
+	select {
+	case <-shutdown:
+	case <-time.After(10 * time.Second):
+		t.Fatal("shutdown is blocked by the retry of the span stream")
+	}
+}
+
+// countingMetaGrpcClient counts the metadata RPCs and the most of them in flight at once.
+type countingMetaGrpcClient struct {
+	mu       sync.Mutex
+	calls    int
+	inflight int
+	maxIn    int
+}
+
+func (c *countingMetaGrpcClient) call() (*pb.PResult, error) {
+	c.mu.Lock()
+	c.calls++
+	c.inflight++
+	if c.maxIn < c.inflight {
+		c.maxIn = c.inflight
+	}
+	c.mu.Unlock()
+
+	time.Sleep(10 * time.Millisecond)
+
+	c.mu.Lock()
+	c.inflight--
+	c.mu.Unlock()
+	return &pb.PResult{Success: true}, nil
+}
+
+func (c *countingMetaGrpcClient) RequestApiMetaData(ctx context.Context, in *pb.PApiMetaData) (*pb.PResult, error) {
+	return c.call()
+}
+
+func (c *countingMetaGrpcClient) RequestSqlMetaData(ctx context.Context, in *pb.PSqlMetaData) (*pb.PResult, error) {
+	return c.call()
+}
+
+func (c *countingMetaGrpcClient) RequestStringMetaData(ctx context.Context, in *pb.PStringMetaData) (*pb.PResult, error) {
+	return c.call()
+}
+
+func Test_agent_sendMetaBatches(t *testing.T) {
+	c, _ := NewConfig(WithAppName("test"), WithAgentId("testagent"))
+	c.OffGrpc = true
+	a, _ := NewAgent(c)
+	agent := a.(*agent)
+
+	agent.setEnable(true)
+	client := &countingMetaGrpcClient{}
+	agent.setGrpc(grpcConns{agent: &agentGrpc{metadataClient: client, pingSocketId: -1, agent: agent}})
+	agent.metaChan = make(chan interface{}, 20)
+	for i := 0; i < 5; i++ {
+		agent.metaChan <- apiMeta{id: int32(i)}
+		agent.metaChan <- sqlMeta{id: int32(i)}
+	}
+	close(agent.metaChan)
+
+	start := time.Now()
+	agent.sendMetaBatches(50*time.Millisecond, 10)
+	elapsed := time.Since(start)
+
+	//each metadata is still a unary RPC, but the RPCs of the batch overlap up to the pipeline depth
+	assert.Equal(t, 10, client.calls, "RPCs")
+	assert.Equal(t, metaPipelineDepth, client.maxIn, "max in flight")
+	assert.Less(t, int64(elapsed), int64(10*10*time.Millisecond), "pipelined")
+}
+
+func Test_agent_ReconnectCollector_WhileSending(t *testing.T) {
+	defer func() {
+		dialAgentGrpc, dialSpanGrpc, dialStatGrpc, dialCommandGrpc = newAgentGrpc, newSpanGrpc, newStatGrpc, newCommandGrpc
+	}()
+
+	c, _ := NewConfig(WithAppName("test"), WithAgentId("testagent"), WithSpanBatchSize(1))
+	c.OffGrpc = true
+	a, _ := NewAgent(c)
+	agent := a.(*agent)
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	dial := func() *grpc.ClientConn {
+		conn, _ := grpc.Dial("localhost:1", grpc.WithInsecure())
+		return conn
+	}
+	newConns := func() grpcConns {
+		stream := NewMockSpan_SendSpanClient(ctrl)
+		stream.EXPECT().Send(gomock.Any()).Return(nil).AnyTimes()
+		stream.EXPECT().CloseAndRecv().Return(nil, nil).AnyTimes()
+		return grpcConns{
+			agent: &agentGrpc{agentConn: dial(), agentClient: &resultAgentGrpcClient{&pb.PResult{Success: true}}, metadataClient: &countingMetaGrpcClient{}, pingSocketId: -1, agent: agent},
+			span:  &spanGrpc{dial(), &mockSpanGrpcClient{NewMockSpanClient(ctrl), stream}, nil, agent, streamBackoff{}},
+			stat:  &statGrpc{statConn: dial()},
+			cmd:   &cmdGrpc{agentConn: dial()},
+		}
+	}
+
+	var next grpcConns
+	dialAgentGrpc = func(ctx context.Context, agent Agent) (*agentGrpc, error) {
+		next = newConns()
+		return next.agent, nil
+	}
+	dialSpanGrpc = func(ctx context.Context, agent Agent) (*spanGrpc, error) { return next.span, nil }
+	dialStatGrpc = func(ctx context.Context, agent Agent) (*statGrpc, error) { return next.stat, nil }
+	dialCommandGrpc = func(ctx context.Context, agent Agent) (*cmdGrpc, error) { return next.cmd, nil }
+
+	conns := newConns()
+	client := &madeSpanGrpcClient{conns.span.spanClient.(*mockSpanGrpcClient).stream, make(chan struct{}, 1)}
+	conns.span.spanClient = client
+	agent.setGrpc(conns)
+	agent.enable = true
+	agent.wg.Add(1)
+	go agent.sendSpanWorker()
+	<-client.made
+
+	done := make(chan struct{})
+	sent := make(chan struct{})
+	go func() {
+		defer close(sent)
+		for {
+			select {
+			case <-done:
+				return
+			default:
+				agent.TryEnqueueSpan(newTestSpan(agent))
+				agent.health()
+				time.Sleep(100 * time.Microsecond)
+			}
+		}
+	}()
+
+	for i := 0; i < 5; i++ {
+		assert.NoError(t, agent.ReconnectCollector("localhost", 9991+i, 9993+i, 9992+i), "reconnect")
+	}
+	close(done)
+	<-sent
+
+	assert.Equal(t, 9995, agent.Config().Collector.AgentPort, "agent port")
+	assert.Equal(t, next.span, agent.grpc().span, "span client")
+	agent.Shutdown()
+}
+
+func Test_agent_OnEnableChange(t *testing.T) {
+	c, _ := NewConfig(WithAppName("test"), WithAgentId("testagent"))
+	c.OffGrpc = true
+	a, _ := NewAgent(c)
+	agent := a.(*agent)
+
+	var changes []bool
+	agent.OnEnableChange(func(enabled bool) { changes = append(changes, enabled) })
+	agent.OnEnableChange(nil)
+
+	agent.setEnable(true)
+	agent.setEnable(true)
+	agent.setEnable(false)
+
+	assert.Equal(t, []bool{true, false}, changes, "changes")
+	assert.False(t, agent.Enable(), "enable")
+}
+
+func newTestSpan(agent Agent) *span {
+	s := defaultSpan()
+	s.agent = agent
+	return s
+}
@@ -1,21 +1,152 @@
 package pinpoint
 
 import (
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+	"unicode/utf8"
+
 	"github.com/golang/protobuf/ptypes/wrappers"
 	pb "github.com/pinpoint-apm/pinpoint-go-agent/protobuf"
 )
 
 const (
+	AnnotationApi            = 12
 	AnnotationHttpUrl        = 40
+	AnnotationHttpParam      = 41
 	AnnotationHttpStatusCode = 46
+	AnnotationSqlId          = 20
+	AnnotationLabel          = 910
+	AnnotationAttribute      = 911
+	AnnotationTruncated      = 912
+	AnnotationMessageLag     = 913
+
+	AnnotationMaxDurationExceeded = 914
+	AnnotationCacheResult         = 915
+	AnnotationSqlRowsAffected     = 916
+	AnnotationContextError        = 917
+	AnnotationLinkedTransaction   = 918
+	AnnotationElapsedMicros       = 919
+	AnnotationErrorStack          = 920
+	AnnotationSampledOut          = 921
+)
+
+const (
+	ContextErrorTimeout  = "timeout"
+	ContextErrorCanceled = "canceled"
+)
+
+const (
+	CacheHit  = "hit"
+	CacheMiss = "miss"
 )
 
+// RecordCacheResult records whether the cache operation of the current span event found the key.
+func RecordCacheResult(tracer Tracer, hit bool) {
+	result := CacheMiss
+	if hit {
+		result = CacheHit
+	}
+	tracer.SpanEvent().Annotations().AppendString(AnnotationCacheResult, result)
+}
+
+// RecordMessageLag records the time in milliseconds from when a message was produced until it is consumed,
+// on the span of the consumer. Nothing is recorded if the produce time is unknown.
+func RecordMessageLag(tracer Tracer, produced time.Time, consumed time.Time) {
+	if produced.IsZero() {
+		return
+	}
+	tracer.Span().Annotations().AppendInt(AnnotationMessageLag, elapsedMilliseconds(consumed.Sub(produced)))
+}
+
+var annotationLimits struct {
+	maxPerSpan     int
+	maxKeyLength   int
+	maxValueLength int
+}
+
+func setAnnotationLimits(config *Config) {
+	annotationLimits.maxPerSpan = config.Annotation.MaxPerSpan
+	annotationLimits.maxKeyLength = config.Annotation.MaxKeyLength
+	annotationLimits.maxValueLength = config.Annotation.MaxValueLength
+	maxNameLength = config.Span.MaxNameLength
+}
+
+// truncateString cuts s to at most max bytes on a rune boundary,
+// as a split UTF-8 sequence makes the span fail to be marshaled.
+func truncateString(s string, max int) string {
+	if max > 0 && len(s) > max {
+		return s[:runeBoundary(s, max)]
+	}
+	return s
+}
+
+// runeBoundary returns the largest index not greater than n at which s can be cut without splitting a rune.
+func runeBoundary(s string, n int) int {
+	for n > 0 && n < len(s) && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return n
+}
+
+var maxNameLength int
+
+const truncatedNameMarker = "..."
+
+// truncateName cuts operation, rpc and api names to the max length, ending with a marker.
+func truncateName(name string) string {
+	if maxNameLength <= 0 || len(name) <= maxNameLength {
+		return name
+	}
+	if maxNameLength <= len(truncatedNameMarker) {
+		return name[:runeBoundary(name, maxNameLength)]
+	}
+	return name[:runeBoundary(name, maxNameLength-len(truncatedNameMarker))] + truncatedNameMarker
+}
+
+func truncateKey(s string) string {
+	return truncateString(s, annotationLimits.maxKeyLength)
+}
+
+func truncateValue(s string) string {
+	return truncateString(s, annotationLimits.maxValueLength)
+}
+
 type annotation struct {
-	list []*pb.PAnnotation
+	list      []*pb.PAnnotation
+	truncated bool
+
+	//the lock of the span the annotations are recorded on, if any
+	mux *sync.Mutex
+}
+
+func (a *annotation) add(pa *pb.PAnnotation) {
+	if a.mux != nil {
+		a.mux.Lock()
+		defer a.mux.Unlock()
+	}
+
+	if annotationLimits.maxPerSpan > 0 && len(a.list) >= annotationLimits.maxPerSpan {
+		if !a.truncated {
+			a.truncated = true
+			a.list = append(a.list, &pb.PAnnotation{
+				Key: AnnotationTruncated,
+				Value: &pb.PAnnotationValue{
+					Field: &pb.PAnnotationValue_StringValue{
+						StringValue: "annotations truncated",
+					},
+				},
+			})
+		}
+		return
+	}
+
+	a.list = append(a.list, pa)
 }
 
 func (a *annotation) AppendInt(key int32, i int32) {
-	a.list = append(a.list, &pb.PAnnotation{
+	a.add(&pb.PAnnotation{
 		Key: key,
 		Value: &pb.PAnnotationValue{
 			Field: &pb.PAnnotationValue_IntValue{
@@ -25,25 +156,36 @@ func (a *annotation) AppendInt(key int32, i int32) {
 	})
 }
 
+func (a *annotation) appendLong(key int32, l int64) {
+	a.add(&pb.PAnnotation{
+		Key: key,
+		Value: &pb.PAnnotationValue{
+			Field: &pb.PAnnotationValue_LongValue{
+				LongValue: l,
+			},
+		},
+	})
+}
+
 func (a *annotation) AppendString(key int32, s string) {
-	a.list = append(a.list, &pb.PAnnotation{
+	a.add(&pb.PAnnotation{
 		Key: key,
 		Value: &pb.PAnnotationValue{
 			Field: &pb.PAnnotationValue_StringValue{
-				StringValue: s,
+				StringValue: truncateValue(s),
 			},
 		},
 	})
 }
 
 func (a *annotation) AppendStringString(key int32, s1 string, s2 string) {
-	a.list = append(a.list, &pb.PAnnotation{
+	a.add(&pb.PAnnotation{
 		Key: key,
 		Value: &pb.PAnnotationValue{
 			Field: &pb.PAnnotationValue_StringStringValue{
 				StringStringValue: &pb.PStringStringValue{
-					StringValue1: &wrappers.StringValue{Value: s1},
-					StringValue2: &wrappers.StringValue{Value: s2},
+					StringValue1: &wrappers.StringValue{Value: truncateKey(s1)},
+					StringValue2: &wrappers.StringValue{Value: truncateValue(s2)},
 				},
 			},
 		},
@@ -51,14 +193,14 @@ func (a *annotation) AppendStringString(key int32, s1 string, s2 string) {
 }
 
 func (a *annotation) AppendIntStringString(key int32, i int32, s1 string, s2 string) {
-	a.list = append(a.list, &pb.PAnnotation{
+	a.add(&pb.PAnnotation{
 		Key: key,
 		Value: &pb.PAnnotationValue{
 			Field: &pb.PAnnotationValue_IntStringStringValue{
 				IntStringStringValue: &pb.PIntStringStringValue{
 					IntValue:     i,
-					StringValue1: &wrappers.StringValue{Value: s1},
-					StringValue2: &wrappers.StringValue{Value: s2},
+					StringValue1: &wrappers.StringValue{Value: truncateValue(s1)},
+					StringValue2: &wrappers.StringValue{Value: truncateValue(s2)},
 				},
 			},
 		},
@@ -66,7 +208,7 @@ func (a *annotation) AppendIntStringString(key int32, i int32, s1 string, s2 str
 }
 
 func (a *annotation) AppendLongIntIntByteByteString(key int32, l int64, i1 int32, i2 int32, b1 int32, b2 int32, s string) {
-	a.list = append(a.list, &pb.PAnnotation{
+	a.add(&pb.PAnnotation{
 		Key: key,
 		Value: &pb.PAnnotationValue{
 			Field: &pb.PAnnotationValue_LongIntIntByteByteStringValue{
@@ -76,9 +218,48 @@ func (a *annotation) AppendLongIntIntByteByteString(key int32, l int64, i1 int32
 					IntValue2:   i2,
 					ByteValue1:  b1,
 					ByteValue2:  b2,
-					StringValue: &wrappers.StringValue{Value: s},
+					StringValue: &wrappers.StringValue{Value: truncateValue(s)},
 				},
 			},
 		},
 	})
 }
+
+// List returns a copy of the annotations recorded so far.
+func (a *annotation) List() []*pb.PAnnotation {
+	l := make([]*pb.PAnnotation, len(a.list))
+	copy(l, a.list)
+	return l
+}
+
+// appendAttribute records a key-value attribute of the application with the AnnotationAttribute annotation.
+// The key-value annotation of the collector holds strings only, so the value is formatted by its type.
+func (a *annotation) appendAttribute(key string, value interface{}) {
+	var s string
+	switch v := value.(type) {
+	case string:
+		s = v
+	case bool:
+		s = strconv.FormatBool(v)
+	case int:
+		s = strconv.Itoa(v)
+	case int32:
+		s = strconv.FormatInt(int64(v), 10)
+	case int64:
+		s = strconv.FormatInt(v, 10)
+	case uint:
+		s = strconv.FormatUint(uint64(v), 10)
+	case uint32:
+		s = strconv.FormatUint(uint64(v), 10)
+	case uint64:
+		s = strconv.FormatUint(v, 10)
+	case float32:
+		s = strconv.FormatFloat(float64(v), 'g', -1, 32)
+	case float64:
+		s = strconv.FormatFloat(v, 'g', -1, 64)
+	default:
+		s = fmt.Sprint(v)
+	}
+
+	a.AppendStringString(AnnotationAttribute, key, s)
+}
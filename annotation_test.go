@@ -0,0 +1,180 @@
+package pinpoint
+
+import (
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_annotation_List(t *testing.T) {
+	s := defaultSpan()
+	s.agent = newMockAgent()
+	s.NewSpanEvent("t1")
+
+	s.Annotations().AppendInt(AnnotationHttpStatusCode, 500)
+	s.SpanEvent().Annotations().AppendString(AnnotationHttpUrl, "http://localhost/")
+
+	l := s.Annotations().List()
+	assert.Equal(t, 1, len(l), "len")
+	assert.Equal(t, int32(AnnotationHttpStatusCode), l[0].GetKey(), "key")
+	assert.Equal(t, int32(500), l[0].GetValue().GetIntValue(), "value")
+
+	l = s.SpanEvent().Annotations().List()
+	assert.Equal(t, 1, len(l), "len")
+	assert.Equal(t, "http://localhost/", l[0].GetValue().GetStringValue(), "value")
+}
+
+func Test_annotation_Limits(t *testing.T) {
+	config := defaultConfig()
+	config.Annotation.MaxPerSpan = 2
+	config.Annotation.MaxKeyLength = 3
+	config.Annotation.MaxValueLength = 5
+	defer saveAnnotationLimits()()
+	setAnnotationLimits(config)
+
+	var a annotation
+	a.AppendStringString(AnnotationLabel, "region", "ap-northeast-2")
+	a.AppendInt(AnnotationHttpStatusCode, 200)
+	a.AppendString(AnnotationHttpUrl, "http://localhost/")
+	a.AppendString(AnnotationHttpUrl, "http://localhost/")
+
+	l := a.List()
+	assert.Equal(t, 3, len(l), "len")
+	assert.Equal(t, "reg", l[0].GetValue().GetStringStringValue().GetStringValue1().GetValue(), "key")
+	assert.Equal(t, "ap-no", l[0].GetValue().GetStringStringValue().GetStringValue2().GetValue(), "value")
+	assert.Equal(t, int32(AnnotationTruncated), l[2].GetKey(), "truncated")
+}
+
+func Test_truncateString(t *testing.T) {
+	tests := []struct {
+		name string
+		arg  string
+		max  int
+		want string
+	}{
+		{"no limit", "ap-northeast-2", 0, "ap-northeast-2"},
+		{"short", "ap-northeast-2", 20, "ap-northeast-2"},
+		{"ascii", "ap-northeast-2", 5, "ap-no"},
+		{"rune boundary", "서울리전", 6, "서울"},
+		{"inside rune", "서울리전", 5, "서"},
+		{"inside first rune", "서울리전", 2, ""},
+		{"mixed", "a서울", 3, "a"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := truncateString(tt.arg, tt.max)
+			assert.Equal(t, tt.want, got, "truncateString")
+			assert.True(t, utf8.ValidString(got), "valid UTF-8")
+		})
+	}
+}
+
+func TestRecordMessageLag(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		name     string
+		produced time.Time
+		want     []int32
+	}{
+		{"1", now.Add(-1500 * time.Millisecond), []int32{1500}},
+		{"2", now.Add(time.Second), []int32{0}},
+		{"3", time.Time{}, []int32{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := defaultSpan()
+			RecordMessageLag(s, tt.produced, now)
+
+			got := []int32{}
+			for _, a := range s.Annotations().List() {
+				assert.Equal(t, int32(AnnotationMessageLag), a.GetKey(), "key")
+				got = append(got, a.GetValue().GetIntValue())
+			}
+			assert.Equal(t, tt.want, got, "lag")
+		})
+	}
+}
+
+func TestRecordCacheResult(t *testing.T) {
+	tests := []struct {
+		name string
+		hit  bool
+		want string
+	}{
+		{"1", true, CacheHit},
+		{"2", false, CacheMiss},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := defaultSpan()
+			s.NewSpanEvent("redis: GET")
+			RecordCacheResult(s, tt.hit)
+
+			l := s.SpanEvent().Annotations().List()
+			assert.Equal(t, int32(AnnotationCacheResult), l[len(l)-1].GetKey(), "key")
+			assert.Equal(t, tt.want, l[len(l)-1].GetValue().GetStringValue(), "result")
+		})
+	}
+}
+
+func Test_annotation_appendAttribute(t *testing.T) {
+	tests := []struct {
+		name  string
+		value interface{}
+		want  string
+	}{
+		{"string", "tenant-a", "tenant-a"},
+		{"int", 42, "42"},
+		{"int64", int64(1) << 40, "1099511627776"},
+		{"uint", uint(7), "7"},
+		{"float", 1.5, "1.5"},
+		{"bool", true, "true"},
+		{"other", []int{1, 2}, "[1 2]"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var a annotation
+			a.appendAttribute("key", tt.value)
+
+			v := a.List()[0]
+			assert.Equal(t, int32(AnnotationAttribute), v.GetKey(), "key")
+			assert.Equal(t, "key", v.GetValue().GetStringStringValue().GetStringValue1().GetValue(), "attribute key")
+			assert.Equal(t, tt.want, v.GetValue().GetStringStringValue().GetStringValue2().GetValue(), "attribute value")
+		})
+	}
+}
+
+// saveAnnotationLimits returns a function which restores the limits changed by a test.
+func saveAnnotationLimits() func() {
+	limits, nameLength := annotationLimits, maxNameLength
+	return func() { annotationLimits, maxNameLength = limits, nameLength }
+}
+
+func Test_truncateName(t *testing.T) {
+	defer saveAnnotationLimits()()
+
+	tests := []struct {
+		name string
+		max  int
+		arg  string
+		want string
+	}{
+		{"1", 0, "query { users { id } }", "query { users { id } }"},
+		{"2", 30, "query { users { id } }", "query { users { id } }"},
+		{"3", 10, "query { users { id } }", "query {..."},
+		{"4", 2, "query { users { id } }", "qu"},
+		{"5", 9, "주문 조회 API", "주문..."},
+		{"6", 11, "주문 조회 API", "주문 ..."},
+		{"7", 2, "주문 조회 API", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			maxNameLength = tt.max
+			got := truncateName(tt.arg)
+			assert.Equal(t, tt.want, got, "truncateName")
+			assert.True(t, utf8.ValidString(got), "valid UTF-8")
+		})
+	}
+}
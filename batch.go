@@ -0,0 +1,49 @@
+package pinpoint
+
+import "time"
+
+// batchSizer adjusts the number of items sent at once to the collector.
+// The size is halved when a send is slower than the threshold and grows by one when it is not,
+// within the range of 1 to max. If it is not adaptive, the size is fixed.
+type batchSizer struct {
+	size     int
+	max      int
+	slow     time.Duration
+	adaptive bool
+}
+
+func newBatchSizer(size int, max int, slow time.Duration, adaptive bool) *batchSizer {
+	if size < 1 {
+		size = 1
+	}
+	if max < size {
+		max = size
+	}
+
+	return &batchSizer{
+		size:     size,
+		max:      max,
+		slow:     slow,
+		adaptive: adaptive,
+	}
+}
+
+func (b *batchSizer) current() int {
+	return b.size
+}
+
+func (b *batchSizer) adjust(elapsed time.Duration) {
+	if !b.adaptive || b.slow <= 0 {
+		return
+	}
+
+	if elapsed > b.slow {
+		b.size /= 2
+		if b.size < 1 {
+			b.size = 1
+		}
+		log("agent").Debugf("slow send (%v), batch size decreased to %d", elapsed, b.size)
+	} else if b.size < b.max {
+		b.size++
+	}
+}
@@ -0,0 +1,105 @@
+package pinpoint
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+
+	pb "github.com/pinpoint-apm/pinpoint-go-agent/protobuf"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_batchSizer_adjust(t *testing.T) {
+	//a mock collector which takes the given latency per item
+	send := func(n int, latency time.Duration) time.Duration {
+		return time.Duration(n) * latency
+	}
+
+	b := newBatchSizer(10, 40, 100*time.Millisecond, true)
+
+	for i := 0; i < 50; i++ {
+		b.adjust(send(b.current(), time.Millisecond))
+	}
+	assert.Equal(t, 40, b.current(), "grown to max")
+
+	b.adjust(send(b.current(), 5*time.Millisecond))
+	assert.Equal(t, 20, b.current(), "halved")
+
+	for i := 0; i < 10; i++ {
+		b.adjust(send(b.current(), 50*time.Millisecond))
+	}
+	assert.LessOrEqual(t, b.current(), 3, "kept around the threshold")
+
+	for i := 0; i < 10; i++ {
+		b.adjust(send(b.current(), time.Second))
+	}
+	assert.Equal(t, 1, b.current(), "min")
+}
+
+func Test_batchSizer_fixed(t *testing.T) {
+	b := newBatchSizer(6, 12, 100*time.Millisecond, false)
+	b.adjust(time.Second)
+	assert.Equal(t, 6, b.current(), "size")
+
+	b = newBatchSizer(0, 0, 0, true)
+	b.adjust(time.Second)
+	assert.Equal(t, 1, b.current(), "size")
+	assert.Equal(t, 1, b.max, "max")
+}
+
+// slowSpanStreamInvoker is a mock span stream which takes the latency per span while it is set.
+type slowSpanStreamInvoker struct {
+	latency int64
+}
+
+func (invoker *slowSpanStreamInvoker) Send(span *pb.PSpanMessage) error {
+	time.Sleep(time.Duration(atomic.LoadInt64(&invoker.latency)))
+	return nil
+}
+
+func (invoker *slowSpanStreamInvoker) CloseAndRecv() error {
+	return nil
+}
+
+func (invoker *slowSpanStreamInvoker) CloseSend() error {
+	return nil
+}
+
+func Test_batchSizer_SlowStream(t *testing.T) {
+	invoker := &slowSpanStreamInvoker{}
+	stream := &spanStream{invoker}
+	b := newBatchSizer(2, 8, 20*time.Millisecond, true)
+	span := newTestSpan(newMockAgent())
+
+	//sends a batch of the current size and adjusts the size by the send latency, like the span worker
+	sendBatch := func() {
+		start := time.Now()
+		for i := 0; i < b.current(); i++ {
+			assert.NoError(t, stream.sendSpan(span), "sendSpan")
+		}
+		b.adjust(time.Since(start))
+	}
+
+	for i := 0; i < 10; i++ {
+		sendBatch()
+	}
+	assert.Equal(t, 8, b.current(), "grown on a fast stream")
+
+	atomic.StoreInt64(&invoker.latency, int64(10*time.Millisecond))
+	sendBatch()
+	assert.Equal(t, 4, b.current(), "halved on a slow stream")
+	sendBatch()
+	assert.Equal(t, 2, b.current(), "halved on a slow stream")
+	for i := 0; i < 4; i++ {
+		//a batch of 2 spans is around the slow threshold, so the size settles at 1 or 2
+		sendBatch()
+		assert.True(t, b.current() <= 2, "kept small on a slow stream")
+	}
+
+	slowSize := b.current()
+	atomic.StoreInt64(&invoker.latency, 0)
+	for i := 0; i < 3; i++ {
+		sendBatch()
+	}
+	assert.Equal(t, slowSize+3, b.current(), "grown again on a fast stream")
+}
@@ -0,0 +1,107 @@
+package pinpoint
+
+import (
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	SpanKindInternal = iota
+	SpanKindServer
+	SpanKindClient
+	SpanKindProducer
+	SpanKindConsumer
+)
+
+// BridgeSpan is a finished span of another tracing library (e.g. OpenTelemetry)
+// that is translated into a pinpoint span by ExportBridgeSpan.
+type BridgeSpan struct {
+	TraceId      string // hex encoded
+	SpanId       string // hex encoded
+	ParentSpanId string // hex encoded, empty for a root span
+	Name         string
+	Kind         int
+	StartTime    time.Time
+	EndTime      time.Time
+	RemoteAddr   string
+	EndPoint     string
+	Destination  string
+	Attributes   map[string]string
+	Error        error
+}
+
+// ExportBridgeSpan translates the given span and enqueues it to the span stream of the agent.
+// Server and consumer spans become a pinpoint span, and the other kinds become a pinpoint span
+// holding a single span event of the corresponding service type.
+// The transaction id is mapped from the trace id in the same way as the W3C trace ids,
+// so the spans of a trace are joined into one transaction whichever agent exports them.
+func ExportBridgeSpan(agent Agent, bs *BridgeSpan) bool {
+	if !agent.Enable() {
+		return false
+	}
+
+	span := defaultSpan()
+	span.agent = agent
+	span.operationName = bs.Name
+	span.txId = bridgeTransactionId(agent, bs.TraceId)
+	span.spanId = hexToInt63(bs.SpanId, generateSpanId())
+	span.parentSpanId = hexToInt63(bs.ParentSpanId, -1)
+	span.serviceType = agent.Config().ApplicationType
+	span.rpcName = bs.Name
+	span.remoteAddr = bs.RemoteAddr
+	span.endPoint = bs.EndPoint
+	span.startTime = bs.StartTime
+	span.duration = bs.EndTime.Sub(bs.StartTime)
+
+	var annotations *annotation
+	if bs.Kind == SpanKindServer || bs.Kind == SpanKindConsumer {
+		annotations = &span.annotations
+		if bs.Error != nil {
+			span.err = 1
+		}
+	} else {
+		span.NewSpanEvent(bs.Name)
+		se := span.stack.Front().Value.(*spanEvent)
+		se.serviceType = bridgeServiceType(bs)
+		se.destinationId = bs.Destination
+		se.endPoint = bs.EndPoint
+		se.FixDuration(bs.StartTime, bs.EndTime)
+		se.SetError(bs.Error)
+		span.EndSpanEvent()
+		annotations = &se.annotations
+	}
+
+	for k, v := range bs.Attributes {
+		switch k {
+		case "http.url":
+			annotations.AppendString(AnnotationHttpUrl, v)
+		case "http.status_code":
+			code, _ := strconv.Atoi(v)
+			annotations.AppendInt(AnnotationHttpStatusCode, int32(code))
+		default:
+			annotations.AppendStringString(AnnotationAttribute, k, v)
+		}
+	}
+
+	return agent.TryEnqueueSpan(span)
+}
+
+func bridgeServiceType(bs *BridgeSpan) int32 {
+	if bs.Kind == SpanKindClient {
+		if _, ok := bs.Attributes["http.url"]; ok {
+			return ServiceTypeGoHttpClient
+		}
+	}
+	return ServiceTypeGoFunction
+}
+
+// bridgeTransactionId maps a trace id to a transaction id like w3cTransactionId.
+// A trace id which is not 32 hex digits can't be mapped, so a new transaction id is generated for it.
+func bridgeTransactionId(agent Agent, traceId string) TransactionId {
+	traceId = strings.ToLower(traceId)
+	if !isLowerHex(traceId, 32) {
+		return agent.GenerateTransactionId()
+	}
+	return w3cTransactionId(traceId)
+}
@@ -0,0 +1,38 @@
+package pinpoint
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_ExportBridgeSpan_TransactionId(t *testing.T) {
+	c, _ := NewConfig(WithAppName("test"), WithAgentId("testagent"))
+	c.OffGrpc = true
+	a, _ := NewAgent(c)
+	agent := a.(*agent)
+	agent.enable = true
+
+	traceId := "4BF92F3577B34DA6A3CE929D0E0E4736"
+	start := time.Now()
+	assert.True(t, ExportBridgeSpan(agent, &BridgeSpan{TraceId: traceId, SpanId: "00f067aa0ba902b7", Kind: SpanKindServer, StartTime: start, EndTime: start}), "server")
+	assert.True(t, ExportBridgeSpan(agent, &BridgeSpan{TraceId: traceId, SpanId: "00000000000000ff", ParentSpanId: "00f067aa0ba902b7", Kind: SpanKindClient, StartTime: start, EndTime: start}), "client")
+
+	server, client := <-agent.spanChan, <-agent.spanChan
+	want := TransactionId{W3CAgentId, 0x4bf92f3577b34da6, 0x23ce929d0e0e4736}
+	assert.Equal(t, want, server.txId, "server txId")
+	assert.Equal(t, want, client.txId, "client txId")
+	assert.Equal(t, int64(0x00f067aa0ba902b7), server.spanId, "server spanId")
+	assert.Equal(t, server.spanId, client.parentSpanId, "client parentSpanId")
+}
+
+func Test_bridgeTransactionId_Invalid(t *testing.T) {
+	c, _ := NewConfig(WithAppName("test"), WithAgentId("testagent"))
+	c.OffGrpc = true
+	a, _ := NewAgent(c)
+
+	txId := bridgeTransactionId(a, "not a trace id")
+	assert.Equal(t, "testagent", txId.AgentId, "agentId")
+	assert.Equal(t, a.StartTime(), txId.StartTime, "startTime")
+}
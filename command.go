@@ -1,74 +1,62 @@
 package pinpoint
 
 import (
+	"bytes"
 	pb "github.com/pinpoint-apm/pinpoint-go-agent/protobuf"
-	"os"
-	"path/filepath"
 	"runtime/pprof"
 	"time"
 )
 
 var gDump *GoroutineDump
+var gDumpTime time.Time
 
 func (agent *agent) runCommandService() {
 	log("cmd").Info("command service goroutine start")
-	defer agent.wg.Done()
+	defer agent.cmdWg.Done()
 
-	cmdStream := agent.cmdGrpc.newCommandStreamWithRetry()
+	cmdStream := agent.grpc().cmd.newCommandStreamWithRetry()
 
 	for true {
-		if !agent.enable {
+		if !agent.Enable() || agent.isShutdown() {
 			break
 		}
 
 		err := cmdStream.sendCommandMessage()
 		if err != nil {
 			log("cmd").Errorf("fail to sendCommandMessage(): %v", err)
+			agent.streams().recordError(streamCommand, err)
 			cmdStream.close()
-			cmdStream = agent.cmdGrpc.newCommandStreamWithRetry()
+			cmdStream = agent.grpc().cmd.newCommandStreamWithRetry()
 			continue
 		}
 
-		for true {
-			err = cmdStream.recvCommandRequest()
-			if err != nil {
-				log("cmd").Errorf("fail to recvCommandRequest(): %v", err)
-				break
-			}
-
-			cmdReq := cmdStream.cmdReq
-			reqId := cmdReq.GetRequestId()
-			log("cmd").Debugf("command service request: %v", cmdReq)
-
-			switch cmdReq.Command.(type) {
-			case *pb.PCmdRequest_CommandEcho:
-				msg := cmdReq.GetCommandEcho().GetMessage()
-				agent.cmdGrpc.sendEcho(reqId, msg)
-				break
-			case *pb.PCmdRequest_CommandActiveThreadCount:
-				atcStream := agent.cmdGrpc.newActiveThreadCountStream(reqId)
-				go sendActiveThreadCount(atcStream)
-				break
-			case *pb.PCmdRequest_CommandActiveThreadDump:
-				limit := cmdReq.GetCommandActiveThreadDump().GetLimit()
-				threadName := cmdReq.GetCommandActiveThreadDump().GetThreadName()
-				localId := cmdReq.GetCommandActiveThreadDump().GetLocalTraceId()
-				agent.cmdGrpc.sendActiveThreadDump(reqId, limit, threadName, localId, gDump)
-				break
-			case *pb.PCmdRequest_CommandActiveThreadLightDump:
-				limit := cmdReq.GetCommandActiveThreadLightDump().GetLimit()
-				gDump = dumpGoroutine()
-				agent.cmdGrpc.sendActiveThreadLightDump(reqId, limit, gDump)
-				break
-			case nil:
-				// The field is not set.
-			default:
+		//the requests are received on another goroutine, so that this goroutine, the only one sending on the stream,
+		//closes it on shutdown; grpc doesn't allow CloseSend to be called concurrently with Send
+		reqs := cmdStream.recvCommandRequests()
+		closing := agent.connCtx.Done()
+	recv:
+		for {
+			select {
+			case req := <-reqs:
+				if req.err != nil {
+					err = req.err
+					if !agent.isShutdown() {
+						log("cmd").Errorf("fail to recvCommandRequest(): %v", err)
+						agent.streams().recordError(streamCommand, err)
+					}
+					break recv
+				}
+				agent.handleCommandRequest(req.cmdReq)
+			case <-closing:
+				//the collector ends the stream after the requests in flight are answered
+				cmdStream.closeSend()
+				closing = nil
 			}
 		}
 
-		if err != nil {
+		if !agent.isShutdown() {
 			cmdStream.close()
-			cmdStream = agent.cmdGrpc.newCommandStreamWithRetry()
+			cmdStream = agent.grpc().cmd.newCommandStreamWithRetry()
 		}
 	}
 
@@ -76,34 +64,97 @@ func (agent *agent) runCommandService() {
 	log("cmd").Info("command service goroutine finish")
 }
 
-func sendActiveThreadCount(s *activeThreadCountStream) {
-	for true {
+func (agent *agent) handleCommandRequest(cmdReq *pb.PCmdRequest) {
+	reqId := cmdReq.GetRequestId()
+	log("cmd").Debugf("command service request: %v", cmdReq)
+
+	switch cmdReq.Command.(type) {
+	case *pb.PCmdRequest_CommandEcho:
+		msg := cmdReq.GetCommandEcho().GetMessage()
+		if msg == SelfTestCommand {
+			msg = agent.selfTestMessage()
+		}
+		agent.grpc().cmd.sendEcho(reqId, msg)
+		break
+	case *pb.PCmdRequest_CommandActiveThreadCount:
+		atcStream := agent.grpc().cmd.newActiveThreadCountStream(reqId)
+		agent.cmdWg.Add(1)
+		go agent.sendActiveThreadCount(atcStream)
+		break
+	case *pb.PCmdRequest_CommandActiveThreadDump:
+		limit := cmdReq.GetCommandActiveThreadDump().GetLimit()
+		threadName := cmdReq.GetCommandActiveThreadDump().GetThreadName()
+		localId := cmdReq.GetCommandActiveThreadDump().GetLocalTraceId()
+		agent.grpc().cmd.sendActiveThreadDump(reqId, limit, threadName, localId, gDump)
+		break
+	case *pb.PCmdRequest_CommandActiveThreadLightDump:
+		limit := cmdReq.GetCommandActiveThreadLightDump().GetLimit()
+		gDump = agent.takeGoroutineDump()
+		agent.grpc().cmd.sendActiveThreadLightDump(reqId, limit, gDump)
+		break
+	case nil:
+		// The field is not set.
+	default:
+	}
+}
+
+func (agent *agent) sendActiveThreadCount(s *activeThreadCountStream) {
+	defer agent.cmdWg.Done()
+
+	for agent.Enable() {
 		err := s.sendActiveThreadCount()
 		if err != nil {
 			log("cmd").Errorf("fail to sendActiveThreadCount(): %d, %v", s.reqId, err)
 			break
 		}
-		time.Sleep(1 * time.Second)
+		if !agent.sleep(1 * time.Second) {
+			break
+		}
 	}
 	s.close()
 }
 
-func dumpGoroutine() *GoroutineDump {
-	//var b bytes.Buffer
-	//f := bufio.NewWriter(&b)
+// closeCommandStreams waits up to the given timeout for the command service and the active thread count
+// streams, which their goroutines close when the agent is shut down.
+func (agent *agent) closeCommandStreams(timeout time.Duration) {
+	done := make(chan struct{})
+	go func() {
+		agent.cmdWg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(timeout):
+		log("cmd").Warn("command streams are not finished in ", timeout)
+	}
+}
 
-	fn := filepath.Join("/tmp", "goroutine.pprof")
-	f, err := os.Create(fn)
-	if err != nil {
-		log("cmd").Errorf("fail to os.Create(): %v", err)
+// takeGoroutineDump reuses the last dump if it is taken within the minimum interval,
+// as dumping all goroutines stops the world.
+func (agent *agent) takeGoroutineDump() *GoroutineDump {
+	interval := time.Duration(agent.Config().ThreadDump.MinInterval) * time.Millisecond
+	if gDump != nil && time.Since(gDumpTime) < interval {
+		log("cmd").Debug("reuse goroutine dump taken at ", gDumpTime)
+		return gDump
 	}
 
+	gDumpTime = time.Now()
+	return dumpGoroutine()
+}
+
+func dumpGoroutine() *GoroutineDump {
+	//the profile is kept in memory, so that it works with a read-only file system
+	var b bytes.Buffer
+
 	if mp := pprof.Lookup("goroutine"); mp != nil {
-		mp.WriteTo(f, 2)
+		if err := mp.WriteTo(&b, 2); err != nil {
+			log("cmd").Errorf("fail to dumpGoroutine(): %v", err)
+			return nil
+		}
 	}
-	f.Close()
 
-	dump, err := loadProfile(fn)
+	dump, err := parseProfile(&b)
 	if err != nil {
 		log("cmd").Errorf("fail to dumpGoroutine(): %v", err)
 		return nil
@@ -0,0 +1,117 @@
+package pinpoint
+
+import (
+	"context"
+	"io"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	pb "github.com/pinpoint-apm/pinpoint-go-agent/protobuf"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+)
+
+// closingCmdStream ends the stream when CloseSend is called, and counts the CloseSend calls made during a Send.
+type closingCmdStream struct {
+	pb.ProfilerCommandService_HandleCommandClient
+	sending   int32
+	overlaps  int32
+	sent      chan struct{}
+	closed    chan struct{}
+	sentOnce  sync.Once
+	closeOnce sync.Once
+}
+
+func (s *closingCmdStream) Send(m *pb.PCmdMessage) error {
+	atomic.StoreInt32(&s.sending, 1)
+	defer atomic.StoreInt32(&s.sending, 0)
+
+	s.sentOnce.Do(func() { close(s.sent) })
+	time.Sleep(100 * time.Millisecond)
+	return nil
+}
+
+func (s *closingCmdStream) Recv() (*pb.PCmdRequest, error) {
+	<-s.closed
+	return nil, io.EOF
+}
+
+func (s *closingCmdStream) CloseSend() error {
+	if atomic.LoadInt32(&s.sending) == 1 {
+		atomic.AddInt32(&s.overlaps, 1)
+	}
+	s.closeOnce.Do(func() { close(s.closed) })
+	return nil
+}
+
+type cmdStreamClient struct {
+	pb.ProfilerCommandServiceClient
+	stream *closingCmdStream
+}
+
+func (c *cmdStreamClient) HandleCommand(ctx context.Context, opts ...grpc.CallOption) (pb.ProfilerCommandService_HandleCommandClient, error) {
+	return c.stream, nil
+}
+
+func Test_agent_runCommandService_CloseOnShutdown(t *testing.T) {
+	c, _ := NewConfig(WithAppName("test"), WithAgentId("testagent"))
+	c.OffGrpc = true
+	a, _ := NewAgent(c)
+	agent := a.(*agent)
+
+	stream := &closingCmdStream{sent: make(chan struct{}), closed: make(chan struct{})}
+	agent.cmdGrpc = &cmdGrpc{cmdClient: &cmdStreamClient{stream: stream}, agent: agent}
+
+	agent.enable = true
+	agent.cmdWg.Add(1)
+	go agent.runCommandService()
+	<-stream.sent
+
+	//shut down while the handshake is being sent
+	agent.connCancel()
+	agent.closeCommandStreams(5 * time.Second)
+
+	done := make(chan struct{})
+	go func() {
+		agent.cmdWg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("command service is not finished on shutdown")
+	}
+
+	assert.Equal(t, int32(0), atomic.LoadInt32(&stream.overlaps), "CloseSend during Send")
+	select {
+	case <-stream.closed:
+	default:
+		t.Error("command stream is not closed")
+	}
+}
+
+func Test_dumpGoroutine(t *testing.T) {
+	started := make(chan struct{})
+	block := make(chan struct{})
+	defer close(block)
+	go func() {
+		close(started)
+		<-block
+	}()
+	<-started
+
+	dump := dumpGoroutine()
+	assert.NotNil(t, dump, "dump")
+
+	found := false
+	for _, g := range dump.goroutines {
+		assert.True(t, g.frozen, "frozen")
+		if strings.Contains(g.trace, "Test_dumpGoroutine.func1") {
+			found = true
+		}
+	}
+	assert.True(t, found, "blocked goroutine is dumped")
+}
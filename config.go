@@ -5,8 +5,11 @@ import (
 	"errors"
 	"github.com/sirupsen/logrus"
 	"gopkg.in/yaml.v2"
+	"io"
 	"math/rand"
+	"net"
 	"os"
+	"strings"
 	"time"
 )
 
@@ -17,25 +20,112 @@ type Config struct {
 	ConfigFilePath  string
 
 	Collector struct {
-		Host      string
-		AgentPort int
-		SpanPort  int
-		StatPort  int
+		Host                    string
+		AgentHost               string
+		SpanHost                string
+		StatHost                string
+		CommandHost             string
+		AgentPort               int
+		SpanPort                int
+		StatPort                int
+		AgentInfoResendInterval int
+		PingInterval            int
+		ConnectTimeout          int
+		MaxConnectAttempts      int
+		BackoffBase             int
+		BackoffMax              int
+		Resolver                *net.Resolver `json:"-" yaml:"-"`
+		SourceAddress           string
+		TLSEnabled              bool
+		CACertFile              string
+		ClientCertFile          string
+		ClientKeyFile           string
+		Compression             string
 	}
 
 	LogLevel logrus.Level
 
 	Sampling struct {
+		Type               string
 		Rate               int
 		NewThroughput      int
 		ContinueThroughput int
+		ContinuationRate   int
+		KeepSlowThreshold  int
+		KeepMaxBuffered    int
+		ForceHeader        string
+		KeyFunc            SamplingKeyFunc `json:"-" yaml:"-"`
+		KeyRates           map[string]int
+		ExcludeUserAgents  []string
+	}
+
+	Span struct {
+		QueueSize         int
+		QueueFullPolicy   string
+		BatchSize         int
+		IdleFlushInterval int
+		AdaptiveBatch     bool
+		MaxBatchSize      int
+		SlowSendThreshold int
+		ProfileLabels     bool
+		MaxDuration       int
+		MaxNameLength     int
+		RecentTraces      int
+		ErrorStackDepth   int
+		DebugExport       bool
+		DebugExportWriter io.Writer `json:"-" yaml:"-"`
 	}
 
 	Stat struct {
-		CollectInterval int
-		BatchCount      int
+		CollectInterval        int
+		BatchCount             int
+		AdaptiveBatch          bool
+		MaxBatchCount          int
+		SlowSendThreshold      int
+		GoroutineLeakThreshold int
+		GoroutineLeakWindow    int
+		MaxCustomStats         int
+		Sinks                  []StatsSink `json:"-" yaml:"-"`
+	}
+
+	Propagation struct {
+		W3C bool
+	}
+
+	Http struct {
+		RecordQueryParams      []string
+		UriStat                bool
+		TraceOrphanClientCalls bool
+	}
+
+	Annotation struct {
+		OperationNameKey  int32
+		MaxPerSpan        int
+		MaxKeyLength      int
+		MaxValueLength    int
+		SampleRate        int
+		MicroElapsedUnder int
+	}
+
+	ThreadDump struct {
+		MinInterval int
 	}
 
+	Metadata struct {
+		BatchWindow int
+		BatchSize   int
+		Compression bool
+	}
+
+	Labels           map[string]string
+	KubernetesLabels bool
+	ServiceGroup     string
+
+	NetworkInterface string
+	AgentIp          string
+	StartupTimeout   int
+	ShutdownTimeout  int
+
 	IsContainer bool
 	OffGrpc     bool //for test
 }
@@ -71,9 +161,101 @@ func NewConfig(opts ...ConfigOption) (*Config, error) {
 		config.IsContainer = isContainerEnv()
 	}
 
+	if config.KubernetesLabels {
+		addKubernetesLabels(config)
+	}
+
+	if config.ServiceGroup != "" {
+		if config.Labels == nil {
+			config.Labels = make(map[string]string)
+		}
+		config.Labels[ServiceGroupLabel] = config.ServiceGroup
+	}
+
+	checkServiceType(config.ApplicationType)
+	checkCollectorConfig(config)
+	checkSamplingConfig(config)
+	checkSpanConfig(config)
+
 	return config, nil
 }
 
+// checkCollectorConfig replaces the invalid connection settings with the defaults,
+// as a non-positive timeout fails every dial and a non-positive backoff makes the retries spin.
+func checkCollectorConfig(config *Config) {
+	c := &config.Collector
+	if c.ConnectTimeout <= 0 {
+		log("config").Warnf("invalid collector connect timeout %d, 3000ms is used", c.ConnectTimeout)
+		c.ConnectTimeout = 3000
+	}
+	if c.BackoffBase <= 0 {
+		log("config").Warnf("invalid collector backoff base %d, 1000ms is used", c.BackoffBase)
+		c.BackoffBase = 1000
+	}
+	if c.BackoffMax < c.BackoffBase {
+		log("config").Warnf("collector backoff max %d is less than the base, %dms is used", c.BackoffMax, c.BackoffBase)
+		c.BackoffMax = c.BackoffBase
+	}
+}
+
+// checkSamplingConfig replaces an unknown sampling type with COUNTING, and caps the rates of PERCENT at 100.
+func checkSamplingConfig(config *Config) {
+	c := &config.Sampling
+	switch typ := strings.ToUpper(c.Type); typ {
+	case SamplingTypeCounting, SamplingTypePercent:
+		c.Type = typ
+	default:
+		log("config").Warnf("unknown sampling type %s, %s is used", c.Type, SamplingTypeCounting)
+		c.Type = SamplingTypeCounting
+	}
+
+	if c.Type == SamplingTypePercent {
+		if c.Rate > 100 {
+			log("config").Warnf("sampling rate %d is over 100 percent, 100 is used", c.Rate)
+			c.Rate = 100
+		}
+		if c.ContinuationRate > 100 {
+			log("config").Warnf("continuation sampling rate %d is over 100 percent, 100 is used", c.ContinuationRate)
+			c.ContinuationRate = 100
+		}
+	}
+}
+
+// checkSpanConfig replaces an unknown span queue full policy with DROP_OLDEST.
+func checkSpanConfig(config *Config) {
+	c := &config.Span
+	switch policy := strings.ToUpper(c.QueueFullPolicy); policy {
+	case SpanQueueDropOldest, SpanQueueDropNewest:
+		c.QueueFullPolicy = policy
+	default:
+		log("config").Warnf("unknown span queue full policy %s, %s is used", c.QueueFullPolicy, SpanQueueDropOldest)
+		c.QueueFullPolicy = SpanQueueDropOldest
+	}
+}
+
+// ServiceGroupLabel is the label of the logical service set by WithServiceGroup.
+const ServiceGroupLabel = "service.group"
+
+var kubernetesLabelEnvs = map[string]string{
+	"k8s.pod":       "POD_NAME",
+	"k8s.node":      "NODE_NAME",
+	"k8s.namespace": "POD_NAMESPACE",
+}
+
+func addKubernetesLabels(config *Config) {
+	for label, env := range kubernetesLabelEnvs {
+		v := os.Getenv(env)
+		if v == "" {
+			continue
+		}
+
+		if config.Labels == nil {
+			config.Labels = make(map[string]string)
+		}
+		config.Labels[label] = v
+	}
+}
+
 func isContainerEnv() bool {
 	_, err := os.Stat("/.dockerenv")
 	if err == nil || !os.IsNotExist(err) {
@@ -95,18 +277,90 @@ func defaultConfig() *Config {
 	config.AgentId = ""
 
 	config.Collector.Host = "localhost"
+	config.Collector.AgentHost = ""
+	config.Collector.SpanHost = ""
+	config.Collector.StatHost = ""
+	config.Collector.CommandHost = ""
 	config.Collector.AgentPort = 9991
 	config.Collector.StatPort = 9992
 	config.Collector.SpanPort = 9993
+	config.Collector.AgentInfoResendInterval = 0 //ms
+	config.Collector.PingInterval = 60000        //ms
+	config.Collector.ConnectTimeout = 3000       //ms
+	config.Collector.MaxConnectAttempts = 0
+	config.Collector.BackoffBase = 1000 //ms
+	config.Collector.BackoffMax = 60000 //ms
+	config.Collector.TLSEnabled = false
+	config.Collector.Compression = "none"
+	config.Collector.Resolver = nil
+	config.Collector.SourceAddress = ""
 
 	config.LogLevel = logrus.InfoLevel
 
+	config.Sampling.Type = SamplingTypeCounting
 	config.Sampling.Rate = 1
 	config.Sampling.NewThroughput = 0
 	config.Sampling.ContinueThroughput = 0
+	config.Sampling.ContinuationRate = 0
+	config.Sampling.KeepSlowThreshold = 0 //ms
+	config.Sampling.KeepMaxBuffered = 100
+	config.Sampling.ForceHeader = ""
+	config.Sampling.KeyFunc = nil
+	config.Sampling.KeyRates = nil
+	config.Sampling.ExcludeUserAgents = nil
+
+	config.Span.QueueSize = 5 * 1024
+	config.Span.QueueFullPolicy = SpanQueueDropOldest
+	config.Span.BatchSize = 1
+	config.Span.IdleFlushInterval = 1000 //ms
+	config.Span.AdaptiveBatch = false
+	config.Span.MaxBatchSize = 100
+	config.Span.SlowSendThreshold = 1000 //ms
+	config.Span.ProfileLabels = false
+	config.Span.MaxDuration = 0 //ms
+	config.Span.MaxNameLength = 256
+	config.Span.RecentTraces = 0
+	config.Span.ErrorStackDepth = 0
+	config.Span.DebugExport = false
+	config.Span.DebugExportWriter = nil
 
 	config.Stat.CollectInterval = 5000 //ms
 	config.Stat.BatchCount = 6
+	config.Stat.AdaptiveBatch = false
+	config.Stat.MaxBatchCount = 6
+	config.Stat.SlowSendThreshold = 1000 //ms
+	config.Stat.GoroutineLeakThreshold = 0
+	config.Stat.GoroutineLeakWindow = 12
+	config.Stat.MaxCustomStats = 32
+	config.Stat.Sinks = nil
+
+	config.Propagation.W3C = false
+
+	config.Http.RecordQueryParams = nil
+	config.Http.UriStat = false
+	config.Http.TraceOrphanClientCalls = false
+
+	config.Annotation.OperationNameKey = AnnotationApi
+	config.Annotation.MaxPerSpan = 256
+	config.Annotation.MaxKeyLength = 256
+	config.Annotation.MaxValueLength = 4096
+	config.Annotation.SampleRate = 0
+	config.Annotation.MicroElapsedUnder = 0 //ms
+
+	config.ThreadDump.MinInterval = 1000 //ms
+
+	config.Metadata.BatchWindow = 0 //ms
+	config.Metadata.BatchSize = 16
+	config.Metadata.Compression = false
+
+	config.Labels = nil
+	config.KubernetesLabels = false
+	config.ServiceGroup = ""
+
+	config.NetworkInterface = ""
+	config.AgentIp = ""
+	config.StartupTimeout = 0  //ms
+	config.ShutdownTimeout = 0 //ms
 
 	config.IsContainer = false
 	setContainer = false
@@ -165,6 +419,30 @@ func WithCollectorHost(host string) ConfigOption {
 	}
 }
 
+func WithCollectorAgentHost(host string) ConfigOption {
+	return func(c *Config) {
+		c.Collector.AgentHost = host
+	}
+}
+
+func WithCollectorSpanHost(host string) ConfigOption {
+	return func(c *Config) {
+		c.Collector.SpanHost = host
+	}
+}
+
+func WithCollectorStatHost(host string) ConfigOption {
+	return func(c *Config) {
+		c.Collector.StatHost = host
+	}
+}
+
+func WithCollectorCommandHost(host string) ConfigOption {
+	return func(c *Config) {
+		c.Collector.CommandHost = host
+	}
+}
+
 func WithCollectorAgentPort(port int) ConfigOption {
 	return func(c *Config) {
 		c.Collector.AgentPort = port
@@ -183,6 +461,74 @@ func WithCollectorStatPort(port int) ConfigOption {
 	}
 }
 
+func WithCollectorResolver(r *net.Resolver) ConfigOption {
+	return func(c *Config) {
+		c.Collector.Resolver = r
+	}
+}
+
+func WithCollectorSourceAddress(addr string) ConfigOption {
+	return func(c *Config) {
+		c.Collector.SourceAddress = addr
+	}
+}
+
+func WithCollectorConnectTimeout(timeout int) ConfigOption {
+	return func(c *Config) {
+		c.Collector.ConnectTimeout = timeout
+	}
+}
+
+func WithCollectorMaxConnectAttempts(attempts int) ConfigOption {
+	return func(c *Config) {
+		c.Collector.MaxConnectAttempts = attempts
+	}
+}
+
+func WithCollectorBackoff(base int, max int) ConfigOption {
+	return func(c *Config) {
+		c.Collector.BackoffBase = base
+		c.Collector.BackoffMax = max
+	}
+}
+
+func WithCollectorTLS(enable bool) ConfigOption {
+	return func(c *Config) {
+		c.Collector.TLSEnabled = enable
+	}
+}
+
+func WithCollectorCACertFile(file string) ConfigOption {
+	return func(c *Config) {
+		c.Collector.CACertFile = file
+	}
+}
+
+func WithCollectorClientCert(certFile string, keyFile string) ConfigOption {
+	return func(c *Config) {
+		c.Collector.ClientCertFile = certFile
+		c.Collector.ClientKeyFile = keyFile
+	}
+}
+
+func WithCollectorCompression(compressor string) ConfigOption {
+	return func(c *Config) {
+		c.Collector.Compression = compressor
+	}
+}
+
+func WithCollectorAgentInfoResendInterval(interval int) ConfigOption {
+	return func(c *Config) {
+		c.Collector.AgentInfoResendInterval = interval
+	}
+}
+
+func WithCollectorPingInterval(interval int) ConfigOption {
+	return func(c *Config) {
+		c.Collector.PingInterval = interval
+	}
+}
+
 func WithLogLevel(level string) ConfigOption {
 	return func(c *Config) {
 		l, e := logrus.ParseLevel(level)
@@ -194,6 +540,12 @@ func WithLogLevel(level string) ConfigOption {
 	}
 }
 
+func WithSamplingType(typ string) ConfigOption {
+	return func(c *Config) {
+		c.Sampling.Type = typ
+	}
+}
+
 func WithSamplingRate(rate int) ConfigOption {
 	return func(c *Config) {
 		c.Sampling.Rate = rate
@@ -212,18 +564,320 @@ func WithSamplingContinueThroughput(tps int) ConfigOption {
 	}
 }
 
+func WithSpanBatchSize(size int) ConfigOption {
+	return func(c *Config) {
+		c.Span.BatchSize = size
+	}
+}
+
+func WithSpanIdleFlushInterval(interval int) ConfigOption {
+	return func(c *Config) {
+		c.Span.IdleFlushInterval = interval
+	}
+}
+
+func WithSamplingContinuationRate(rate int) ConfigOption {
+	return func(c *Config) {
+		c.Sampling.ContinuationRate = rate
+	}
+}
+
+func WithSamplingForceHeader(header string) ConfigOption {
+	return func(c *Config) {
+		c.Sampling.ForceHeader = header
+	}
+}
+
+func WithSamplingKeyFunc(f SamplingKeyFunc) ConfigOption {
+	return func(c *Config) {
+		c.Sampling.KeyFunc = f
+	}
+}
+
+func WithSamplingKeyRates(rates map[string]int) ConfigOption {
+	return func(c *Config) {
+		c.Sampling.KeyRates = rates
+	}
+}
+
+func WithSamplingExcludeUserAgents(patterns []string) ConfigOption {
+	return func(c *Config) {
+		c.Sampling.ExcludeUserAgents = patterns
+	}
+}
+
+func WithSamplingKeepSlowThreshold(threshold int) ConfigOption {
+	return func(c *Config) {
+		c.Sampling.KeepSlowThreshold = threshold
+	}
+}
+
+func WithSamplingKeepMaxBuffered(max int) ConfigOption {
+	return func(c *Config) {
+		c.Sampling.KeepMaxBuffered = max
+	}
+}
+
+func WithSpanAdaptiveBatch(enable bool) ConfigOption {
+	return func(c *Config) {
+		c.Span.AdaptiveBatch = enable
+	}
+}
+
+func WithSpanMaxBatchSize(size int) ConfigOption {
+	return func(c *Config) {
+		c.Span.MaxBatchSize = size
+	}
+}
+
+func WithSpanQueueSize(size int) ConfigOption {
+	return func(c *Config) {
+		c.Span.QueueSize = size
+	}
+}
+
+func WithSpanQueueFullPolicy(policy string) ConfigOption {
+	return func(c *Config) {
+		c.Span.QueueFullPolicy = policy
+	}
+}
+
+func WithSpanSlowSendThreshold(threshold int) ConfigOption {
+	return func(c *Config) {
+		c.Span.SlowSendThreshold = threshold
+	}
+}
+
+func WithSpanProfileLabels(enable bool) ConfigOption {
+	return func(c *Config) {
+		c.Span.ProfileLabels = enable
+	}
+}
+
+func WithSpanMaxNameLength(length int) ConfigOption {
+	return func(c *Config) {
+		c.Span.MaxNameLength = length
+	}
+}
+
+func WithSpanRecentTraces(count int) ConfigOption {
+	return func(c *Config) {
+		c.Span.RecentTraces = count
+	}
+}
+
+func WithSpanErrorStackDepth(depth int) ConfigOption {
+	return func(c *Config) {
+		c.Span.ErrorStackDepth = depth
+	}
+}
+
+func WithSpanMaxDuration(duration int) ConfigOption {
+	return func(c *Config) {
+		c.Span.MaxDuration = duration
+	}
+}
+
+func WithSpanDebugExport(enable bool) ConfigOption {
+	return func(c *Config) {
+		c.Span.DebugExport = enable
+	}
+}
+
+func WithSpanDebugExportWriter(w io.Writer) ConfigOption {
+	return func(c *Config) {
+		c.Span.DebugExportWriter = w
+	}
+}
+
 func WithStatCollectInterval(interval int) ConfigOption {
 	return func(c *Config) {
 		c.Stat.CollectInterval = interval
 	}
 }
 
+func WithStatSink(sink StatsSink) ConfigOption {
+	return func(c *Config) {
+		c.Stat.Sinks = append(c.Stat.Sinks, sink)
+	}
+}
+
 func WithStatBatchCount(count int) ConfigOption {
 	return func(c *Config) {
 		c.Stat.BatchCount = count
 	}
 }
 
+func WithStatAdaptiveBatch(enable bool) ConfigOption {
+	return func(c *Config) {
+		c.Stat.AdaptiveBatch = enable
+	}
+}
+
+func WithStatMaxBatchCount(count int) ConfigOption {
+	return func(c *Config) {
+		c.Stat.MaxBatchCount = count
+	}
+}
+
+func WithStatSlowSendThreshold(threshold int) ConfigOption {
+	return func(c *Config) {
+		c.Stat.SlowSendThreshold = threshold
+	}
+}
+
+func WithStatGoroutineLeakThreshold(threshold int) ConfigOption {
+	return func(c *Config) {
+		c.Stat.GoroutineLeakThreshold = threshold
+	}
+}
+
+func WithStatGoroutineLeakWindow(window int) ConfigOption {
+	return func(c *Config) {
+		c.Stat.GoroutineLeakWindow = window
+	}
+}
+
+func WithStatMaxCustomStats(max int) ConfigOption {
+	return func(c *Config) {
+		c.Stat.MaxCustomStats = max
+	}
+}
+
+func WithPropagationW3C(enable bool) ConfigOption {
+	return func(c *Config) {
+		c.Propagation.W3C = enable
+	}
+}
+
+func WithHttpRecordQueryParams(params []string) ConfigOption {
+	return func(c *Config) {
+		c.Http.RecordQueryParams = params
+	}
+}
+
+func WithHttpUriStat(enable bool) ConfigOption {
+	return func(c *Config) {
+		c.Http.UriStat = enable
+	}
+}
+
+func WithHttpTraceOrphanClientCalls(enable bool) ConfigOption {
+	return func(c *Config) {
+		c.Http.TraceOrphanClientCalls = enable
+	}
+}
+
+func WithAnnotationOperationNameKey(key int32) ConfigOption {
+	return func(c *Config) {
+		c.Annotation.OperationNameKey = key
+	}
+}
+
+func WithAnnotationMaxPerSpan(max int) ConfigOption {
+	return func(c *Config) {
+		c.Annotation.MaxPerSpan = max
+	}
+}
+
+func WithAnnotationMaxKeyLength(max int) ConfigOption {
+	return func(c *Config) {
+		c.Annotation.MaxKeyLength = max
+	}
+}
+
+func WithAnnotationMaxValueLength(max int) ConfigOption {
+	return func(c *Config) {
+		c.Annotation.MaxValueLength = max
+	}
+}
+
+func WithAnnotationSampleRate(rate int) ConfigOption {
+	return func(c *Config) {
+		c.Annotation.SampleRate = rate
+	}
+}
+
+func WithAnnotationMicroElapsedUnder(threshold int) ConfigOption {
+	return func(c *Config) {
+		c.Annotation.MicroElapsedUnder = threshold
+	}
+}
+
+func WithThreadDumpMinInterval(interval int) ConfigOption {
+	return func(c *Config) {
+		c.ThreadDump.MinInterval = interval
+	}
+}
+
+func WithMetadataBatchWindow(window int) ConfigOption {
+	return func(c *Config) {
+		c.Metadata.BatchWindow = window
+	}
+}
+
+func WithMetadataBatchSize(size int) ConfigOption {
+	return func(c *Config) {
+		c.Metadata.BatchSize = size
+	}
+}
+
+func WithMetadataCompression(enable bool) ConfigOption {
+	return func(c *Config) {
+		c.Metadata.Compression = enable
+	}
+}
+
+func WithLabels(labels map[string]string) ConfigOption {
+	return func(c *Config) {
+		//copied, because NewConfig adds the service group and the kubernetes labels to it
+		if labels == nil {
+			c.Labels = nil
+			return
+		}
+		c.Labels = make(map[string]string, len(labels))
+		for k, v := range labels {
+			c.Labels[k] = v
+		}
+	}
+}
+
+func WithKubernetesLabels(enable bool) ConfigOption {
+	return func(c *Config) {
+		c.KubernetesLabels = enable
+	}
+}
+
+func WithServiceGroup(group string) ConfigOption {
+	return func(c *Config) {
+		c.ServiceGroup = group
+	}
+}
+
+func WithNetworkInterface(name string) ConfigOption {
+	return func(c *Config) {
+		c.NetworkInterface = name
+	}
+}
+
+func WithAgentIp(ip string) ConfigOption {
+	return func(c *Config) {
+		c.AgentIp = ip
+	}
+}
+
+func WithStartupTimeout(timeout int) ConfigOption {
+	return func(c *Config) {
+		c.StartupTimeout = timeout
+	}
+}
+
+func WithShutdownTimeout(timeout int) ConfigOption {
+	return func(c *Config) {
+		c.ShutdownTimeout = timeout
+	}
+}
+
 func WithIsContainer(isContainer bool) ConfigOption {
 	setContainer = true
 	return func(c *Config) {
@@ -2,7 +2,9 @@ package pinpoint
 
 import (
 	"github.com/stretchr/testify/assert"
+	"os"
 	"testing"
+	"time"
 )
 
 func TestNewConfig(t *testing.T) {
@@ -103,3 +105,101 @@ func TestNewConfig_ReadConfigFile(t *testing.T) {
 		})
 	}
 }
+
+func TestNewConfig_KubernetesLabels(t *testing.T) {
+	os.Setenv("POD_NAME", "pod-1")
+	os.Setenv("NODE_NAME", "node-1")
+	os.Unsetenv("POD_NAMESPACE")
+	defer os.Unsetenv("POD_NAME")
+	defer os.Unsetenv("NODE_NAME")
+
+	opts := []ConfigOption{
+		WithAppName("TestApp"),
+		WithKubernetesLabels(true),
+	}
+
+	c, _ := NewConfig(opts...)
+	assert.Equal(t, "pod-1", c.Labels["k8s.pod"], "k8s.pod")
+	assert.Equal(t, "node-1", c.Labels["k8s.node"], "k8s.node")
+	assert.NotContains(t, c.Labels, "k8s.namespace", "k8s.namespace")
+}
+
+func TestNewConfig_ServiceGroup(t *testing.T) {
+	opts := []ConfigOption{
+		WithAppName("TestApp-canary"),
+		WithLabels(map[string]string{"team": "order"}),
+		WithServiceGroup("order-service"),
+	}
+
+	c, _ := NewConfig(opts...)
+	assert.Equal(t, "order-service", c.Labels[ServiceGroupLabel], ServiceGroupLabel)
+	assert.Equal(t, "order", c.Labels["team"], "team")
+
+	c, _ = NewConfig(WithAppName("TestApp"))
+	assert.NotContains(t, c.Labels, ServiceGroupLabel, ServiceGroupLabel)
+}
+
+func TestNewConfig_LabelsCopied(t *testing.T) {
+	os.Setenv("POD_NAME", "pod-1")
+	defer os.Unsetenv("POD_NAME")
+
+	labels := map[string]string{"team": "order"}
+	c1, _ := NewConfig(WithAppName("TestApp"), WithLabels(labels), WithServiceGroup("order-service"), WithKubernetesLabels(true))
+	c2, _ := NewConfig(WithAppName("TestApp"), WithLabels(labels))
+
+	assert.Equal(t, map[string]string{"team": "order"}, labels, "caller's labels")
+	assert.Equal(t, "order-service", c1.Labels[ServiceGroupLabel], ServiceGroupLabel)
+	assert.Equal(t, "pod-1", c1.Labels["k8s.pod"], "k8s.pod")
+	assert.Equal(t, map[string]string{"team": "order"}, c2.Labels, "labels of another config")
+}
+
+func TestNewConfig_CollectorConnect(t *testing.T) {
+	tests := []struct {
+		name        string
+		timeout     int
+		base        int
+		max         int
+		wantTimeout int
+		wantBase    int
+		wantMax     int
+	}{
+		{"valid", 500, 200, 2000, 500, 200, 2000},
+		{"zero timeout", 0, 200, 2000, 3000, 200, 2000},
+		{"negative timeout", -1, 200, 2000, 3000, 200, 2000},
+		{"zero base", 500, 0, 2000, 500, 1000, 2000},
+		{"negative base", 500, -100, 2000, 500, 1000, 2000},
+		{"max under base", 500, 200, 100, 500, 200, 200},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, _ := NewConfig(WithAppName("TestApp"), WithCollectorConnectTimeout(tt.timeout), WithCollectorBackoff(tt.base, tt.max))
+			assert.Equal(t, tt.wantTimeout, c.Collector.ConnectTimeout, "ConnectTimeout")
+			assert.Equal(t, tt.wantBase, c.Collector.BackoffBase, "BackoffBase")
+			assert.Equal(t, tt.wantMax, c.Collector.BackoffMax, "BackoffMax")
+			assert.Greater(t, int64(backoffDelay(time.Duration(c.Collector.BackoffBase)*time.Millisecond, time.Duration(c.Collector.BackoffMax)*time.Millisecond, 1)), int64(0), "backoff")
+		})
+	}
+
+	c, _ := NewConfig(WithAppName("TestApp"))
+	assert.Equal(t, 0, c.Collector.MaxConnectAttempts, "retries without limit by default")
+}
+
+func TestNewConfig_SpanQueueFullPolicy(t *testing.T) {
+	tests := []struct {
+		name   string
+		policy string
+		want   string
+	}{
+		{"oldest", SpanQueueDropOldest, SpanQueueDropOldest},
+		{"newest", SpanQueueDropNewest, SpanQueueDropNewest},
+		{"lowercase", "drop_newest", SpanQueueDropNewest},
+		{"unknown", "BLOCK", SpanQueueDropOldest},
+		{"empty", "", SpanQueueDropOldest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, _ := NewConfig(WithAppName("TestApp"), WithSpanQueueFullPolicy(tt.policy))
+			assert.Equal(t, tt.want, c.Span.QueueFullPolicy, "QueueFullPolicy")
+		})
+	}
+}
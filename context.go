@@ -23,6 +23,17 @@ func FromContext(ctx context.Context) Tracer {
 	}
 }
 
+// TracerFromContext returns the tracer of ctx like FromContext, but returns a tracer which records nothing
+// if ctx has no tracer, so that the caller can use it without checking nil.
+func TracerFromContext(ctx context.Context) Tracer {
+	if ctx != nil {
+		if tracer := FromContext(ctx); tracer != nil {
+			return tracer
+		}
+	}
+	return NoopTracer()
+}
+
 func RequestWithTracerContext(req *http.Request, tracer Tracer) *http.Request {
 	ctx := NewContext(req.Context(), tracer)
 	return req.WithContext(ctx)
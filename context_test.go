@@ -0,0 +1,43 @@
+package pinpoint
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTracerFromContext(t *testing.T) {
+	s := defaultSpan()
+	ctx := NewContext(context.Background(), s)
+	assert.Equal(t, Tracer(s), TracerFromContext(ctx), "tracer")
+
+	noop := TracerFromContext(context.Background())
+	assert.NotNil(t, noop, "noop")
+	assert.Equal(t, int64(-1), noop.TransactionId().Sequence, "noop transaction id")
+	assert.Nil(t, FromContext(context.Background()), "FromContext")
+
+	noop.NewSpanEvent("event").EndSpanEvent()
+	noop.EndSpan()
+}
+
+func TestNoopTracer(t *testing.T) {
+	tracer := NoopTracer()
+	tracer.NewSpanEvent("event")
+	tracer.SpanEvent().SetError(nil)
+	tracer.SpanEvent().Annotations().AppendString(AnnotationHttpUrl, "http://localhost/")
+	tracer.EndSpanEvent()
+	tracer.Span().RecordAttribute("key", 1)
+	tracer.EndSpan()
+
+	header := map[string]string{}
+	tracer.Inject(mapWriter(header))
+	assert.Equal(t, "s0", header[HttpSampled], "sampled")
+	assert.Equal(t, int64(-1), tracer.SpanId(), "span id")
+}
+
+type mapWriter map[string]string
+
+func (m mapWriter) Set(key string, value string) {
+	m[key] = value
+}
@@ -0,0 +1,77 @@
+package pinpoint
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// customStats holds the last values of the gauges recorded by Agent.RecordCustomStat.
+type customStats struct {
+	mux    sync.Mutex
+	max    int
+	values map[string]float64
+	warned bool
+}
+
+func newCustomStats(max int) *customStats {
+	return &customStats{
+		max:    max,
+		values: make(map[string]float64),
+	}
+}
+
+func (c *customStats) record(name string, value float64) {
+	if name == "" {
+		return
+	}
+
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	if _, ok := c.values[name]; !ok && len(c.values) >= c.max {
+		if !c.warned {
+			c.warned = true
+			log("stats").Warnf("custom stat is dropped, over the maximum %d: %s", c.max, name)
+		}
+		return
+	}
+	c.values[name] = value
+}
+
+func (c *customStats) snapshot() map[string]float64 {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	if len(c.values) == 0 {
+		return nil
+	}
+
+	m := make(map[string]float64, len(c.values))
+	for k, v := range c.values {
+		m[k] = v
+	}
+	return m
+}
+
+// encodeCustomStats formats the custom stats as "name=value" pairs sorted by name and separated by commas,
+// to be sent in the metadata field of the agent stat, as the collector has no message for custom metrics.
+func encodeCustomStats(stats map[string]float64) string {
+	names := make([]string, 0, len(stats))
+	for k := range stats {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+
+	var b strings.Builder
+	for i, k := range names {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(k)
+		b.WriteByte('=')
+		b.WriteString(strconv.FormatFloat(stats[k], 'g', -1, 64))
+	}
+	return b.String()
+}
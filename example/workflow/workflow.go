@@ -0,0 +1,59 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	pinpoint "github.com/pinpoint-apm/pinpoint-go-agent"
+)
+
+func validate(ctx context.Context, order string) error {
+	tracer := pinpoint.FromContext(ctx)
+	defer tracer.NewSpanEvent("validate").EndSpanEvent()
+
+	time.Sleep(5 * time.Millisecond)
+	return nil
+}
+
+func reserve(ctx context.Context, order string) error {
+	tracer := pinpoint.FromContext(ctx)
+	tracer.NewSpanEvent("reserve")
+
+	time.Sleep(10 * time.Millisecond)
+	err := errors.New("out of stock")
+
+	tracer.EndSpanEventWithStatus(err)
+	return err
+}
+
+func processOrder(agent pinpoint.Agent, order string) {
+	tracer := pinpoint.NewTransactionTracer(agent, "Order Workflow", pinpoint.ServiceTypeGoApp)
+	ctx := pinpoint.NewContext(context.Background(), tracer)
+
+	err := validate(ctx, order)
+	if err == nil {
+		err = reserve(ctx, order)
+	}
+
+	tracer.EndSpanWithStatus(err)
+}
+
+func main() {
+	opts := []pinpoint.ConfigOption{
+		pinpoint.WithAppName("GoWorkflow"),
+		pinpoint.WithAgentId("GoWorkflowAgent"),
+		pinpoint.WithCollectorHost("localhost"),
+	}
+	c, _ := pinpoint.NewConfig(opts...)
+	agent, err := pinpoint.NewAgent(c)
+	if err != nil {
+		log.Fatalf("pinpoint agent start fail: %v", err)
+	}
+
+	for _, order := range []string{"order-1", "order-2"} {
+		processOrder(agent, order)
+	}
+	agent.Shutdown()
+}
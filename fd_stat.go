@@ -0,0 +1,33 @@
+package pinpoint
+
+import (
+	"os"
+	"syscall"
+)
+
+// openFileDescriptors returns the number of the open file descriptors of the process.
+// It is read from /proc/self/fd, so it returns false on the platforms without procfs.
+func openFileDescriptors() (int64, bool) {
+	dir, err := os.Open("/proc/self/fd")
+	if err != nil {
+		return 0, false
+	}
+	defer dir.Close()
+
+	names, err := dir.Readdirnames(-1)
+	if err != nil {
+		return 0, false
+	}
+
+	//the descriptor of the directory being read is counted
+	return int64(len(names) - 1), true
+}
+
+// fileDescriptorLimit returns the soft limit of the open file descriptors, or 0 if it is unknown.
+func fileDescriptorLimit() int64 {
+	var rlimit syscall.Rlimit
+	if err := syscall.Getrlimit(syscall.RLIMIT_NOFILE, &rlimit); err != nil {
+		return 0
+	}
+	return int64(rlimit.Cur)
+}
@@ -0,0 +1,96 @@
+package pinpoint
+
+import (
+	"context"
+	"fmt"
+	"runtime"
+)
+
+// FinalizeSpan ends the span of the tracer, and is to be deferred by a middleware or a worker goroutine right after the tracer is created.
+// If the handler panics, the panic is recorded as the error of the span with the stack of the panic, and the same value
+// is panicked again after the span is ended, so that the recovery of the framework still works.
+func FinalizeSpan(tracer Tracer) {
+	if r := recover(); r != nil {
+		recordPanic(tracer, r)
+		tracer.EndSpan()
+		panic(r)
+	}
+
+	tracer.EndSpan()
+}
+
+// FinalizeSpanWithContext is FinalizeSpan for a request with the context ctx.
+// If the deadline of ctx is exceeded or ctx is canceled when the span ends, the span is marked as failed
+// and the AnnotationContextError annotation classifies the failure as ContextErrorTimeout or ContextErrorCanceled.
+func FinalizeSpanWithContext(ctx context.Context, tracer Tracer) {
+	if r := recover(); r != nil {
+		recordPanic(tracer, r)
+		recordContextError(ctx, tracer)
+		tracer.EndSpan()
+		panic(r)
+	}
+
+	recordContextError(ctx, tracer)
+	tracer.EndSpan()
+}
+
+const defaultPanicStackDepth = 32
+
+// recordPanic records the recovered value r as the error of the span, and the stack of the panic as the
+// AnnotationErrorStack annotation, up to the depth set by WithSpanErrorStackDepth or 32 frames if it is not set.
+// It must be called by the deferred function which recovered r, while the stack of the panic is not unwound yet.
+func recordPanic(tracer Tracer, r interface{}) {
+	tracer.Span().SetError(fmt.Errorf("panic: %v", r))
+
+	s, ok := tracer.(*span)
+	if !ok {
+		return
+	}
+
+	depth := s.agent.Config().Span.ErrorStackDepth
+	if depth <= 0 {
+		depth = defaultPanicStackDepth
+	} else if depth > maxErrorStackDepth {
+		depth = maxErrorStackDepth
+	}
+
+	//the frames of the deferred calls are followed by runtime.gopanic and then the frames of the panic
+	pcs := make([]uintptr, depth+16)
+	n := runtime.Callers(3, pcs)
+	panicking := false
+	stack := formatFrames(runtime.CallersFrames(pcs[:n]), depth, func(f runtime.Frame) bool {
+		if !panicking {
+			panicking = f.Function == "runtime.gopanic"
+			return true
+		}
+		return false
+	})
+	s.annotations.AppendString(AnnotationErrorStack, stack)
+}
+
+func recordContextError(ctx context.Context, tracer Tracer) {
+	if ctx == nil {
+		return
+	}
+
+	var class string
+	switch ctx.Err() {
+	case context.DeadlineExceeded:
+		class = ContextErrorTimeout
+	case context.Canceled:
+		class = ContextErrorCanceled
+	default:
+		return
+	}
+
+	s, ok := tracer.(*span)
+	if !ok {
+		return
+	}
+
+	//the error returned by the handler is kept, but the failure is still classified by the context
+	if s.err == 0 {
+		s.SetError(ctx.Err())
+	}
+	s.annotations.AppendString(AnnotationContextError, class)
+}
@@ -284,18 +284,12 @@ var (
 	startLinePattern = regexp.MustCompile(`^goroutine\s+(\d+)\s+\[(.*)\]:$`)
 )
 
-func loadProfile(fn string) (*GoroutineDump, error) {
-	fn = strings.Trim(fn, "\"")
-	f, err := os.Open(fn)
-	if err != nil {
-		return nil, err
-	}
-	defer f.Close()
-
+func parseProfile(r io.Reader) (*GoroutineDump, error) {
+	var err error
 	dump := NewGoroutineDump()
 	var goroutine *Goroutine
 
-	scanner := bufio.NewScanner(f)
+	scanner := bufio.NewScanner(r)
 	for scanner.Scan() {
 		line := scanner.Text()
 		if startLinePattern.MatchString(line) {
@@ -0,0 +1,43 @@
+package pinpoint
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_parseProfile(t *testing.T) {
+	profile := `goroutine 1 [running]:
+main.main()
+	/app/main.go:10 +0x25
+
+goroutine 7 [chan receive, 3 minutes]:
+main.worker(0xc000010000)
+	/app/worker.go:20 +0x3a
+created by main.main
+	/app/main.go:8 +0x1c
+`
+	dump, err := parseProfile(strings.NewReader(profile))
+	assert.NoError(t, err, "parseProfile")
+	assert.Equal(t, 2, len(dump.goroutines), "goroutines")
+
+	g := dump.goroutines[0]
+	assert.Equal(t, 1, g.id, "id")
+	assert.Equal(t, "goroutine 1", g.header, "header")
+	assert.Equal(t, "running", g.metas[MetaState], "state")
+	assert.Equal(t, "main.main()\n\t/app/main.go:10 +0x25\n", g.trace, "trace")
+
+	g = dump.goroutines[1]
+	assert.Equal(t, 7, g.id, "id")
+	assert.Equal(t, "chan receive", g.metas[MetaState], "state")
+	assert.Equal(t, 3, g.duration, "duration")
+	assert.Equal(t, 5, g.lines, "lines")
+	assert.True(t, g.frozen, "frozen")
+}
+
+func Test_parseProfile_Empty(t *testing.T) {
+	dump, err := parseProfile(strings.NewReader(""))
+	assert.NoError(t, err, "parseProfile")
+	assert.Equal(t, 0, len(dump.goroutines), "goroutines")
+}
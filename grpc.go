@@ -2,20 +2,30 @@ package pinpoint
 
 import (
 	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
 	"fmt"
 	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/encoding"
 	"google.golang.org/grpc/keepalive"
 	"google.golang.org/grpc/status"
+	"io/ioutil"
 	"math"
 	"math/rand"
 	"net"
 	"os"
+	"sort"
 	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/golang/protobuf/ptypes/wrappers"
 	pb "github.com/pinpoint-apm/pinpoint-go-agent/protobuf"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/encoding/gzip"
 	"google.golang.org/grpc/metadata"
 )
 
@@ -34,17 +44,80 @@ func grpcMetadataContext(agent Agent, socketId int64) context.Context {
 	return metadata.NewOutgoingContext(context.Background(), md)
 }
 
-func backOffSleep(attempt int) {
-	base := float64(1 * time.Second)
-	max := float64(60 * time.Second)
+const streamRetryMaxElapsed = 30 * time.Minute
 
-	dur := base * math.Pow(2, float64(attempt))
-	if dur > max {
-		dur = max
+func backoffDelay(base time.Duration, max time.Duration, attempt int) time.Duration {
+	b := float64(base)
+	dur := b * math.Pow(2, float64(attempt))
+	if dur > float64(max) {
+		dur = float64(max)
 	}
 
-	jitter := time.Duration(rand.Float64()*(dur-base) + base)
-	time.Sleep(jitter)
+	return time.Duration(rand.Float64()*(dur-b) + b)
+}
+
+// streamBackoff is the reconnection state of a stream, kept across the retries of the stream.
+// The delay grows with the consecutive failures and is reset when a stream is made.
+// A retry gives up when it has been failing longer than maxElapsed,
+// and the next retry continues with the delay where it left off instead of starting over.
+// The delay is cut short when ctx, the connection context of the agent, is done.
+type streamBackoff struct {
+	ctx        context.Context
+	failures   int
+	maxElapsed time.Duration
+	base       time.Duration
+	max        time.Duration
+}
+
+func newStreamBackoff(ctx context.Context, config Config) streamBackoff {
+	return streamBackoff{
+		ctx:        ctx,
+		maxElapsed: streamRetryMaxElapsed,
+		base:       time.Duration(config.Collector.BackoffBase) * time.Millisecond,
+		max:        time.Duration(config.Collector.BackoffMax) * time.Millisecond,
+	}
+}
+
+// wait sleeps for the delay of the attempt, and returns false as soon as the context is done.
+func (b *streamBackoff) wait(ctx context.Context, attempt int) bool {
+	timer := time.NewTimer(backoffDelay(b.base, b.max, attempt))
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// retry calls newStream until it returns true, sleeping between the attempts.
+// It returns false if the agent is disabled or shut down, or the retry gives up.
+func (b *streamBackoff) retry(agent Agent, name string, newStream func() bool) bool {
+	start := time.Now()
+	ctx := b.ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	for agent.Enable() {
+		if newStream() {
+			log("grpc").Infof("success to make %s stream: %d", name, b.failures+1)
+			b.failures = 0
+			return true
+		}
+
+		b.failures++
+		if b.maxElapsed > 0 && time.Since(start) >= b.maxElapsed {
+			log("grpc").Errorf("give up making %s stream after %d failures", name, b.failures)
+			return false
+		}
+		if !b.wait(ctx, b.failures) {
+			return false
+		}
+	}
+
+	return false
 }
 
 type AgentGrpcClient interface {
@@ -74,20 +147,21 @@ type MetaGrpcClient interface {
 
 type metaGrpcClient struct {
 	client pb.MetadataClient
+	opts   []grpc.CallOption
 }
 
 func (metaGrpcClient *metaGrpcClient) RequestApiMetaData(ctx context.Context, in *pb.PApiMetaData) (*pb.PResult, error) {
-	result, err := metaGrpcClient.client.RequestApiMetaData(ctx, in)
+	result, err := metaGrpcClient.client.RequestApiMetaData(ctx, in, metaGrpcClient.opts...)
 	return result, err
 }
 
 func (metaGrpcClient *metaGrpcClient) RequestSqlMetaData(ctx context.Context, in *pb.PSqlMetaData) (*pb.PResult, error) {
-	result, err := metaGrpcClient.client.RequestSqlMetaData(ctx, in)
+	result, err := metaGrpcClient.client.RequestSqlMetaData(ctx, in, metaGrpcClient.opts...)
 	return result, err
 }
 
 func (metaGrpcClient *metaGrpcClient) RequestStringMetaData(ctx context.Context, in *pb.PStringMetaData) (*pb.PResult, error) {
-	result, err := metaGrpcClient.client.RequestStringMetaData(ctx, in)
+	result, err := metaGrpcClient.client.RequestStringMetaData(ctx, in, metaGrpcClient.opts...)
 	return result, err
 }
 
@@ -97,6 +171,7 @@ type agentGrpc struct {
 	metadataClient MetaGrpcClient
 	pingSocketId   int64
 	agent          Agent
+	backoff        streamBackoff
 }
 
 var kacp = keepalive.ClientParameters{
@@ -105,40 +180,244 @@ var kacp = keepalive.ClientParameters{
 	PermitWithoutStream: true,
 }
 
-func connectToCollectorWithRetry(serverAddr string, opts []grpc.DialOption) (*grpc.ClientConn, error) {
+func collectorDialOptions(agent Agent) ([]grpc.DialOption, error) {
+	var opts []grpc.DialOption
+
+	creds, err := collectorCredentials(agent.Config())
+	if err != nil {
+		return nil, err
+	}
+
+	opts = append(opts, creds)
+	opts = append(opts, grpc.WithKeepaliveParams(kacp))
+	opts = append(opts, grpc.WithBlock())
+
+	if dialer := collectorDialer(agent.Config()); dialer != nil {
+		opts = append(opts, grpc.WithContextDialer(dialer))
+	}
+
+	return opts, nil
+}
+
+// collectorCredentials returns the transport credentials of the collector connections,
+// which are loaded from the certificate files if TLS is enabled.
+func collectorCredentials(config Config) (grpc.DialOption, error) {
+	c := config.Collector
+	if !c.TLSEnabled {
+		return grpc.WithInsecure(), nil
+	}
+
+	tlsConfig := &tls.Config{}
+	if c.CACertFile != "" {
+		pem, err := ioutil.ReadFile(c.CACertFile)
+		if err != nil {
+			return nil, fmt.Errorf("fail to read CA certificate: %v", err)
+		}
+
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, errors.New("fail to parse CA certificate: " + c.CACertFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	if c.ClientCertFile != "" || c.ClientKeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(c.ClientCertFile, c.ClientKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("fail to load client certificate: %v", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	return grpc.WithTransportCredentials(credentials.NewTLS(tlsConfig)), nil
+}
+
+// streamCompressor returns the compressor of the span and stat streams, or "" if they are not compressed.
+// An unknown compressor is ignored, as the collector can't decode it.
+func streamCompressor(config Config) string {
+	name := config.Collector.Compression
+	if name == "" || name == "none" || encoding.GetCompressor(name) == nil {
+		return ""
+	}
+	return name
+}
+
+// collectorAddr joins the host and the port, putting an IPv6 host in brackets.
+// A host prefixed with the scheme of a gRPC resolver, such as consul:///pinpoint-collector, is passed through as it is,
+// since its endpoint is parsed by the resolver and is not a host to bracket.
+func collectorAddr(host string, port int) string {
+	if strings.Contains(host, "://") {
+		return host + ":" + strconv.Itoa(port)
+	}
+	return net.JoinHostPort(strings.Trim(host, "[]"), strconv.Itoa(port))
+}
+
+// collectorHost returns the host of a collector connection, falling back to the shared host
+func collectorHost(host string, shared string) string {
+	if host != "" {
+		return host
+	}
+	return shared
+}
+
+// collectorDialer returns the dialer of the collector connections if the resolver or the source address is set.
+// Both are applied by the same dialer, as gRPC takes only one.
+func collectorDialer(config Config) func(context.Context, string) (net.Conn, error) {
+	dialer := net.Dialer{Resolver: config.Collector.Resolver}
+	if src := config.Collector.SourceAddress; src != "" {
+		addr, err := sourceAddr(src)
+		if err != nil {
+			log("grpc").Errorf("fail to parse source address %s - %v", src, err)
+		} else {
+			dialer.LocalAddr = addr
+		}
+	}
+
+	if dialer.Resolver == nil && dialer.LocalAddr == nil {
+		return nil
+	}
+	return func(ctx context.Context, addr string) (net.Conn, error) {
+		return dialer.DialContext(ctx, "tcp", addr)
+	}
+}
+
+// sourceAddr parses an IP address, with or without a port, as the local address of a TCP connection
+func sourceAddr(src string) (*net.TCPAddr, error) {
+	host, port := src, "0"
+	if h, p, err := net.SplitHostPort(src); err == nil {
+		host, port = h, p
+	}
+
+	ip := net.ParseIP(strings.Trim(host, "[]"))
+	if ip == nil {
+		return nil, fmt.Errorf("invalid IP address: %s", host)
+	}
+	p, err := strconv.Atoi(port)
+	if err != nil {
+		return nil, err
+	}
+	return &net.TCPAddr{IP: ip, Port: p}, nil
+}
+
+// dialCollector connects to the collector, bounding the attempt with a deadline of the connect timeout
+// instead of the deprecated grpc.WithTimeout.
+func dialCollector(ctx context.Context, serverAddr string, opts []grpc.DialOption, config Config) (*grpc.ClientConn, error) {
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(config.Collector.ConnectTimeout)*time.Millisecond)
+	defer cancel()
+
+	log("grpc").Infof("connect to collector: %s", serverAddr)
+	return grpc.DialContext(ctx, serverAddr, opts...)
+}
+
+// connectToCollectorWithRetry dials the collector until it succeeds, the maximum attempts are made or the context is done.
+// It returns the last error if it gives up. The maximum of 0 retries without limit.
+func connectToCollectorWithRetry(ctx context.Context, serverAddr string, opts []grpc.DialOption, config Config) (*grpc.ClientConn, error) {
 	var conn *grpc.ClientConn
 	var err error
 
-	for n := 1; n < 100; n++ {
-		log("grpc").Infof("connect to collector: %s", serverAddr)
-		conn, err = grpc.Dial(serverAddr, opts...)
+	backoff := newStreamBackoff(ctx, config)
+	maxAttempts := config.Collector.MaxConnectAttempts
+	for n := 1; ; n++ {
+		conn, err = dialCollector(ctx, serverAddr, opts, config)
 		if err == nil {
 			break
 		}
 		log("grpc").Errorf("fail to dial - %v", err)
-		backOffSleep(n)
+
+		if maxAttempts > 0 && n >= maxAttempts {
+			log("grpc").Errorf("give up connecting to collector %s after %d attempts", serverAddr, n)
+			break
+		}
+		if !backoff.wait(ctx, n) {
+			err = ctx.Err()
+			break
+		}
 	}
 
 	return conn, err
 }
 
-func newAgentGrpc(agent Agent) (*agentGrpc, error) {
-	var opts []grpc.DialOption
+// replaced by tests to inject connection failures
+var (
+	dialAgentGrpc   = newAgentGrpc
+	dialSpanGrpc    = newSpanGrpc
+	dialStatGrpc    = newStatGrpc
+	dialCommandGrpc = newCommandGrpc
+)
 
-	opts = append(opts, grpc.WithInsecure())
-	opts = append(opts, grpc.WithKeepaliveParams(kacp))
-	opts = append(opts, grpc.WithBlock())
-	opts = append(opts, grpc.WithTimeout(3*time.Second))
+type grpcConns struct {
+	agent *agentGrpc
+	span  *spanGrpc
+	stat  *statGrpc
+	cmd   *cmdGrpc
+}
+
+func (c *grpcConns) close() {
+	if c.agent != nil {
+		c.agent.close()
+	}
+	if c.span != nil {
+		c.span.close()
+	}
+	if c.stat != nil {
+		c.stat.close()
+	}
+	if c.cmd != nil {
+		c.cmd.close()
+	}
+	*c = grpcConns{}
+}
+
+// dialGrpcConns opens all connections to the collector.
+// If one of them fails, the connections already opened are closed.
+func dialGrpcConns(ctx context.Context, agent Agent) (conns grpcConns, err error) {
+	defer func() {
+		if err != nil {
+			conns.close()
+		}
+	}()
+
+	if conns.agent, err = dialAgentGrpc(ctx, agent); err != nil {
+		return conns, err
+	}
+	if conns.span, err = dialSpanGrpc(ctx, agent); err != nil {
+		return conns, err
+	}
+	if conns.stat, err = dialStatGrpc(ctx, agent); err != nil {
+		return conns, err
+	}
+	if conns.cmd, err = dialCommandGrpc(ctx, agent); err != nil {
+		return conns, err
+	}
+	return conns, nil
+}
+
+func newAgentGrpc(ctx context.Context, agent Agent) (*agentGrpc, error) {
+	opts, err := collectorDialOptions(agent)
+	if err != nil {
+		return nil, err
+	}
 
-	serverAddr := fmt.Sprintf("%s:%d", agent.Config().Collector.Host, agent.Config().Collector.AgentPort)
-	conn, err := connectToCollectorWithRetry(serverAddr, opts)
+	config := agent.Config().Collector
+	serverAddr := collectorAddr(collectorHost(config.AgentHost, config.Host), config.AgentPort)
+	conn, err := connectToCollectorWithRetry(ctx, serverAddr, opts, agent.Config())
 	if err != nil {
 		return nil, err
 	}
 
 	agentClient := agentGrpcClient{pb.NewAgentClient(conn)}
-	metadataClient := metaGrpcClient{pb.NewMetadataClient(conn)}
-	return &agentGrpc{conn, &agentClient, &metadataClient, 0, agent}, nil
+	metadataClient := metaGrpcClient{pb.NewMetadataClient(conn), nil}
+	if agent.Config().Metadata.Compression {
+		metadataClient.opts = append(metadataClient.opts, grpc.UseCompressor(gzip.Name))
+	}
+	return &agentGrpc{
+		agentConn:      conn,
+		agentClient:    &agentClient,
+		metadataClient: &metadataClient,
+		pingSocketId:   0,
+		agent:          agent,
+		backoff:        newStreamBackoff(ctx, agent.Config()),
+	}, nil
 }
 
 func makeAgentInfo(agent Agent) (context.Context, *pb.PAgentInfo) {
@@ -152,12 +431,15 @@ func makeAgentInfo(agent Agent) (context.Context, *pb.PAgentInfo) {
 	}
 
 	agentinfo.Hostname = hostname
-	agentinfo.Ip = getOutboundIP().String()
+	agentinfo.Ip = getAgentIP(agent.Config().AgentIp, agent.Config().NetworkInterface).String()
 	agentinfo.ServiceType = agent.Config().ApplicationType
 	agentinfo.Container = agent.Config().IsContainer
 
 	var svrMeta pb.PServerMetaData
 	svrMeta.ServerInfo = "Go Agent"
+	for _, k := range sortedLabelKeys(agent.Config().Labels) {
+		svrMeta.VmArg = append(svrMeta.VmArg, k+"="+agent.Config().Labels[k])
+	}
 	agentinfo.ServerMetaData = &svrMeta
 
 	log("grpc").Infof("send agent information: %s", agentinfo.String())
@@ -167,17 +449,17 @@ func makeAgentInfo(agent Agent) (context.Context, *pb.PAgentInfo) {
 	return ctx, &agentinfo
 }
 
-func (agentGrpc *agentGrpc) sendAgentInfo() error {
+func (agentGrpc *agentGrpc) sendAgentInfo() (*pb.PResult, error) {
 	ctx, agentinfo := makeAgentInfo(agentGrpc.agent)
 	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
 	defer cancel()
 
-	_, err := agentGrpc.agentClient.RequestAgentInfo(ctx, agentinfo)
+	result, err := agentGrpc.agentClient.RequestAgentInfo(ctx, agentinfo)
 	if err != nil {
 		log("grpc").Errorf("fail to call RequestAgentInfo() - %v", err)
 	}
 
-	return err
+	return result, err
 }
 
 func (agentGrpc *agentGrpc) sendApiMetadata(apiId int32, api string, line int, apiType int) error {
@@ -241,6 +523,7 @@ func (agentGrpc *agentGrpc) sendSqlMetadata(sqlId int32, sql string) error {
 
 type pingStream struct {
 	stream pb.Agent_PingSessionClient
+	mux    sync.Mutex
 }
 
 func (agentGrpc *agentGrpc) newPingStream() *pingStream {
@@ -252,32 +535,32 @@ func (agentGrpc *agentGrpc) newPingStream() *pingStream {
 	stream, err := agentGrpc.agentClient.PingSession(ctx)
 	if err != nil {
 		log("grpc").Errorf("fail to make ping stream - %v", err)
-		return &pingStream{nil}
+		agentGrpc.agent.streams().recordError(streamPing, err)
+		return &pingStream{stream: nil}
 	}
 
-	return &pingStream{stream}
+	return &pingStream{stream: stream}
 }
 
 func (agentGrpc *agentGrpc) newPingStreamWithRetry() *pingStream {
-	for n := 1; n < 100; n++ {
-		if !agentGrpc.agent.Enable() {
-			break
-		}
-
-		s := agentGrpc.newPingStream()
-		if s.stream != nil {
-			log("grpc").Info("success to make ping stream: ", n)
-			return s
-		}
-		backOffSleep(n)
+	var s *pingStream
+	if agentGrpc.backoff.retry(agentGrpc.agent, "ping", func() bool {
+		s = agentGrpc.newPingStream()
+		return s.stream != nil
+	}) {
+		agentGrpc.agent.streams().recordConnect(streamPing)
+		return s
 	}
 
-	return &pingStream{nil}
+	return &pingStream{stream: nil}
 }
 
 var ping = pb.PPing{}
 
 func (s *pingStream) sendPing() error {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
 	if s.stream == nil {
 		return status.Errorf(codes.Unavailable, "ping stream is nil")
 	}
@@ -286,18 +569,117 @@ func (s *pingStream) sendPing() error {
 }
 
 func (s *pingStream) close() {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
 	if s.stream != nil {
 		s.stream.CloseSend()
 		s.stream = nil
 	}
 }
 
+// closeGracefully half-closes the stream and waits until the collector ends it.
+// The collector records a ping session ended this way as a shutdown of the agent,
+// and a broken connection as an unexpected close.
+func (s *pingStream) closeGracefully(timeout time.Duration) bool {
+	s.mux.Lock()
+	stream := s.stream
+	s.stream = nil
+	s.mux.Unlock()
+
+	if stream == nil {
+		return false
+	}
+
+	if err := stream.CloseSend(); err != nil {
+		log("grpc").Errorf("fail to close ping stream - %v", err)
+		return false
+	}
+
+	done := make(chan struct{})
+	go func() {
+		for {
+			if _, err := stream.Recv(); err != nil {
+				break
+			}
+		}
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return true
+	case <-time.After(timeout):
+		log("grpc").Warn("ping stream is not closed by the collector in ", timeout)
+		return false
+	}
+}
+
 func (agentGrpc *agentGrpc) close() {
 	agentGrpc.agentConn.Close()
 }
 
+func getAgentIP(agentIp string, ifaceName string) net.IP {
+	if agentIp != "" {
+		if ip := net.ParseIP(agentIp); ip != nil {
+			return ip
+		}
+		log("grpc").Warnf("invalid agent ip %s, the agent ip is detected", agentIp)
+	}
+
+	if ifaceName != "" {
+		ip, err := getInterfaceIP(ifaceName)
+		if err == nil {
+			return ip
+		}
+		log("grpc").Errorf("fail to get the address of network interface %s - %v", ifaceName, err)
+	}
+
+	return getOutboundIP()
+}
+
+// replaced by tests to stub the network interfaces of the host
+var interfaceAddrs = func(ifaceName string) ([]net.Addr, error) {
+	iface, err := net.InterfaceByName(ifaceName)
+	if err != nil {
+		return nil, err
+	}
+	return iface.Addrs()
+}
+
+func getInterfaceIP(ifaceName string) (net.IP, error) {
+	addrs, err := interfaceAddrs(ifaceName)
+	if err != nil {
+		return nil, err
+	}
+
+	var found net.IP
+	for _, addr := range addrs {
+		ipNet, ok := addr.(*net.IPNet)
+		if !ok || ipNet.IP.IsLoopback() {
+			continue
+		}
+
+		if ipNet.IP.To4() != nil {
+			return ipNet.IP, nil
+		}
+		if found == nil {
+			found = ipNet.IP
+		}
+	}
+
+	if found == nil {
+		return nil, fmt.Errorf("no address on network interface %s", ifaceName)
+	}
+	return found, nil
+}
+
 func getOutboundIP() net.IP {
-	conn, _ := net.Dial("udp", "8.8.8.8:80")
+	conn, err := net.Dial("udp", "8.8.8.8:80")
+	if err != nil {
+		log("grpc").Errorf("fail to get outbound ip - %v", err)
+		return net.IPv4zero
+	}
 	defer conn.Close()
 
 	localAddr := conn.LocalAddr().(*net.UDPAddr)
@@ -322,6 +704,7 @@ type spanGrpc struct {
 	spanClient SpanGrpcClient
 	stream     SpanStreamInvoker
 	agent      Agent
+	backoff    streamBackoff
 }
 
 type SpanStreamInvoker interface {
@@ -351,26 +734,31 @@ type spanStream struct {
 	stream SpanStreamInvoker
 }
 
-func newSpanGrpc(agent Agent) (*spanGrpc, error) {
-	var opts []grpc.DialOption
+func newSpanGrpc(ctx context.Context, agent Agent) (*spanGrpc, error) {
+	opts, err := collectorDialOptions(agent)
+	if err != nil {
+		return nil, err
+	}
 
-	opts = append(opts, grpc.WithInsecure())
-	opts = append(opts, grpc.WithKeepaliveParams(kacp))
-	opts = append(opts, grpc.WithBlock())
-	opts = append(opts, grpc.WithTimeout(3*time.Second))
+	if compressor := streamCompressor(agent.Config()); compressor != "" {
+		opts = append(opts, grpc.WithDefaultCallOptions(grpc.UseCompressor(compressor)))
+	}
 
-	serverAddr := fmt.Sprintf("%s:%d", agent.Config().Collector.Host, agent.Config().Collector.SpanPort)
-	conn, err := connectToCollectorWithRetry(serverAddr, opts)
+	config := agent.Config().Collector
+	serverAddr := collectorAddr(collectorHost(config.SpanHost, config.Host), config.SpanPort)
+	conn, err := connectToCollectorWithRetry(ctx, serverAddr, opts, agent.Config())
 	if err != nil {
 		return nil, err
 	}
 
 	client := spanGrpcClient{pb.NewSpanClient(conn)}
-	return &spanGrpc{conn, &client, nil, agent}, nil
+	return &spanGrpc{conn, &client, nil, agent, newStreamBackoff(ctx, agent.Config())}, nil
 }
 
 func (spanGrpc *spanGrpc) close() {
-	spanGrpc.spanConn.Close()
+	if spanGrpc.spanConn != nil {
+		spanGrpc.spanConn.Close()
+	}
 }
 
 func (spanGrpc *spanGrpc) newSpanStream() *spanStream {
@@ -384,6 +772,7 @@ func (spanGrpc *spanGrpc) newSpanStream() *spanStream {
 	stream, err := spanGrpc.spanClient.SendSpan(ctx)
 	if err != nil {
 		log("grpc").Errorf("fail to make span stream - %v", err)
+		spanGrpc.agent.streams().recordError(streamSpan, err)
 		return &spanStream{nil}
 	}
 
@@ -391,17 +780,13 @@ func (spanGrpc *spanGrpc) newSpanStream() *spanStream {
 }
 
 func (spanGrpc *spanGrpc) newSpanStreamWithRetry() *spanStream {
-	for n := 1; n < 100; n++ {
-		if !spanGrpc.agent.Enable() {
-			break
-		}
-
-		s := spanGrpc.newSpanStream()
-		if s.stream != nil {
-			log("grpc").Info("success to make span stream: ", n)
-			return s
-		}
-		backOffSleep(n)
+	var s *spanStream
+	if spanGrpc.backoff.retry(spanGrpc.agent, "span", func() bool {
+		s = spanGrpc.newSpanStream()
+		return s.stream != nil
+	}) {
+		spanGrpc.agent.streams().recordConnect(streamSpan)
+		return s
 	}
 
 	return &spanStream{nil}
@@ -424,31 +809,53 @@ func (s *spanStream) close() {
 }
 
 func (s *spanStream) sendSpan(span *span) error {
-	var gspan *pb.PSpanMessage
-
 	if s.stream == nil {
 		return status.Errorf(codes.Unavailable, "span stream is nil")
 	}
 
-	if span.asyncId == 0 {
-		gspan = makePSpan(span)
-	} else {
-		gspan = makePSpanChunk(span)
-	}
-
+	start := time.Now()
+	gspan := makePSpanMessage(span)
+	build := time.Since(start)
 	log("grpc").Debug("PSpanMessage: ", gspan.String())
 
-	return s.stream.Send(gspan)
+	start = time.Now()
+	err := s.stream.Send(gspan)
+	collectSpanOverhead(build, time.Since(start))
+	return err
+}
+
+func sortedLabelKeys(labels map[string]string) []string {
+	keys := make([]string, 0, len(labels))
+	for k := range labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func makePSpanMessage(span *span) *pb.PSpanMessage {
+	if span.asyncId == 0 {
+		return makePSpan(span)
+	}
+	return makePSpanChunk(span)
 }
 
 func makePSpan(span *span) *pb.PSpanMessage {
-	span.annotations.AppendString(12, span.operationName)
+	config := span.agent.Config()
+	labels := config.Labels
 
-	spanEventList := make([]*pb.PSpanEvent, 0)
-	for _, event := range span.spanEvents {
-		aSpanEvent := makePSpanEvent(event)
-		spanEventList = append(spanEventList, aSpanEvent)
+	var annotations annotation
+	annotations.list = make([]*pb.PAnnotation, 0, 1+len(labels)+len(span.annotations.list))
+	annotations.AppendString(config.Annotation.OperationNameKey, span.operationName)
+	for _, k := range sortedLabelKeys(labels) {
+		annotations.AppendStringString(AnnotationLabel, k, labels[k])
 	}
+	annotations.list = append(annotations.list, span.annotations.list...)
+	if span.duration < microElapsedUnder(config) {
+		annotations.appendLong(AnnotationElapsedMicros, toMicroseconds(span.duration))
+	}
+
+	spanEventList := makePSpanEventList(span.spanEvents, config.Annotation.OperationNameKey, microElapsedUnder(config))
 
 	gspan := &pb.PSpanMessage{
 		Field: &pb.PSpanMessage_Span{
@@ -462,7 +869,7 @@ func makePSpan(span *span) *pb.PSpanMessage {
 				SpanId:       span.spanId,
 				ParentSpanId: span.parentSpanId,
 				StartTime:    span.startTime.UnixNano() / int64(time.Millisecond),
-				Elapsed:      int32(toMilliseconds(span.duration)),
+				Elapsed:      elapsedMilliseconds(span.duration),
 				ServiceType:  span.serviceType,
 				AcceptEvent: &pb.PAcceptEvent{
 					Rpc:        span.rpcName,
@@ -470,12 +877,11 @@ func makePSpan(span *span) *pb.PSpanMessage {
 					RemoteAddr: span.remoteAddr,
 					ParentInfo: nil,
 				},
-				Annotation:             span.annotations.list,
+				Annotation:             annotations.list,
 				Flag:                   int32(span.flags),
 				SpanEvent:              spanEventList,
 				Err:                    int32(span.err),
-				ExceptionInfo:          nil, //TODO
-				ApplicationServiceType: span.agent.Config().ApplicationType,
+				ApplicationServiceType: config.ApplicationType,
 				LoggingTransactionInfo: span.loggingInfo,
 			},
 		},
@@ -495,15 +901,19 @@ func makePSpan(span *span) *pb.PSpanMessage {
 		gspan.GetSpan().ApiId = span.apiId
 	}
 
+	if span.errorString != "" {
+		gspan.GetSpan().ExceptionInfo = &pb.PIntStringValue{
+			IntValue:    span.errorFuncId,
+			StringValue: &wrappers.StringValue{Value: span.errorString},
+		}
+	}
+
 	return gspan
 }
 
 func makePSpanChunk(span *span) *pb.PSpanMessage {
-	spanEventList := make([]*pb.PSpanEvent, 0)
-	for _, event := range span.spanEvents {
-		aSpanEvent := makePSpanEvent(event)
-		spanEventList = append(spanEventList, aSpanEvent)
-	}
+	config := span.agent.Config()
+	spanEventList := makePSpanEventList(span.spanEvents, config.Annotation.OperationNameKey, microElapsedUnder(config))
 
 	gspan := &pb.PSpanMessage{
 		Field: &pb.PSpanMessage_SpanChunk{
@@ -518,7 +928,7 @@ func makePSpanChunk(span *span) *pb.PSpanMessage {
 				KeyTime:                span.startTime.UnixNano() / int64(time.Millisecond),
 				EndPoint:               span.endPoint,
 				SpanEvent:              spanEventList,
-				ApplicationServiceType: span.agent.Config().ApplicationType,
+				ApplicationServiceType: config.ApplicationType,
 				LocalAsyncId: &pb.PLocalAsyncId{
 					AsyncId:  span.asyncId,
 					Sequence: span.asyncSequence,
@@ -530,24 +940,50 @@ func makePSpanChunk(span *span) *pb.PSpanMessage {
 	return gspan
 }
 
-func makePSpanEvent(event *spanEvent) *pb.PSpanEvent {
-	if event.apiId == 0 && event.operationName != "" {
-		event.annotations.AppendString(12, event.operationName)
+// makePSpanEventList allocates the span events at once, as spans of a high throughput service can have many of them.
+func makePSpanEventList(events []*spanEvent, operationNameKey int32, microUnder time.Duration) []*pb.PSpanEvent {
+	pevents := make([]pb.PSpanEvent, len(events))
+	list := make([]*pb.PSpanEvent, len(events))
+	for i, event := range events {
+		fillPSpanEvent(&pevents[i], event, operationNameKey, microUnder)
+		list[i] = &pevents[i]
 	}
+	return list
+}
+
+// microElapsedUnder returns the elapsed time under which the elapsed microseconds are recorded,
+// as the collector stores the elapsed time of spans and span events in milliseconds.
+func microElapsedUnder(config Config) time.Duration {
+	return time.Duration(config.Annotation.MicroElapsedUnder) * time.Millisecond
+}
 
-	aSpanEvent := pb.PSpanEvent{
-		Sequence:      event.sequence,
-		Depth:         event.depth,
-		StartElapsed:  int32(toMilliseconds(event.startElapsed)),
-		EndElapsed:    int32(toMilliseconds(event.duration)),
-		ServiceType:   event.serviceType,
-		Annotation:    event.annotations.list,
-		ApiId:         event.apiId,
-		ExceptionInfo: nil,
-		NextEvent:     nil,
-		AsyncEvent:    event.asyncId,
+func fillPSpanEvent(aSpanEvent *pb.PSpanEvent, event *spanEvent, operationNameKey int32, microUnder time.Duration) {
+	//the annotations of the ended event are not modified, so they are shared if nothing is added
+	var annotations annotation
+	named := event.apiId == 0 && event.operationName != ""
+	micro := event.duration < microUnder
+	if named || micro {
+		annotations.list = make([]*pb.PAnnotation, 0, 2+len(event.annotations.list))
+		if named {
+			annotations.AppendString(operationNameKey, event.operationName)
+		}
+		annotations.list = append(annotations.list, event.annotations.list...)
+		if micro {
+			annotations.appendLong(AnnotationElapsedMicros, toMicroseconds(event.duration))
+		}
+	} else {
+		annotations.list = event.annotations.list
 	}
 
+	aSpanEvent.Sequence = event.sequence
+	aSpanEvent.Depth = event.depth
+	aSpanEvent.StartElapsed = elapsedMilliseconds(event.startElapsed)
+	aSpanEvent.EndElapsed = elapsedMilliseconds(event.duration)
+	aSpanEvent.ServiceType = event.serviceType
+	aSpanEvent.Annotation = annotations.list
+	aSpanEvent.ApiId = event.apiId
+	aSpanEvent.AsyncEvent = event.asyncId
+
 	if event.errorString != "" {
 		aSpanEvent.ExceptionInfo = &pb.PIntStringValue{
 			IntValue:    event.errorFuncId,
@@ -555,21 +991,19 @@ func makePSpanEvent(event *spanEvent) *pb.PSpanEvent {
 		}
 	}
 
-	if event.destinationId != "" {
+	if destination := event.destination(); destination != "" {
 		next := &pb.PNextEvent{
 			Field: &pb.PNextEvent_MessageEvent{
 				MessageEvent: &pb.PMessageEvent{
 					NextSpanId:    event.nextSpanId,
 					EndPoint:      event.endPoint,
-					DestinationId: event.destinationId,
+					DestinationId: destination,
 				},
 			},
 		}
 
 		aSpanEvent.NextEvent = next
 	}
-
-	return &aSpanEvent
 }
 
 func (s *spanStream) sendSpanFinish() {
@@ -593,6 +1027,7 @@ type statGrpc struct {
 	statClient StatGrpcClient
 	stream     StatStreamInvoker
 	agent      Agent
+	backoff    streamBackoff
 }
 
 type StatStreamInvoker interface {
@@ -622,22 +1057,25 @@ type statStream struct {
 	stream StatStreamInvoker
 }
 
-func newStatGrpc(agent Agent) (*statGrpc, error) {
-	var opts []grpc.DialOption
+func newStatGrpc(ctx context.Context, agent Agent) (*statGrpc, error) {
+	opts, err := collectorDialOptions(agent)
+	if err != nil {
+		return nil, err
+	}
 
-	opts = append(opts, grpc.WithInsecure())
-	opts = append(opts, grpc.WithKeepaliveParams(kacp))
-	opts = append(opts, grpc.WithBlock())
-	opts = append(opts, grpc.WithTimeout(3*time.Second))
+	if compressor := streamCompressor(agent.Config()); compressor != "" {
+		opts = append(opts, grpc.WithDefaultCallOptions(grpc.UseCompressor(compressor)))
+	}
 
-	serverAddr := fmt.Sprintf("%s:%d", agent.Config().Collector.Host, agent.Config().Collector.StatPort)
-	conn, err := connectToCollectorWithRetry(serverAddr, opts)
+	config := agent.Config().Collector
+	serverAddr := collectorAddr(collectorHost(config.StatHost, config.Host), config.StatPort)
+	conn, err := connectToCollectorWithRetry(ctx, serverAddr, opts, agent.Config())
 	if err != nil {
 		return nil, err
 	}
 
 	client := &statGrpcClient{pb.NewStatClient(conn)}
-	return &statGrpc{conn, client, nil, agent}, nil
+	return &statGrpc{conn, client, nil, agent, newStreamBackoff(ctx, agent.Config())}, nil
 }
 
 func (statGrpc *statGrpc) close() {
@@ -652,6 +1090,7 @@ func (statGrpc *statGrpc) newStatStream() *statStream {
 	stream, err := statGrpc.statClient.SendAgentStat(ctx)
 	if err != nil {
 		log("grpc").Errorf("fail to make stat stream - %v", err)
+		statGrpc.agent.streams().recordError(streamStat, err)
 		return &statStream{nil}
 	}
 
@@ -659,17 +1098,13 @@ func (statGrpc *statGrpc) newStatStream() *statStream {
 }
 
 func (statGrpc *statGrpc) newStatStreamWithRetry() *statStream {
-	for n := 1; n < 100; n++ {
-		if !statGrpc.agent.Enable() {
-			break
-		}
-
-		s := statGrpc.newStatStream()
-		if s.stream != nil {
-			log("grpc").Info("success to make stat stream: ", n)
-			return s
-		}
-		backOffSleep(n)
+	var s *statStream
+	if statGrpc.backoff.retry(statGrpc.agent, "stat", func() bool {
+		s = statGrpc.newStatStream()
+		return s.stream != nil
+	}) {
+		statGrpc.agent.streams().recordConnect(streamStat)
+		return s
 	}
 
 	return &statStream{nil}
@@ -714,22 +1149,47 @@ func (s *statStream) sendStats(stats []*inspectorStats) error {
 
 	log("grpc").Debug("PStatMessage: ", gstats.String())
 
-	return s.stream.Send(gstats)
+	if err := s.stream.Send(gstats); err != nil {
+		return err
+	}
+
+	//the URI stats are sent in their own messages after the agent stats of the same samples
+	for _, stat := range stats {
+		if len(stat.uriStats) == 0 {
+			continue
+		}
+
+		ustats := &pb.PStatMessage{
+			Field: &pb.PStatMessage_AgentUriStat{
+				AgentUriStat: makePAgentUriStat(stat),
+			},
+		}
+		log("grpc").Debug("PStatMessage: ", ustats.String())
+
+		if err := s.stream.Send(ustats); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
 func makePAgentStat(stat *inspectorStats) *pb.PAgentStat {
 	return &pb.PAgentStat{
 		Timestamp:       stat.sampleTime.UnixNano() / int64(time.Millisecond),
-		CollectInterval: 5000,
+		CollectInterval: stat.collectInterval,
 		Gc: &pb.PJvmGc{
 			Type:                 1,
 			JvmMemoryHeapUsed:    stat.heapAlloc,
 			JvmMemoryHeapMax:     stat.heapMax,
 			JvmMemoryNonHeapUsed: stat.nonHeapAlloc,
-			JvmMemoryNonHeapMax:  stat.nonHeapAlloc + 1000,
+			JvmMemoryNonHeapMax:  stat.nonHeapMax,
 			JvmGcOldCount:        stat.gcNum,
 			JvmGcOldTime:         stat.gcTime,
-			JvmGcDetailed:        nil,
+			JvmGcDetailed: &pb.PJvmGcDetailed{
+				//Go has a single non-generational GC, so each cycle is also counted as a new GC for the detailed GC chart
+				JvmGcNewCount: stat.gcNum,
+				JvmGcNewTime:  stat.gcTime,
+			},
 		},
 		CpuLoad: &pb.PCpuLoad{
 			JvmCpuLoad:    stat.cpuUserTime,
@@ -756,9 +1216,52 @@ func makePAgentStat(stat *inspectorStats) *pb.PAgentStat {
 			Max: stat.responseMax,
 		},
 		Deadlock:       nil,
-		FileDescriptor: nil,
-		DirectBuffer:   nil,
-		Metadata:       "",
+		FileDescriptor: makePFileDescriptor(stat),
+		DirectBuffer:   makePDirectBuffer(stat),
+		Metadata:       encodeCustomStats(stat.customStats),
+	}
+}
+
+func makePAgentUriStat(stat *inspectorStats) *pb.PAgentUriStat {
+	timestamp := stat.sampleTime.UnixNano() / int64(time.Millisecond)
+	each := make([]*pb.PEachUriStat, 0, len(stat.uriStats))
+	for _, u := range stat.uriStats {
+		each = append(each, &pb.PEachUriStat{
+			Uri:             u.Uri,
+			TotalHistogram:  makePUriHistogram(u.TotalTime, u.MaxTime, u.Histogram),
+			FailedHistogram: makePUriHistogram(u.FailedTotalTime, u.FailedMaxTime, u.FailedHistogram),
+			Timestamp:       timestamp,
+		})
+	}
+
+	return &pb.PAgentUriStat{
+		BucketVersion: uriStatBucketVersion,
+		EachUriStat:   each,
+	}
+}
+
+func makePUriHistogram(total int64, max int64, histogram []int64) *pb.PUriHistogram {
+	counts := make([]int32, len(histogram))
+	for i, c := range histogram {
+		counts[i] = int32(c)
+	}
+	return &pb.PUriHistogram{Total: total, Max: max, Histogram: counts}
+}
+
+func makePFileDescriptor(stat *inspectorStats) *pb.PFileDescriptor {
+	if stat.fdCount < 0 {
+		return nil
+	}
+	return &pb.PFileDescriptor{OpenFileDescriptorCount: stat.fdCount}
+}
+
+// makePDirectBuffer maps the memory of the Go runtime out of the heap onto the direct buffer chart of the collector.
+// The direct memory is the memory of the runtime itself, and the mapped memory the idle heap retained by the runtime.
+// The Go runtime has no count of buffers, so the direct and mapped counts are left unset.
+func makePDirectBuffer(stat *inspectorStats) *pb.PDirectBuffer {
+	return &pb.PDirectBuffer{
+		DirectMemoryUsed: stat.offHeap,
+		MappedMemoryUsed: stat.heapRetained,
 	}
 }
 
@@ -766,6 +1269,7 @@ type cmdGrpc struct {
 	agentConn *grpc.ClientConn
 	cmdClient pb.ProfilerCommandServiceClient
 	agent     Agent
+	backoff   streamBackoff
 }
 
 type cmdStream struct {
@@ -773,25 +1277,27 @@ type cmdStream struct {
 	cmdReq *pb.PCmdRequest
 }
 
-func newCommandGrpc(agent Agent) (*cmdGrpc, error) {
-	var opts []grpc.DialOption
-
-	opts = append(opts, grpc.WithInsecure())
-	opts = append(opts, grpc.WithKeepaliveParams(kacp))
-	opts = append(opts, grpc.WithBlock())
-	opts = append(opts, grpc.WithTimeout(3*time.Second))
+func newCommandGrpc(ctx context.Context, agent Agent) (*cmdGrpc, error) {
+	opts, err := collectorDialOptions(agent)
+	if err != nil {
+		return nil, err
+	}
 
-	serverAddr := fmt.Sprintf("%s:%d", agent.Config().Collector.Host, agent.Config().Collector.AgentPort)
+	config := agent.Config().Collector
+	serverAddr := collectorAddr(collectorHost(config.CommandHost, config.Host), config.AgentPort)
 
-	log("grpc").Infof("connect to agent collector: %s", serverAddr)
-	conn, err := grpc.Dial(serverAddr, opts...)
+	conn, err := dialCollector(ctx, serverAddr, opts, agent.Config())
 	if err != nil {
 		log("grpc").Errorf("fail to dial - %v", err)
 		return nil, err
 	}
 
 	cmdClient := pb.NewProfilerCommandServiceClient(conn)
-	return &cmdGrpc{conn, cmdClient, agent}, nil
+	return &cmdGrpc{conn, cmdClient, agent, newStreamBackoff(ctx, agent.Config())}, nil
+}
+
+func (cmdGrpc *cmdGrpc) close() {
+	cmdGrpc.agentConn.Close()
 }
 
 func (cmdGrpc *cmdGrpc) newHandleCommandStream() *cmdStream {
@@ -802,6 +1308,7 @@ func (cmdGrpc *cmdGrpc) newHandleCommandStream() *cmdStream {
 	stream, err := cmdGrpc.cmdClient.HandleCommand(ctx)
 	if err != nil {
 		log("grpc").Errorf("fail to make command stream - %v", err)
+		cmdGrpc.agent.streams().recordError(streamCommand, err)
 		return &cmdStream{nil, nil}
 	}
 
@@ -809,17 +1316,13 @@ func (cmdGrpc *cmdGrpc) newHandleCommandStream() *cmdStream {
 }
 
 func (cmdGrpc *cmdGrpc) newCommandStreamWithRetry() *cmdStream {
-	for n := 1; n < 100; n++ {
-		if !cmdGrpc.agent.Enable() {
-			break
-		}
-
-		s := cmdGrpc.newHandleCommandStream()
-		if s.stream != nil {
-			log("grpc").Info("success to make command stream: ", n)
-			return s
-		}
-		backOffSleep(n)
+	var s *cmdStream
+	if cmdGrpc.backoff.retry(cmdGrpc.agent, "command", func() bool {
+		s = cmdGrpc.newHandleCommandStream()
+		return s.stream != nil
+	}) {
+		cmdGrpc.agent.streams().recordConnect(streamCommand)
+		return s
 	}
 
 	return &cmdStream{nil, nil}
@@ -837,6 +1340,17 @@ func (s *cmdStream) close() {
 	s.stream = nil
 }
 
+func (s *cmdStream) closeSend() {
+	if s.stream == nil {
+		return
+	}
+
+	err := s.stream.CloseSend()
+	if err != nil {
+		log("grpc").Errorf("fail to close command stream - %v", err)
+	}
+}
+
 func (s *cmdStream) sendCommandMessage() error {
 	var gCmd *pb.PCmdMessage
 
@@ -872,7 +1386,6 @@ func (s *cmdStream) recvCommandRequest() error {
 
 	gCmdReq, err := s.stream.Recv()
 	if err != nil {
-		log("grpc").Errorf("fail to recv command request - %v", err)
 		return err
 	}
 
@@ -882,6 +1395,29 @@ func (s *cmdStream) recvCommandRequest() error {
 	return nil
 }
 
+type cmdRecvResult struct {
+	cmdReq *pb.PCmdRequest
+	err    error
+}
+
+// recvCommandRequests receives the command requests on a new goroutine until the stream fails or ends,
+// and the last result has the error. The caller must receive the results until the error.
+func (s *cmdStream) recvCommandRequests() <-chan cmdRecvResult {
+	results := make(chan cmdRecvResult)
+
+	go func() {
+		for {
+			err := s.recvCommandRequest()
+			results <- cmdRecvResult{s.cmdReq, err}
+			if err != nil {
+				return
+			}
+		}
+	}()
+
+	return results
+}
+
 type activeThreadCountStream struct {
 	stream   pb.ProfilerCommandService_CommandStreamActiveThreadCountClient
 	reqId    int32
@@ -1,9 +1,19 @@
 package pinpoint
 
 import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/golang/mock/gomock"
+	pb "github.com/pinpoint-apm/pinpoint-go-agent/protobuf"
 	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/connectivity"
 )
 
 func Test_agentGrpc_sendAgentInfo(t *testing.T) {
@@ -20,7 +30,7 @@ func Test_agentGrpc_sendAgentInfo(t *testing.T) {
 		t.Run(tt.name, func(t *testing.T) {
 			agent := tt.args.agent.(*mockAgent)
 			agent.setMockAgentGrpc(t)
-			err := agent.agentGrpc.sendAgentInfo()
+			_, err := agent.agentGrpc.sendAgentInfo()
 			assert.NoError(t, err, "sendAgentInfo")
 		})
 	}
@@ -156,3 +166,415 @@ func Test_statStream_sendStat(t *testing.T) {
 		})
 	}
 }
+
+// recordingStatStreamInvoker keeps the stat messages sent to it.
+type recordingStatStreamInvoker struct {
+	sent []*pb.PStatMessage
+}
+
+func (invoker *recordingStatStreamInvoker) Send(stat *pb.PStatMessage) error {
+	invoker.sent = append(invoker.sent, stat)
+	return nil
+}
+
+func (invoker *recordingStatStreamInvoker) CloseAndRecv() error {
+	return nil
+}
+
+func (invoker *recordingStatStreamInvoker) CloseSend() error {
+	return nil
+}
+
+func Test_statStream_sendStats_UriStat(t *testing.T) {
+	invoker := &recordingStatStreamInvoker{}
+	stream := &statStream{invoker}
+
+	stats := []*inspectorStats{
+		{sampleTime: time.Unix(10, 0), activeSpan: []int32{0, 0, 0, 0}},
+		{sampleTime: time.Unix(20, 0), activeSpan: []int32{0, 0, 0, 0}, uriStats: []UriStat{{
+			Uri:             "/login",
+			Count:           1,
+			TotalTime:       50,
+			MaxTime:         50,
+			Histogram:       []int64{1, 0, 0, 0, 0, 0, 0, 0},
+			FailedHistogram: []int64{0, 0, 0, 0, 0, 0, 0, 0},
+		}}},
+	}
+	assert.NoError(t, stream.sendStats(stats), "sendStats")
+
+	assert.Equal(t, 2, len(invoker.sent), "messages")
+	assert.Equal(t, 2, len(invoker.sent[0].GetAgentStatBatch().GetAgentStat()), "agent stats")
+	u := invoker.sent[1].GetAgentUriStat()
+	assert.NotNil(t, u, "uri stat")
+	assert.Equal(t, "/login", u.GetEachUriStat()[0].GetUri(), "uri")
+	assert.Equal(t, int64(20000), u.GetEachUriStat()[0].GetTimestamp(), "timestamp")
+}
+
+func Test_getInterfaceIP(t *testing.T) {
+	ipNet := func(s string) net.Addr {
+		ip, n, _ := net.ParseCIDR(s)
+		return &net.IPNet{IP: ip, Mask: n.Mask}
+	}
+	ifaces := map[string][]net.Addr{
+		"lo":   {ipNet("127.0.0.1/8"), ipNet("::1/128")},
+		"eth0": {ipNet("fe80::1/64"), ipNet("10.0.0.5/24")},
+		"eth1": {ipNet("fd00::5/64")},
+		"eth2": {&net.IPAddr{IP: net.ParseIP("10.0.0.6")}},
+	}
+
+	orig := interfaceAddrs
+	defer func() { interfaceAddrs = orig }()
+	interfaceAddrs = func(ifaceName string) ([]net.Addr, error) {
+		addrs, ok := ifaces[ifaceName]
+		if !ok {
+			return nil, errors.New("no such network interface")
+		}
+		return addrs, nil
+	}
+
+	tests := []struct {
+		name    string
+		iface   string
+		want    string
+		wantErr bool
+	}{
+		{"unknown interface", "no-such-interface", "", true},
+		{"loopback only", "lo", "", true},
+		{"ipv4 first", "eth0", "10.0.0.5", false},
+		{"ipv6 only", "eth1", "fd00::5", false},
+		{"not an ip network", "eth2", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ip, err := getInterfaceIP(tt.iface)
+			if tt.wantErr {
+				assert.Error(t, err, "getInterfaceIP")
+				return
+			}
+			assert.NoError(t, err, "getInterfaceIP")
+			assert.Equal(t, tt.want, ip.String(), "ip")
+		})
+	}
+
+	assert.Equal(t, "10.0.0.5", getAgentIP("", "eth0").String(), "interface")
+	assert.NotNil(t, getAgentIP("", "no-such-interface"), "fallback")
+}
+
+func Test_getAgentIP(t *testing.T) {
+	assert.Equal(t, "10.0.0.5", getAgentIP("10.0.0.5", "no-such-interface").String(), "ipv4")
+	assert.Equal(t, "fd00::5", getAgentIP("fd00::5", "").String(), "ipv6")
+	assert.NotNil(t, getAgentIP("not-an-ip", ""), "fallback")
+}
+
+func Test_collectorCredentials(t *testing.T) {
+	tests := []struct {
+		name    string
+		opts    []ConfigOption
+		wantErr bool
+	}{
+		{"insecure", nil, false},
+		{"tls", []ConfigOption{WithCollectorTLS(true)}, false},
+		{"no ca file", []ConfigOption{WithCollectorTLS(true), WithCollectorCACertFile("/nonexistent/ca.pem")}, true},
+		{"no client cert", []ConfigOption{WithCollectorTLS(true), WithCollectorClientCert("/nonexistent/cert.pem", "/nonexistent/key.pem")}, true},
+		{"disabled", []ConfigOption{WithCollectorCACertFile("/nonexistent/ca.pem")}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, _ := NewConfig(append([]ConfigOption{WithAppName("test"), WithAgentId("testagent")}, tt.opts...)...)
+			opt, err := collectorCredentials(*c)
+			if tt.wantErr {
+				assert.Error(t, err, "err")
+			} else {
+				assert.NoError(t, err, "err")
+				assert.NotNil(t, opt, "option")
+			}
+		})
+	}
+}
+
+func Test_streamCompressor(t *testing.T) {
+	tests := []struct {
+		compression string
+		want        string
+	}{
+		{"", ""},
+		{"none", ""},
+		{"gzip", "gzip"},
+		{"snappy", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.compression, func(t *testing.T) {
+			c, _ := NewConfig(WithAppName("test"), WithAgentId("testagent"), WithCollectorCompression(tt.compression))
+			assert.Equal(t, tt.want, streamCompressor(*c), "compressor")
+		})
+	}
+}
+
+func Test_collectorDialer(t *testing.T) {
+	resolved := false
+	r := &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network, address string) (net.Conn, error) {
+			resolved = true
+			return nil, errors.New("no dns server")
+		},
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	c, _ := NewConfig(WithAppName("test"), WithCollectorResolver(r))
+	_, err := collectorDialer(*c)(ctx, "collector.invalid:9991")
+	assert.Error(t, err, "dial")
+	assert.True(t, resolved, "resolved by custom resolver")
+
+	c, _ = NewConfig(WithAppName("test"))
+	assert.Nil(t, collectorDialer(*c), "default dialer")
+}
+
+func Test_sourceAddr(t *testing.T) {
+	tests := []struct {
+		src  string
+		want string
+	}{
+		{"10.0.0.5", "10.0.0.5:0"},
+		{"10.0.0.5:40000", "10.0.0.5:40000"},
+		{"fd00::5", "[fd00::5]:0"},
+		{"[fd00::5]:40000", "[fd00::5]:40000"},
+		{"eth0", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.src, func(t *testing.T) {
+			addr, err := sourceAddr(tt.src)
+			if tt.want == "" {
+				assert.Error(t, err, "err")
+			} else {
+				assert.NoError(t, err, "err")
+				assert.Equal(t, tt.want, addr.String(), "addr")
+			}
+		})
+	}
+}
+
+func Test_makePSpan(t *testing.T) {
+	s := defaultSpan()
+	s.agent = newMockAgent()
+	s.NewSpanEvent("named").EndSpanEvent()
+	s.NewSpanEvent("with api id")
+	s.SpanEvent().SetApiId(10)
+	s.SpanEvent().Annotations().AppendString(AnnotationHttpUrl, "http://localhost/")
+	s.EndSpanEvent()
+
+	events := makePSpan(s).GetSpan().GetSpanEvent()
+	assert.Equal(t, 2, len(events), "len")
+	assert.Equal(t, 1, len(events[0].GetAnnotation()), "operation name")
+	assert.Equal(t, int32(AnnotationHttpUrl), events[1].GetAnnotation()[0].GetKey(), "annotation")
+}
+
+func Test_makePSpan_ExceptionInfo(t *testing.T) {
+	s := defaultSpan()
+	s.agent = newMockAgent()
+	assert.Nil(t, makePSpan(s).GetSpan().GetExceptionInfo(), "no error")
+
+	s.SetError(errors.New("handler fail"))
+	info := makePSpan(s).GetSpan().GetExceptionInfo()
+	assert.Equal(t, int32(1), info.GetIntValue(), "error func id")
+	assert.Equal(t, "handler fail", info.GetStringValue().GetValue(), "error string")
+	assert.Equal(t, int32(1), makePSpan(s).GetSpan().GetErr(), "err")
+}
+
+func Test_fillPSpanEvent_microElapsed(t *testing.T) {
+	tests := []struct {
+		name     string
+		duration time.Duration
+		under    time.Duration
+		want     int
+	}{
+		{"disabled", 300 * time.Microsecond, 0, 1},
+		{"short", 300 * time.Microsecond, time.Millisecond, 2},
+		{"long", 3 * time.Millisecond, time.Millisecond, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			se := newSpanEvent(defaultSpan(), "event")
+			se.duration = tt.duration
+
+			var pevent pb.PSpanEvent
+			fillPSpanEvent(&pevent, se, AnnotationApi, tt.under)
+			assert.Equal(t, tt.want, len(pevent.GetAnnotation()), "len")
+			if tt.want == 2 {
+				assert.Equal(t, int32(AnnotationElapsedMicros), pevent.GetAnnotation()[1].GetKey(), "key")
+				assert.Equal(t, int64(300), pevent.GetAnnotation()[1].GetValue().GetLongValue(), "micros")
+			}
+			assert.Equal(t, 0, len(se.annotations.list), "event annotations")
+		})
+	}
+}
+
+func BenchmarkMakePSpan(b *testing.B) {
+	s := defaultSpan()
+	s.agent = newMockAgent()
+	for i := 0; i < 50; i++ {
+		s.NewSpanEvent("event")
+		s.SpanEvent().Annotations().AppendString(AnnotationHttpUrl, "http://localhost/")
+		s.EndSpanEvent()
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		makePSpan(s)
+	}
+}
+
+func Test_collectorAddr(t *testing.T) {
+	tests := []struct {
+		host string
+		want string
+	}{
+		{"localhost", "localhost:9991"},
+		{"10.0.0.1", "10.0.0.1:9991"},
+		{"::1", "[::1]:9991"},
+		{"[fd00::1]", "[fd00::1]:9991"},
+		{"consul:///pinpoint-collector", "consul:///pinpoint-collector:9991"},
+		{"dns:///collector.internal", "dns:///collector.internal:9991"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.host, func(t *testing.T) {
+			addr := collectorAddr(tt.host, 9991)
+			assert.Equal(t, tt.want, addr, "addr")
+
+			if !strings.Contains(tt.host, "://") {
+				_, _, err := net.SplitHostPort(addr)
+				assert.NoError(t, err, "parse")
+			}
+		})
+	}
+}
+
+func Test_collectorHost(t *testing.T) {
+	c, _ := NewConfig(WithAppName("test"), WithAgentId("testagent"), WithCollectorHost("collector"), WithCollectorSpanHost("span-collector"))
+
+	assert.Equal(t, "span-collector", collectorHost(c.Collector.SpanHost, c.Collector.Host), "span")
+	assert.Equal(t, "collector", collectorHost(c.Collector.StatHost, c.Collector.Host), "stat")
+	assert.Equal(t, "collector", collectorHost(c.Collector.AgentHost, c.Collector.Host), "agent")
+	assert.Equal(t, "collector", collectorHost(c.Collector.CommandHost, c.Collector.Host), "command")
+}
+
+func Test_pingStream_closeGracefully(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	stream := NewMockAgent_PingSessionClient(ctrl)
+	stream.EXPECT().CloseSend().Return(nil)
+	gomock.InOrder(
+		stream.EXPECT().Recv().Return(&pb.PPing{}, nil),
+		stream.EXPECT().Recv().Return(nil, io.EOF),
+	)
+
+	s := &pingStream{stream: stream}
+	assert.True(t, s.closeGracefully(time.Second), "closed")
+	assert.Nil(t, s.stream, "stream")
+	assert.False(t, s.closeGracefully(time.Second), "closed twice")
+}
+
+func Test_dialGrpcConns_CloseOnError(t *testing.T) {
+	defer func() {
+		dialAgentGrpc, dialSpanGrpc, dialStatGrpc, dialCommandGrpc = newAgentGrpc, newSpanGrpc, newStatGrpc, newCommandGrpc
+	}()
+
+	var opened []*grpc.ClientConn
+	dial := func() *grpc.ClientConn {
+		conn, err := grpc.Dial("localhost:1", grpc.WithInsecure())
+		assert.NoError(t, err, "dial")
+		opened = append(opened, conn)
+		return conn
+	}
+	dialAgentGrpc = func(ctx context.Context, agent Agent) (*agentGrpc, error) { return &agentGrpc{agentConn: dial()}, nil }
+	dialSpanGrpc = func(ctx context.Context, agent Agent) (*spanGrpc, error) { return &spanGrpc{spanConn: dial()}, nil }
+	dialStatGrpc = func(ctx context.Context, agent Agent) (*statGrpc, error) {
+		return nil, errors.New("stat port misconfigured")
+	}
+	dialCommandGrpc = func(ctx context.Context, agent Agent) (*cmdGrpc, error) {
+		t.Error("dial after failure")
+		return nil, nil
+	}
+
+	conns, err := dialGrpcConns(context.Background(), newMockAgent())
+	assert.Error(t, err, "err")
+	assert.Equal(t, grpcConns{}, conns, "conns")
+	assert.Equal(t, 2, len(opened), "opened")
+	for _, conn := range opened {
+		assert.Equal(t, connectivity.Shutdown, conn.GetState(), "closed")
+	}
+}
+
+func Test_streamBackoff_retry(t *testing.T) {
+	agent := newMockAgent()
+	b := streamBackoff{maxElapsed: time.Nanosecond}
+	fail := func() bool { return false }
+
+	assert.False(t, b.retry(agent, "test", fail), "give up")
+	assert.Equal(t, 1, b.failures, "failures")
+	assert.False(t, b.retry(agent, "test", fail), "give up again")
+	assert.Equal(t, 2, b.failures, "failures kept across retries")
+
+	assert.True(t, b.retry(agent, "test", func() bool { return true }), "success")
+	assert.Equal(t, 0, b.failures, "reset")
+}
+
+func Test_streamBackoff_retry_Canceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	b := streamBackoff{ctx: ctx, maxElapsed: time.Hour, base: time.Minute, max: time.Minute}
+
+	done := make(chan bool)
+	go func() {
+		done <- b.retry(newMockAgent(), "test", func() bool { return false })
+	}()
+	cancel()
+
+	select {
+	case ok := <-done:
+		assert.False(t, ok, "retry")
+	case <-time.After(5 * time.Second):
+		t.Fatal("retry is not interrupted by the cancel")
+	}
+}
+
+func Test_backoffDelay(t *testing.T) {
+	for attempt := 1; attempt < 10; attempt++ {
+		d := backoffDelay(time.Second, time.Minute, attempt)
+		assert.GreaterOrEqual(t, int64(d), int64(time.Second), "min")
+		assert.LessOrEqual(t, int64(d), int64(time.Minute), "max")
+	}
+}
+
+func Test_newStreamBackoff(t *testing.T) {
+	c, _ := NewConfig(WithAppName("test"), WithAgentId("testagent"), WithCollectorBackoff(100, 2000))
+	b := newStreamBackoff(context.Background(), *c)
+
+	assert.Equal(t, 100*time.Millisecond, b.base, "base")
+	assert.Equal(t, 2*time.Second, b.max, "max")
+	assert.Equal(t, streamRetryMaxElapsed, b.maxElapsed, "maxElapsed")
+}
+
+func Test_connectToCollectorWithRetry_MaxAttempts(t *testing.T) {
+	c, _ := NewConfig(WithAppName("test"), WithAgentId("testagent"), WithCollectorMaxConnectAttempts(2), WithCollectorBackoff(1, 1), WithCollectorConnectTimeout(10))
+	opts := []grpc.DialOption{grpc.WithInsecure(), grpc.WithBlock()}
+
+	conn, err := connectToCollectorWithRetry(context.Background(), "localhost:1", opts, *c)
+	assert.Nil(t, conn, "conn")
+	assert.Error(t, err, "err")
+}
+
+func Test_connectToCollectorWithRetry_Canceled(t *testing.T) {
+	c, _ := NewConfig(WithAppName("test"), WithAgentId("testagent"), WithCollectorMaxConnectAttempts(0), WithCollectorBackoff(60000, 60000), WithCollectorConnectTimeout(10))
+	opts := []grpc.DialOption{grpc.WithInsecure(), grpc.WithBlock()}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+
+	start := time.Now()
+	conn, err := connectToCollectorWithRetry(ctx, "localhost:1", opts, *c)
+	assert.Nil(t, conn, "conn")
+	assert.Equal(t, context.Canceled, err, "err")
+	assert.Less(t, int64(time.Since(start)), int64(5*time.Second), "canceled in backoff")
+}
@@ -3,6 +3,7 @@ package pinpoint
 import (
 	"context"
 	"testing"
+	"time"
 
 	gomock "github.com/golang/mock/gomock"
 	pb "github.com/pinpoint-apm/pinpoint-go-agent/protobuf"
@@ -15,6 +16,7 @@ type mockAgent struct {
 	agentGrpc *agentGrpc
 	spanGrpc  *spanGrpc
 	statGrpc  *statGrpc
+	recorder  streamRecorder
 }
 
 func newMockAgent() Agent {
@@ -44,6 +46,14 @@ func (agent *mockAgent) setMockStatGrpc(t *testing.T) {
 func (agent *mockAgent) Shutdown() {
 }
 
+func (agent *mockAgent) ShutdownWithTimeout(timeout time.Duration) (int, int) {
+	return 0, 0
+}
+
+func (agent *mockAgent) ReconnectCollector(host string, agentPort int, spanPort int, statPort int) error {
+	return nil
+}
+
 func (agent *mockAgent) NewSpanTracer(operation string) Tracer {
 	return newNoopSpan(agent)
 }
@@ -52,6 +62,14 @@ func (agent *mockAgent) NewSpanTracerWithReader(operation string, reader Distrib
 	return newNoopSpan(agent)
 }
 
+func (agent *mockAgent) NewSpanTracerWithStatus(operation string) (Tracer, SpanStatus) {
+	return newNoopSpan(agent), SpanStatusDisabled
+}
+
+func (agent *mockAgent) NewSpanTracerWithReaderAndStatus(operation string, reader DistributedTracingContextReader) (Tracer, SpanStatus) {
+	return newNoopSpan(agent), SpanStatusDisabled
+}
+
 func (agent *mockAgent) RegisterSpanApiId(descriptor string, apiType int) int32 {
 	return 1
 }
@@ -68,6 +86,26 @@ func (agent *mockAgent) Enable() bool {
 	return true
 }
 
+func (agent *mockAgent) RecordCustomStat(name string, value float64) {}
+
+func (agent *mockAgent) OnEnableChange(f func(enabled bool)) {}
+
+func (agent *mockAgent) StreamStats() StreamStats {
+	return agent.recorder.stats()
+}
+
+func (agent *mockAgent) streams() *streamRecorder {
+	return &agent.recorder
+}
+
+func (agent *mockAgent) SamplerState() SamplerState {
+	return SamplerState{}
+}
+
+func (agent *mockAgent) RecentTraces() []TraceSummary {
+	return nil
+}
+
 func (agent *mockAgent) StartTime() int64 {
 	return agent.startTime
 }
@@ -127,7 +165,7 @@ func newMockAgentGrpc(agent Agent, t *testing.T) *agentGrpc {
 	ctrl := gomock.NewController(t)
 	agentClient := mockAgentGrpcClient{NewMockAgentClient(ctrl)}
 	metadataClient := mockMetaGrpcClient{NewMockMetadataClient(ctrl)}
-	return &agentGrpc{nil, &agentClient, &metadataClient, -1, agent}
+	return &agentGrpc{agentClient: &agentClient, metadataClient: &metadataClient, pingSocketId: -1, agent: agent}
 }
 
 type mockSpanGrpcClient struct {
@@ -144,7 +182,7 @@ func newMockSpanGrpc(agent Agent, t *testing.T) *spanGrpc {
 	ctrl := gomock.NewController(t)
 	stream := NewMockSpan_SendSpanClient(ctrl)
 	spanClient := mockSpanGrpcClient{NewMockSpanClient(ctrl), stream}
-	return &spanGrpc{nil, &spanClient, &mockSpanStreamInvoker{stream}, agent}
+	return &spanGrpc{nil, &spanClient, &mockSpanStreamInvoker{stream}, agent, streamBackoff{}}
 }
 
 type mockSpanStreamInvoker struct {
@@ -180,7 +218,7 @@ func newMockStatGrpc(agent Agent, t *testing.T) *statGrpc {
 	ctrl := gomock.NewController(t)
 	stream := NewMockStat_SendAgentStatClient(ctrl)
 	statClient := mockStaGrpcClient{NewMockStatClient(ctrl), stream}
-	return &statGrpc{nil, &statClient, &mockStatStreamInvoker{stream}, agent}
+	return &statGrpc{nil, &statClient, &mockStatStreamInvoker{stream}, agent, streamBackoff{}}
 }
 
 type mockStatStreamInvoker struct {
@@ -1,7 +1,10 @@
 package pinpoint
 
 import (
+	"context"
 	"time"
+
+	pb "github.com/pinpoint-apm/pinpoint-go-agent/protobuf"
 )
 
 type noopSpan struct {
@@ -10,6 +13,14 @@ type noopSpan struct {
 	annotations noopannotation
 }
 
+// NoopTracer returns a tracer which records nothing, for the code paths that run without a transaction.
+// Its Span() and SpanEvent() return recorders which record nothing, and Inject() sets Pinpoint-Sampled to s0,
+// so the downstream doesn't sample the call either.
+// The agent returns such a tracer from NewSpanTracer when it is disabled or the transaction is not sampled.
+func NoopTracer() Tracer {
+	return newNoopSpan(nil)
+}
+
 func newNoopSpan(agent Agent) Tracer {
 	span := noopSpan{}
 	span.agent = agent
@@ -18,19 +29,47 @@ func newNoopSpan(agent Agent) Tracer {
 
 func (span *noopSpan) EndSpan() {}
 
+func (span *noopSpan) EndSpanWithStatus(err error) {}
+
 func (span *noopSpan) NewSpanEvent(operationName string) Tracer {
 	return span
 }
 
+func (span *noopSpan) NewSpanEventWithApiId(apiId int32) Tracer {
+	return span
+}
+
 func (span *noopSpan) NewAsyncSpan() Tracer {
 	asyncSpan := noopSpan{}
 	asyncSpan.agent = span.agent
 	return &asyncSpan
 }
 
+func (span *noopSpan) NewAsyncSpanWithId(asyncId int32) Tracer {
+	return span.NewAsyncSpan()
+}
+
+func (span *noopSpan) AsyncId() int32 {
+	return 0
+}
+
+func (span *noopSpan) WrapGo(ctx context.Context, f func(ctx context.Context)) {
+	asyncTracer := span.NewAsyncSpan()
+
+	go func() {
+		defer asyncTracer.EndSpan()
+		f(NewContext(ctx, asyncTracer))
+	}()
+}
+
 func (span *noopSpan) EndSpanEvent() {}
 
+func (span *noopSpan) EndSpanEventWithStatus(err error) {}
+
 func (span *noopSpan) TransactionId() TransactionId {
+	if span.agent == nil {
+		return TransactionId{"", 0, -1}
+	}
 	return TransactionId{span.agent.Config().AgentId, span.agent.StartTime(), -1}
 }
 
@@ -72,22 +111,40 @@ func (span *noopSpan) Annotations() Annotation {
 
 func (span *noopSpan) SetLogging(logInfo int32) {}
 
+func (span *noopSpan) SetUriTemplate(template string) {}
+
+func (span *noopSpan) SetParentApplication(name string, typ int) {}
+
+func (span *noopSpan) AddLink(txId TransactionId) {}
+
+func (span *noopSpan) RecordAttribute(key string, value interface{}) {}
+
 type noopSpanEvent struct {
 	annotations noopannotation
 }
 
 func (se *noopSpanEvent) SetError(e error) {}
 
+func (se *noopSpanEvent) SetErrorWithSpan(e error, markSpan bool) {}
+
+func (se *noopSpanEvent) SetTransportError(e error) {}
+
 func (se *noopSpanEvent) SetApiId(id int32) {}
 
 func (se *noopSpanEvent) SetServiceType(typ int32) {}
 
 func (se *noopSpanEvent) SetDestination(id string) {}
 
+func (se *noopSpanEvent) OverrideDestination(id string) {}
+
 func (se *noopSpanEvent) SetEndPoint(endPoint string) {}
 
 func (se *noopSpanEvent) SetSQL(sql string) {}
 
+func (se *noopSpanEvent) SetSQLRowsAffected(n int64) {}
+
+func (se *noopSpanEvent) RecordAttribute(key string, value interface{}) {}
+
 func (span *noopSpanEvent) Annotations() Annotation {
 	return &span.annotations
 }
@@ -107,6 +164,10 @@ func (a *noopannotation) AppendIntStringString(key int32, i int32, s1 string, s2
 func (a *noopannotation) AppendLongIntIntByteByteString(key int32, l int64, i1 int32, i2 int32, b1 int32, b2 int32, s string) {
 }
 
+func (a *noopannotation) List() []*pb.PAnnotation {
+	return nil
+}
+
 type noopDistributedTracingContextReader struct{}
 
 func (r *noopDistributedTracingContextReader) Get(key string) string {
@@ -3,6 +3,7 @@ package chi
 import (
 	"net/http"
 
+	"github.com/go-chi/chi"
 	pinpoint "github.com/pinpoint-apm/pinpoint-go-agent"
 	phttp "github.com/pinpoint-apm/pinpoint-go-agent/plugin/http"
 )
@@ -19,7 +20,7 @@ func Middleware(agent pinpoint.Agent) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		fn := func(w http.ResponseWriter, r *http.Request) {
 			tracer := phttp.NewHttpServerTracer(agent, r, "Chi Server")
-			defer tracer.EndSpan()
+			defer pinpoint.FinalizeSpanWithContext(r.Context(), tracer)
 			tracer.Span().SetApiId(apiId)
 
 			routePath := r.URL.Path
@@ -33,6 +34,9 @@ func Middleware(agent pinpoint.Agent) func(http.Handler) http.Handler {
 			r = pinpoint.RequestWithTracerContext(r, tracer)
 
 			next.ServeHTTP(w, r)
+			if rctx := chi.RouteContext(r.Context()); rctx != nil {
+				tracer.Span().SetUriTemplate(rctx.RoutePattern())
+			}
 			phttp.TraceHttpStatus(tracer, status)
 		}
 		return http.HandlerFunc(fn)
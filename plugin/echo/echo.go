@@ -21,7 +21,7 @@ func Middleware(agent pinpoint.Agent) echo.MiddlewareFunc {
 			req := c.Request()
 
 			tracer := phttp.NewHttpServerTracer(agent, req, "Echo Server")
-			defer tracer.EndSpan()
+			defer pinpoint.FinalizeSpanWithContext(req.Context(), tracer)
 			tracer.Span().SetApiId(apiId)
 
 			ctx := pinpoint.NewContext(req.Context(), tracer)
@@ -34,6 +34,7 @@ func Middleware(agent pinpoint.Agent) echo.MiddlewareFunc {
 				c.Error(err)
 			}
 
+			tracer.Span().SetUriTemplate(c.Path())
 			phttp.TraceHttpStatus(tracer, c.Response().Status)
 			return err
 
@@ -12,7 +12,7 @@ func Middleware(agent pinpoint.Agent) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		if agent.Enable() {
 			tracer := phttp.NewHttpServerTracer(agent, c.Request, "Gin Server")
-			defer tracer.EndSpan()
+			defer pinpoint.FinalizeSpanWithContext(c.Request.Context(), tracer)
 			tracer.Span().SetApiId(apiId)
 
 			c.Request = pinpoint.RequestWithTracerContext(c.Request, tracer)
@@ -20,6 +20,7 @@ func Middleware(agent pinpoint.Agent) gin.HandlerFunc {
 
 			c.Next()
 
+			tracer.Span().SetUriTemplate(c.FullPath())
 			phttp.TraceHttpStatus(tracer, c.Writer.Status())
 
 			if len(c.Errors) > 0 {
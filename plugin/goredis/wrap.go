@@ -60,8 +60,11 @@ func process(ctx context.Context, endpoint string) func(oldProcess func(cmd redi
 			span.SetDestination("REDIS")
 			span.SetEndPoint(endpoint)
 
+			//a key lookup that finds nothing is a cache miss, not an error
 			err := oldProcess(cmd)
-			if err != nil {
+			if isCacheRead(cmd) && (err == nil || err == redis.Nil) {
+				pinpoint.RecordCacheResult(tracer, err == nil)
+			} else if err != nil {
 				span.SetError(err)
 			}
 
@@ -70,6 +73,17 @@ func process(ctx context.Context, endpoint string) func(oldProcess func(cmd redi
 	}
 }
 
+var cacheReadCommands = map[string]bool{
+	"get":    true,
+	"getex":  true,
+	"getdel": true,
+	"hget":   true,
+}
+
+func isCacheRead(cmd redis.Cmder) bool {
+	return cacheReadCommands[strings.ToLower(cmd.Name())]
+}
+
 func processPipeline(ctx context.Context, endpoint string) func(oldProcess func(cmds []redis.Cmder) error) func(cmds []redis.Cmder) error {
 	return func(oldProcess func(cmds []redis.Cmder) error) func(cmds []redis.Cmder) error {
 		return func(cmds []redis.Cmder) error {
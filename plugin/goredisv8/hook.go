@@ -62,8 +62,11 @@ func (r *hook) AfterProcess(ctx context.Context, cmd redis.Cmder) error {
 	span.SetDestination("REDIS")
 	span.SetEndPoint(r.endpoint)
 
+	//a key lookup that finds nothing is a cache miss, not an error
 	err := cmd.Err()
-	if err != nil {
+	if isCacheRead(cmd) && (err == nil || err == redis.Nil) {
+		pinpoint.RecordCacheResult(tracer, err == nil)
+	} else if err != nil {
 		span.SetError(err)
 	}
 
@@ -112,6 +115,17 @@ func (r *hook) AfterProcessPipeline(ctx context.Context, cmds []redis.Cmder) err
 	return nil
 }
 
+var cacheReadCommands = map[string]bool{
+	"get":    true,
+	"getex":  true,
+	"getdel": true,
+	"hget":   true,
+}
+
+func isCacheRead(cmd redis.Cmder) bool {
+	return cacheReadCommands[strings.ToLower(cmd.Name())]
+}
+
 func getCmdName(cmd redis.Cmder) string {
 	cmdName := strings.ToUpper(cmd.Name())
 	if cmdName == "" {
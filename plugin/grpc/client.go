@@ -19,6 +19,8 @@ type clientStream struct {
 	mutex      sync.Mutex
 	isFinished bool
 	tracer     pinpoint.Tracer
+	orphan     pinpoint.Tracer
+	peer       *peer.Peer
 }
 
 func (cs *clientStream) SendMsg(m interface{}) error {
@@ -47,7 +49,7 @@ func (cs *clientStream) endSpan(err error) {
 	cs.mutex.Lock()
 	defer cs.mutex.Unlock()
 	if !cs.isFinished {
-		endSpan(cs.tracer, err)
+		endSpan(cs.tracer, cs.orphan, err, cs.peer)
 		cs.isFinished = true
 	}
 }
@@ -57,13 +59,18 @@ type DistributedTracingContextWriterMD struct {
 }
 
 func (m *DistributedTracingContextWriterMD) Set(key string, value string) {
-	m.md.Set(key, value)
+	pinpoint.MetadataWriter(m.md).Set(key, value)
 }
 
-func newSpanForGrpcClient(ctx context.Context, method string) (context.Context, pinpoint.Tracer) {
+// newSpanForGrpcClient returns the tracer of the call, and the transaction started for the call if it is an orphan call.
+func newSpanForGrpcClient(ctx context.Context, agent pinpoint.Agent, method string) (context.Context, pinpoint.Tracer, pinpoint.Tracer) {
 	tracer := pinpoint.FromContext(ctx)
+	var orphan pinpoint.Tracer
 	if tracer == nil {
-		return ctx, nil
+		if orphan = pinpoint.NewOrphanCallTracer(agent, method); orphan == nil {
+			return ctx, nil, nil
+		}
+		tracer = orphan
 	}
 
 	tracer = tracer.NewSpanEvent(method)
@@ -83,41 +90,75 @@ func newSpanForGrpcClient(ctx context.Context, method string) (context.Context,
 	tracer.SpanEvent().SetDestination(remoteAddress)
 
 	md, ok := metadata.FromOutgoingContext(ctx)
-	if !ok {
+	if ok {
+		//the metadata of the context must not be modified
+		md = md.Copy()
+	} else {
 		md = metadata.New(nil)
 	}
 
-	writer := &DistributedTracingContextWriterMD{md}
-	tracer.Inject(writer)
-	ctx = metadata.NewOutgoingContext(ctx, writer.md)
+	tracer.Inject(pinpoint.MetadataWriter(md))
+	ctx = metadata.NewOutgoingContext(ctx, md)
 
-	return ctx, tracer
+	return ctx, tracer, orphan
 }
 
-func endSpan(tracer pinpoint.Tracer, err error) {
+// endSpan ends the span event of the call.
+// grpc sets the peer of the call only if a transport stream was made on a connection to the server,
+// so a call failed without the peer never reached the server, and no span will be made with the next span id.
+// A call on an established connection may fail with codes.Unavailable too, when the connection is reset.
+func endSpan(tracer pinpoint.Tracer, orphan pinpoint.Tracer, err error, p *peer.Peer) {
+	if tracer == nil {
+		return
+	}
+	if orphan != nil {
+		defer orphan.EndSpan()
+	}
+
 	if err != nil && err != io.EOF {
-		tracer.SpanEvent().SetError(err)
+		if p.Addr == nil {
+			tracer.SpanEvent().SetTransportError(err)
+		} else {
+			tracer.SpanEvent().SetError(err)
+		}
 	}
 	tracer.EndSpanEvent()
 }
 
+// UnaryClientInterceptor traces the calls made with a context of a transaction.
+// Calls made without a transaction are not traced and don't carry the pinpoint metadata.
 func UnaryClientInterceptor() grpc.UnaryClientInterceptor {
+	return UnaryClientInterceptorWithAgent(nil)
+}
+
+// UnaryClientInterceptorWithAgent is UnaryClientInterceptor, but a call made without a transaction is traced
+// as a new transaction if the agent is configured with WithHttpTraceOrphanClientCalls.
+func UnaryClientInterceptorWithAgent(agent pinpoint.Agent) grpc.UnaryClientInterceptor {
 	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
-		newCtx, clientSpan := newSpanForGrpcClient(ctx, method)
-		err := invoker(newCtx, method, req, reply, cc, opts...)
-		endSpan(clientSpan, err)
+		newCtx, clientSpan, orphan := newSpanForGrpcClient(ctx, agent, method)
+		var p peer.Peer
+		err := invoker(newCtx, method, req, reply, cc, append(opts, grpc.Peer(&p))...)
+		endSpan(clientSpan, orphan, err, &p)
 		return err
 	}
 }
 
+// StreamClientInterceptor traces the streams made with a context of a transaction.
 func StreamClientInterceptor() grpc.StreamClientInterceptor {
+	return StreamClientInterceptorWithAgent(nil)
+}
+
+// StreamClientInterceptorWithAgent is StreamClientInterceptor, but a stream made without a transaction is traced
+// as a new transaction if the agent is configured with WithHttpTraceOrphanClientCalls.
+func StreamClientInterceptorWithAgent(agent pinpoint.Agent) grpc.StreamClientInterceptor {
 	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
-		newCtx, span := newSpanForGrpcClient(ctx, method)
-		stream, err := streamer(newCtx, desc, cc, method, opts...)
+		newCtx, span, orphan := newSpanForGrpcClient(ctx, agent, method)
+		p := &peer.Peer{}
+		stream, err := streamer(newCtx, desc, cc, method, append(opts, grpc.Peer(p))...)
 		if err != nil {
-			endSpan(span, err)
+			endSpan(span, orphan, err, p)
 			return nil, err
 		}
-		return &clientStream{ClientStream: stream, tracer: span}, nil
+		return &clientStream{ClientStream: stream, tracer: span, orphan: orphan, peer: p}, nil
 	}
 }
@@ -0,0 +1,108 @@
+package grpc
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"testing"
+
+	pinpoint "github.com/pinpoint-apm/pinpoint-go-agent"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+func Test_UnaryClientInterceptorWithAgent_OrphanCall(t *testing.T) {
+	tests := []struct {
+		name   string
+		enable bool
+	}{
+		{"traced", true},
+		{"not traced", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			c, _ := pinpoint.NewConfig(pinpoint.WithAppName("test"), pinpoint.WithAgentId("testagent"),
+				pinpoint.WithSpanDebugExport(true), pinpoint.WithSpanDebugExportWriter(&buf), pinpoint.WithHttpTraceOrphanClientCalls(tt.enable))
+			agent, _ := pinpoint.NewAgent(c)
+
+			var sent metadata.MD
+			invoker := func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+				sent, _ = metadata.FromOutgoingContext(ctx)
+				return nil
+			}
+
+			interceptor := UnaryClientInterceptorWithAgent(agent)
+			err := interceptor(context.Background(), "/hello.Greeter/SayHello", nil, nil, nil, invoker)
+			agent.Shutdown()
+
+			assert.NoError(t, err, "call")
+			if tt.enable {
+				assert.NotEmpty(t, sent.Get(pinpoint.HttpTraceId), "trace id")
+				assert.Contains(t, buf.String(), `"rpc": "/hello.Greeter/SayHello"`, "transaction of the call")
+			} else {
+				assert.Empty(t, sent.Get(pinpoint.HttpTraceId), "no pinpoint metadata")
+				assert.Empty(t, buf.String(), "no transaction")
+			}
+		})
+	}
+}
+
+func Test_UnaryClientInterceptor_NoTransaction(t *testing.T) {
+	var sent metadata.MD
+	invoker := func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+		sent, _ = metadata.FromOutgoingContext(ctx)
+		return nil
+	}
+
+	err := UnaryClientInterceptor()(context.Background(), "/hello.Greeter/SayHello", nil, nil, nil, invoker)
+	assert.NoError(t, err, "call")
+	assert.Empty(t, sent, "no pinpoint metadata")
+}
+
+func Test_UnaryClientInterceptor_Unavailable(t *testing.T) {
+	tests := []struct {
+		name       string
+		reached    bool
+		nextSpanId bool
+	}{
+		{"connection refused", false, false},
+		{"connection reset", true, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			c, _ := pinpoint.NewConfig(pinpoint.WithAppName("test"), pinpoint.WithAgentId("testagent"),
+				pinpoint.WithSpanDebugExport(true), pinpoint.WithSpanDebugExportWriter(&buf))
+			agent, _ := pinpoint.NewAgent(c)
+
+			var sent metadata.MD
+			invoker := func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+				sent, _ = metadata.FromOutgoingContext(ctx)
+				for _, o := range opts {
+					if p, ok := o.(grpc.PeerCallOption); ok && tt.reached {
+						p.PeerAddr.Addr = &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 9090}
+					}
+				}
+				return status.Error(codes.Unavailable, tt.name)
+			}
+
+			tracer := agent.NewSpanTracer("test")
+			err := UnaryClientInterceptor()(pinpoint.NewContext(context.Background(), tracer), "/hello.Greeter/SayHello", nil, nil, nil, invoker)
+			tracer.EndSpan()
+			agent.Shutdown()
+
+			assert.Equal(t, codes.Unavailable, status.Code(err), "call")
+			out := buf.String()
+			assert.Contains(t, out, tt.name, "error")
+			if tt.nextSpanId {
+				assert.Contains(t, out, `"nextSpanId": "`+sent.Get(pinpoint.HttpSpanId)[0]+`"`, "next span id")
+			} else {
+				assert.Contains(t, out, `"nextSpanId": "-1"`, "no next span id")
+			}
+		})
+	}
+}
@@ -24,16 +24,12 @@ type DistributedTracingContextReaderMD struct {
 }
 
 func (m DistributedTracingContextReaderMD) Get(key string) string {
-	v := m.md.Get(key)
-	if len(v) == 0 {
-		return ""
-	}
-	return v[0]
+	return pinpoint.MetadataReader(m.md).Get(key)
 }
 
 func startSpan(ctx context.Context, agent pinpoint.Agent, apiId int32, rpcName string) pinpoint.Tracer {
 	md, _ := metadata.FromIncomingContext(ctx) // nil is ok
-	reader := &DistributedTracingContextReaderMD{md}
+	reader := pinpoint.MetadataReader(md)
 	tracer := agent.NewSpanTracerWithReader("Go GRPC Server", reader)
 	tracer.Span().SetServiceType(serviceTypeGrpcServer)
 	tracer.Span().SetApiId(apiId)
@@ -51,7 +47,7 @@ func UnaryServerInterceptor(agent pinpoint.Agent) grpc.UnaryServerInterceptor {
 		}
 
 		tracer := startSpan(ctx, agent, apiId, info.FullMethod)
-		defer tracer.EndSpan()
+		defer pinpoint.FinalizeSpanWithContext(ctx, tracer)
 		defer tracer.NewSpanEvent(info.FullMethod).EndSpanEvent()
 
 		ctx = pinpoint.NewContext(ctx, tracer)
@@ -72,7 +68,7 @@ func StreamServerInterceptor(agent pinpoint.Agent) grpc.StreamServerInterceptor
 		}
 
 		tracer := startSpan(stream.Context(), agent, apiId, info.FullMethod)
-		defer tracer.EndSpan()
+		defer pinpoint.FinalizeSpanWithContext(stream.Context(), tracer)
 		defer tracer.NewSpanEvent(info.FullMethod).EndSpanEvent()
 
 		ctx := pinpoint.NewContext(stream.Context(), tracer)
@@ -3,6 +3,8 @@ package http
 import (
 	pinpoint "github.com/pinpoint-apm/pinpoint-go-agent"
 	"net/http"
+	"net/http/httptrace"
+	"sync/atomic"
 )
 
 func NewHttpClientTracer(tracer pinpoint.Tracer, operationName string, req *http.Request) pinpoint.Tracer {
@@ -12,13 +14,26 @@ func NewHttpClientTracer(tracer pinpoint.Tracer, operationName string, req *http
 	tracer.SpanEvent().SetDestination(req.Host)
 	tracer.SpanEvent().SetServiceType(pinpoint.ServiceTypeGoHttpClient)
 	tracer.SpanEvent().Annotations().AppendString(pinpoint.AnnotationHttpUrl, req.URL.String())
-	tracer.Inject(req.Header)
+	tracer.Inject(pinpoint.HttpHeaderWriter(req.Header))
 
 	return tracer
 }
 
+// EndHttpClientTracer ends the span event of the request.
+// Whether the request reached the server is not known here, so the error is recorded as is.
 func EndHttpClientTracer(tracer pinpoint.Tracer, resp *http.Response, err error) {
-	tracer.SpanEvent().SetError(err)
+	endHttpClientTracer(tracer, resp, err, true)
+}
+
+// endHttpClientTracer ends the span event of the request. A request failed without a connection to the server,
+// e.g. by a dns error or connection refused, never reached the server, so no span will be made with the next span id.
+// A request failed on a connection may have reached the server, even if there is no response.
+func endHttpClientTracer(tracer pinpoint.Tracer, resp *http.Response, err error, connected bool) {
+	if resp == nil && !connected {
+		tracer.SpanEvent().SetTransportError(err)
+	} else {
+		tracer.SpanEvent().SetError(err)
+	}
 	if resp != nil {
 		tracer.SpanEvent().Annotations().AppendInt(pinpoint.AnnotationHttpStatusCode, int32(resp.StatusCode))
 	}
@@ -27,36 +42,58 @@ func EndHttpClientTracer(tracer pinpoint.Tracer, resp *http.Response, err error)
 
 type roundTripper struct {
 	original http.RoundTripper
+	agent    pinpoint.Agent
 }
 
+// WrapClient traces the requests made with a context of a transaction.
+// Requests made without a transaction are not traced and don't carry the pinpoint headers.
 func WrapClient(client *http.Client) *http.Client {
+	return WrapClientWithAgent(nil, client)
+}
+
+// WrapClientWithAgent is WrapClient, but a request made without a transaction is traced as a new transaction
+// if the agent is configured with WithHttpTraceOrphanClientCalls.
+func WrapClientWithAgent(agent pinpoint.Agent, client *http.Client) *http.Client {
 	if client == nil {
 		client = http.DefaultClient
 	}
 
 	c := *client
-	c.Transport = wrapRoundTripper(c.Transport)
+	c.Transport = WrapRoundTripper(agent, c.Transport)
 	return &c
 }
 
-func wrapRoundTripper(original http.RoundTripper) http.RoundTripper {
+// WrapRoundTripper traces the requests sent by the transport like WrapClientWithAgent,
+// for a client made by a library which takes a transport rather than a client.
+// The agent may be nil, then the requests made without a transaction are not traced.
+func WrapRoundTripper(agent pinpoint.Agent, original http.RoundTripper) http.RoundTripper {
 	if original == nil {
 		original = http.DefaultTransport
 	}
 
 	return &roundTripper{
 		original: original,
+		agent:    agent,
 	}
 }
 
 func (r *roundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
 	tracer := pinpoint.TracerFromRequestContext(req)
+	var orphan pinpoint.Tracer
 	if tracer == nil {
-		return r.original.RoundTrip(req)
+		if orphan = pinpoint.NewOrphanCallTracer(r.agent, "http.Client"); orphan == nil {
+			return r.original.RoundTrip(req)
+		}
+		tracer = orphan
 	}
 
+	var connected int32
+	ctx := httptrace.WithClientTrace(req.Context(), &httptrace.ClientTrace{
+		GotConn: func(httptrace.GotConnInfo) { atomic.StoreInt32(&connected, 1) },
+	})
+
 	//clone request
-	clone := *req
+	clone := *req.WithContext(ctx)
 	clone.Header = make(http.Header, len(req.Header))
 	for k, v := range req.Header {
 		clone.Header[k] = v
@@ -65,7 +102,10 @@ func (r *roundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
 
 	tracer = NewHttpClientTracer(tracer, "http.Client", req)
 	resp, err := r.original.RoundTrip(req)
-	EndHttpClientTracer(tracer, resp, err)
+	endHttpClientTracer(tracer, resp, err, atomic.LoadInt32(&connected) == 1)
+	if orphan != nil {
+		orphan.EndSpan()
+	}
 
 	return resp, err
 }
@@ -0,0 +1,141 @@
+package http
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/http/httptrace"
+	"strconv"
+	"testing"
+
+	pinpoint "github.com/pinpoint-apm/pinpoint-go-agent"
+	"github.com/stretchr/testify/assert"
+)
+
+type roundTripperFunc func(req *http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+func Test_WrapRoundTripper(t *testing.T) {
+	var buf bytes.Buffer
+	agent := exportAgent(t, &buf)
+
+	var sent http.Header
+	rt := WrapRoundTripper(agent, roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		sent = req.Header
+		return &http.Response{StatusCode: http.StatusAccepted, Header: http.Header{}, Request: req}, nil
+	}))
+
+	tracer := agent.NewSpanTracer("test")
+	req := pinpoint.RequestWithTracerContext(httptest.NewRequest("GET", "http://backend:8080/items?id=1", nil), tracer)
+	resp, err := rt.RoundTrip(req)
+	tracer.EndSpan()
+	agent.Shutdown()
+
+	assert.NoError(t, err, "RoundTrip")
+	assert.Equal(t, http.StatusAccepted, resp.StatusCode, "status")
+	assert.Empty(t, req.Header.Get(pinpoint.HttpTraceId), "the request of the caller is not modified")
+
+	assert.Equal(t, tracer.TransactionId().String(), sent.Get(pinpoint.HttpTraceId), "trace id")
+	assert.Equal(t, strconv.FormatInt(tracer.SpanId(), 10), sent.Get(pinpoint.HttpParentSpanId), "parent span id")
+	assert.NotEmpty(t, sent.Get(pinpoint.HttpSpanId), "span id")
+	assert.Equal(t, "backend:8080", sent.Get(pinpoint.HttpHost), "host")
+
+	out := buf.String()
+	assert.Contains(t, out, `"serviceType": `+strconv.Itoa(pinpoint.ServiceTypeGoHttpClient), "span event service type")
+	assert.Contains(t, out, `"destinationId": "backend:8080"`, "destination")
+	assert.Contains(t, out, `"stringValue": "http://backend:8080/items?id=1"`, "url")
+	assert.Contains(t, out, `"intValue": 202`, "http status")
+	assert.Contains(t, out, `"nextSpanId": "`+sent.Get(pinpoint.HttpSpanId)+`"`, "next span id")
+}
+
+func Test_WrapRoundTripper_NoTransaction(t *testing.T) {
+	var sent http.Header
+	rt := WrapRoundTripper(nil, roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		sent = req.Header
+		return &http.Response{StatusCode: http.StatusOK, Header: http.Header{}, Request: req}, nil
+	}))
+
+	_, err := rt.RoundTrip(httptest.NewRequest("GET", "http://backend/", nil))
+	assert.NoError(t, err, "RoundTrip")
+	assert.Empty(t, sent.Get(pinpoint.HttpTraceId), "not traced")
+}
+
+func Test_WrapRoundTripper_OrphanCall(t *testing.T) {
+	tests := []struct {
+		name   string
+		enable bool
+	}{
+		{"traced", true},
+		{"not traced", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			agent := exportAgent(t, &buf, pinpoint.WithHttpTraceOrphanClientCalls(tt.enable))
+
+			var sent http.Header
+			rt := WrapRoundTripper(agent, roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+				sent = req.Header
+				return &http.Response{StatusCode: http.StatusOK, Header: http.Header{}, Request: req}, nil
+			}))
+
+			_, err := rt.RoundTrip(httptest.NewRequest("GET", "http://backend/", nil))
+			agent.Shutdown()
+
+			assert.NoError(t, err, "RoundTrip")
+			if tt.enable {
+				assert.NotEmpty(t, sent.Get(pinpoint.HttpTraceId), "trace id")
+				assert.Contains(t, buf.String(), `"rpc": "http.Client"`, "transaction of the call")
+				assert.Contains(t, buf.String(), `"destinationId": "backend"`, "span event of the call")
+			} else {
+				assert.Empty(t, sent, "no pinpoint headers")
+				assert.Empty(t, buf.String(), "no transaction")
+			}
+		})
+	}
+}
+
+func Test_WrapRoundTripper_Failed(t *testing.T) {
+	tests := []struct {
+		name       string
+		connected  bool
+		nextSpanId bool
+	}{
+		{"connection refused", false, false},
+		{"reset after connected", true, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			agent := exportAgent(t, &buf)
+
+			var sent http.Header
+			rt := WrapRoundTripper(agent, roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+				sent = req.Header
+				if tt.connected {
+					httptrace.ContextClientTrace(req.Context()).GotConn(httptrace.GotConnInfo{})
+				}
+				return nil, errors.New(tt.name)
+			}))
+
+			tracer := agent.NewSpanTracer("test")
+			req := pinpoint.RequestWithTracerContext(httptest.NewRequest("GET", "http://backend:8080/", nil), tracer)
+			_, err := rt.RoundTrip(req)
+			tracer.EndSpan()
+			agent.Shutdown()
+
+			assert.Error(t, err, "RoundTrip")
+			out := buf.String()
+			assert.Contains(t, out, tt.name, "error")
+			if tt.nextSpanId {
+				assert.Contains(t, out, `"nextSpanId": "`+sent.Get(pinpoint.HttpSpanId)+`"`, "next span id")
+			} else {
+				assert.Contains(t, out, `"nextSpanId": "-1"`, "no next span id")
+			}
+		})
+	}
+}
@@ -1,10 +1,13 @@
 package http
 
 import (
+	"context"
 	"errors"
 	pinpoint "github.com/pinpoint-apm/pinpoint-go-agent"
 	"net"
 	"net/http"
+	"net/url"
+	"sort"
 	"strconv"
 	"strings"
 )
@@ -12,16 +15,120 @@ import (
 const AnnotationProxyHttpHeader = 300
 
 func NewHttpServerTracer(agent pinpoint.Agent, req *http.Request, operation string) pinpoint.Tracer {
-	tracer := agent.NewSpanTracerWithReader(operation, req.Header)
+	//the excluded requests don't reach the sampler, so they are not counted in the sampling stats
+	if IsExcludedUserAgent(req.UserAgent(), agent.Config().Sampling.ExcludeUserAgents) {
+		return pinpoint.NoopTracer()
+	}
+
+	tracer := agent.NewSpanTracerWithReader(operation, newServerHeaderReader(agent, req))
 
 	tracer.Span().SetRpcName(req.URL.Path)
 	tracer.Span().SetEndPoint(req.Host)
 	tracer.Span().SetRemoteAddress(getRemoteAddr(req))
+	if req.Header.Get(pinpoint.HttpHost) == "" {
+		tracer.Span().SetAcceptorHost(getAcceptorHost(req))
+	}
 	setProxyHeader(tracer, req)
+	setQueryString(tracer, req, agent.Config().Http.RecordQueryParams)
 
 	return tracer
 }
 
+func newServerHeaderReader(agent pinpoint.Agent, req *http.Request) pinpoint.DistributedTracingContextReader {
+	reader := pinpoint.HttpHeaderReader(req.Header)
+	if header := agent.Config().Sampling.ForceHeader; header != "" && req.Header.Get(header) != "" {
+		return &forceSampleReader{reader}
+	}
+	return reader
+}
+
+// forceSampleReader adds FlagForceSample to the pinpoint flags of the request.
+type forceSampleReader struct {
+	reader pinpoint.DistributedTracingContextReader
+}
+
+func (r *forceSampleReader) Get(key string) string {
+	value := r.reader.Get(key)
+	if key == pinpoint.HttpFlags {
+		flags, _ := strconv.Atoi(value)
+		return strconv.Itoa(flags | pinpoint.FlagForceSample)
+	}
+	return value
+}
+
+// IsExcludedUserAgent reports whether the user agent contains one of the patterns, ignoring case.
+func IsExcludedUserAgent(userAgent string, patterns []string) bool {
+	if userAgent == "" || len(patterns) == 0 {
+		return false
+	}
+
+	userAgent = strings.ToLower(userAgent)
+	for _, p := range patterns {
+		if p != "" && strings.Contains(userAgent, strings.ToLower(p)) {
+			return true
+		}
+	}
+	return false
+}
+
+const redactedParamValue = "[redacted]"
+
+func setQueryString(tracer pinpoint.Tracer, r *http.Request, allowed []string) {
+	if len(allowed) == 0 || r.URL.RawQuery == "" {
+		return
+	}
+
+	if query := FilterQueryString(r.URL.Query(), allowed); query != "" {
+		tracer.Span().Annotations().AppendString(pinpoint.AnnotationHttpParam, query)
+	}
+}
+
+// FilterQueryString encodes the query parameters sorted by name, like url.Values.Encode,
+// but replaces the values of a parameter not in allowed with a single "[redacted]".
+// The names and the allowed values are escaped, and the marker is written as is so that it stays readable.
+func FilterQueryString(query url.Values, allowed []string) string {
+	names := make([]string, 0, len(query))
+	for name := range query {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	params := make([]string, 0, len(names))
+	for _, name := range names {
+		key := url.QueryEscape(name) + "="
+		if !isAllowedParam(name, allowed) {
+			params = append(params, key+redactedParamValue)
+			continue
+		}
+		for _, v := range query[name] {
+			params = append(params, key+url.QueryEscape(v))
+		}
+	}
+
+	return strings.Join(params, "&")
+}
+
+func isAllowedParam(name string, allowed []string) bool {
+	for _, a := range allowed {
+		if a == name {
+			return true
+		}
+	}
+	return false
+}
+
+func getAcceptorHost(r *http.Request) string {
+	if r.Host != "" {
+		return r.Host
+	}
+
+	if r.TLS != nil && r.TLS.ServerName != "" {
+		return r.TLS.ServerName
+	}
+
+	return ""
+}
+
 func getRemoteAddr(r *http.Request) string {
 	if xff := r.Header.Get("X-Forwarded-For"); xff != "" {
 		if parts := strings.Split(xff, ","); len(parts) > 0 {
@@ -103,28 +210,42 @@ func TraceHttpStatus(tracer pinpoint.Tracer, status int) {
 	}
 }
 
+// WrapHandle traces the requests served by the handler of the pattern as transactions,
+// recording the handler name as a span event and the pattern as the URI template.
+// The requests are served without tracing while the agent is disabled.
 func WrapHandle(agent pinpoint.Agent, handlerName string, pattern string, handler http.Handler) (string, http.Handler) {
-	if !agent.Enable() {
-		return pattern, handler
-	}
-
-	apiId := agent.RegisterSpanApiId("Go Http Server", pinpoint.ApiTypeWebRequest)
-
 	return pattern, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		tracer := NewHttpServerTracer(agent, r, "Http Server")
-		defer tracer.EndSpan()
-		tracer.Span().SetApiId(apiId)
+		if !agent.Enable() {
+			handler.ServeHTTP(w, r)
+			return
+		}
 
-		defer tracer.NewSpanEvent(handlerName).EndSpanEvent()
+		//the api id is looked up per request, as the agent may not be enabled yet when the handler is wrapped
+		tracer := NewHttpServerTracer(agent, r, "Http Server")
+		defer pinpoint.FinalizeSpanWithContext(r.Context(), tracer)
+		tracer.Span().SetApiId(agent.RegisterSpanApiId("Go Http Server", pinpoint.ApiTypeWebRequest))
+		if pattern != "" {
+			tracer.Span().SetUriTemplate(pattern)
+		}
+		if handlerName != "" {
+			defer tracer.NewSpanEvent(handlerName).EndSpanEvent()
+		}
 
 		status := http.StatusOK
 		w = WrapResponseWriter(w, &status)
 		r = pinpoint.RequestWithTracerContext(r, tracer)
-		handler.ServeHTTP(w, r)
+		pinpoint.DoWithProfileLabels(r.Context(), tracer, func(context.Context) { handler.ServeHTTP(w, r) })
 		TraceHttpStatus(tracer, status)
 	})
 }
 
+// WrapHandler traces every request served by the handler, such as the mux of the server, as a transaction.
+// The route of the request is not known to the wrapper, so use WrapHandle to record the handler and the URI template of each route.
+func WrapHandler(agent pinpoint.Agent, handler http.Handler) http.Handler {
+	_, h := WrapHandle(agent, "", "", handler)
+	return h
+}
+
 func WrapHandleFunc(agent pinpoint.Agent, handlerName string, pattern string, handler func(http.ResponseWriter, *http.Request)) (string, func(http.ResponseWriter, *http.Request)) {
 	p, h := WrapHandle(agent, handlerName, pattern, http.HandlerFunc(handler))
 	return p, func(w http.ResponseWriter, r *http.Request) { h.ServeHTTP(w, r) }
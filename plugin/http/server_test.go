@@ -0,0 +1,265 @@
+package http
+
+import (
+	"bytes"
+	"crypto/tls"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+
+	pinpoint "github.com/pinpoint-apm/pinpoint-go-agent"
+	"github.com/stretchr/testify/assert"
+)
+
+// exportAgent is an agent writing its spans to the buffer, which is readable after shutdown.
+func exportAgent(t *testing.T, buf *bytes.Buffer, opts ...pinpoint.ConfigOption) pinpoint.Agent {
+	opts = append([]pinpoint.ConfigOption{pinpoint.WithAppName("test"), pinpoint.WithAgentId("testagent"),
+		pinpoint.WithSpanDebugExport(true), pinpoint.WithSpanDebugExportWriter(buf)}, opts...)
+	c, _ := pinpoint.NewConfig(opts...)
+	agent, err := pinpoint.NewAgent(c)
+	assert.NoError(t, err, "NewAgent")
+	return agent
+}
+
+// toggledAgent enables and disables the agent it wraps.
+type toggledAgent struct {
+	pinpoint.Agent
+	enable bool
+}
+
+func (a *toggledAgent) Enable() bool {
+	return a.enable && a.Agent.Enable()
+}
+
+func Test_WrapHandle(t *testing.T) {
+	var buf bytes.Buffer
+	agent := exportAgent(t, &buf)
+
+	var traced bool
+	pattern, h := WrapHandle(agent, "getUser", "/users/{id}", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		traced = pinpoint.TracerFromRequestContext(r) != nil
+		w.WriteHeader(http.StatusCreated)
+	}))
+	assert.Equal(t, "/users/{id}", pattern, "pattern")
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/users/1", nil))
+	agent.Shutdown()
+
+	assert.True(t, traced, "tracer in context")
+	assert.Equal(t, http.StatusCreated, w.Code, "status")
+	assert.Contains(t, buf.String(), `"rpc": "/users/1"`, "rpc")
+	assert.Contains(t, buf.String(), `"intValue": 201`, "http status")
+	assert.Contains(t, buf.String(), `"stringValue": "getUser"`, "handler span event")
+}
+
+func Test_WrapHandler_EnabledAfterWrap(t *testing.T) {
+	var buf bytes.Buffer
+	agent := &toggledAgent{Agent: exportAgent(t, &buf)}
+
+	var served, traced int
+	h := WrapHandler(agent, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		served++
+		if pinpoint.TracerFromRequestContext(r) != nil {
+			traced++
+		}
+	}))
+
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/before", nil))
+	agent.enable = true
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/after", nil))
+	agent.Shutdown()
+
+	assert.Equal(t, 2, served, "served")
+	assert.Equal(t, 1, traced, "traced")
+	assert.NotContains(t, buf.String(), `"rpc": "/before"`, "disabled")
+	assert.Contains(t, buf.String(), `"rpc": "/after"`, "enabled")
+	assert.Contains(t, buf.String(), `"intValue": 200`, "http status")
+	assert.NotContains(t, buf.String(), `"spanEvent"`, "no handler span event")
+}
+
+func Test_WrapHandler_Disabled(t *testing.T) {
+	c, _ := pinpoint.NewConfig(pinpoint.WithAppName("test"), pinpoint.WithAgentId("testagent"))
+	c.OffGrpc = true
+	agent, _ := pinpoint.NewAgent(c)
+
+	var traced bool
+	h := WrapHandler(agent, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		traced = pinpoint.TracerFromRequestContext(r) != nil
+		w.WriteHeader(http.StatusNotFound)
+	}))
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+	assert.False(t, traced, "traced")
+	assert.Equal(t, http.StatusNotFound, w.Code, "status")
+}
+
+func Test_FilterQueryString(t *testing.T) {
+	tests := []struct {
+		name    string
+		query   string
+		allowed []string
+		want    string
+	}{
+		{"allowed", "id=1&page=2", []string{"id", "page"}, "id=1&page=2"},
+		{"redacted", "id=1&token=secret", []string{"id"}, "id=1&token=[redacted]"},
+		{"redacted once for values", "token=a&token=b", []string{"id"}, "token=[redacted]"},
+		{"allowed values", "id=1&id=2", []string{"id"}, "id=1&id=2"},
+		{"escaped", "q=a+b%26c&k%20y=v", []string{"q"}, "k+y=[redacted]&q=a+b%26c"},
+		{"none allowed", "b=1&a=2", nil, "a=[redacted]&b=[redacted]"},
+		{"empty", "", []string{"id"}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			query, err := url.ParseQuery(tt.query)
+			assert.NoError(t, err, "ParseQuery")
+			assert.Equal(t, tt.want, FilterQueryString(query, tt.allowed))
+		})
+	}
+}
+
+func Test_getAcceptorHost(t *testing.T) {
+	tlsReq := httptest.NewRequest("GET", "https://svc.example.com/", nil)
+	tlsReq.Host = ""
+	tlsReq.TLS = &tls.ConnectionState{ServerName: "sni.example.com"}
+
+	tests := []struct {
+		name string
+		req  *http.Request
+		want string
+	}{
+		{"host", httptest.NewRequest("GET", "http://svc.example.com:8080/", nil), "svc.example.com:8080"},
+		{"sni", tlsReq, "sni.example.com"},
+		{"none", &http.Request{URL: &url.URL{Path: "/"}}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, getAcceptorHost(tt.req), "getAcceptorHost")
+		})
+	}
+}
+
+func Test_NewHttpServerTracer_AcceptorHost(t *testing.T) {
+	tests := []struct {
+		name       string
+		headerHost string
+		want       string
+	}{
+		{"from Host", "", `"acceptorHost": "svc.example.com"`},
+		{"from Pinpoint-Host", "proxy.example.com", `"acceptorHost": "proxy.example.com"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			agent := exportAgent(t, &buf)
+
+			req := httptest.NewRequest("GET", "http://svc.example.com/", nil)
+			req.Header.Set(pinpoint.HttpTraceId, "parent^1^1")
+			req.Header.Set(pinpoint.HttpSpanId, "2")
+			req.Header.Set(pinpoint.HttpParentApplicationName, "parentApp")
+			if tt.headerHost != "" {
+				req.Header.Set(pinpoint.HttpHost, tt.headerHost)
+			}
+			NewHttpServerTracer(agent, req, "test").EndSpan()
+			agent.Shutdown()
+
+			assert.Contains(t, buf.String(), tt.want, "acceptor host")
+		})
+	}
+}
+
+func Test_NewHttpServerTracer_ForceHeader(t *testing.T) {
+	tests := []struct {
+		name   string
+		header string
+		want   bool
+	}{
+		{"with header", "1", true},
+		{"without header", "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			agent := exportAgent(t, &buf, pinpoint.WithSamplingType(pinpoint.SamplingTypePercent),
+				pinpoint.WithSamplingRate(0), pinpoint.WithSamplingForceHeader("X-Debug-Trace"))
+
+			req := httptest.NewRequest("GET", "/debug", nil)
+			if tt.header != "" {
+				req.Header.Set("X-Debug-Trace", tt.header)
+			}
+			NewHttpServerTracer(agent, req, "test").EndSpan()
+			agent.Shutdown()
+
+			assert.Equal(t, tt.want, strings.Contains(buf.String(), `"rpc": "/debug"`), "sampled")
+		})
+	}
+}
+
+func Test_forceSampleReader_Get(t *testing.T) {
+	header := http.Header{}
+	header.Set(pinpoint.HttpTraceId, "parent^1^1")
+	r := &forceSampleReader{pinpoint.HttpHeaderReader(header)}
+	assert.Equal(t, strconv.Itoa(pinpoint.FlagForceSample), r.Get(pinpoint.HttpFlags), "no flags")
+	assert.Equal(t, "parent^1^1", r.Get(pinpoint.HttpTraceId), "other header")
+
+	header.Set(pinpoint.HttpFlags, "4")
+	assert.Equal(t, "5", r.Get(pinpoint.HttpFlags), "other flags kept")
+}
+
+func Test_IsExcludedUserAgent(t *testing.T) {
+	patterns := []string{"googlebot", "kube-probe", ""}
+	tests := []struct {
+		name      string
+		userAgent string
+		patterns  []string
+		want      bool
+	}{
+		{"match", "Mozilla/5.0 (compatible; Googlebot/2.1)", patterns, true},
+		{"prefix", "kube-probe/1.27", patterns, true},
+		{"no match", "Mozilla/5.0 (X11; Linux x86_64)", patterns, false},
+		{"empty user agent", "", patterns, false},
+		{"no patterns", "kube-probe/1.27", nil, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, IsExcludedUserAgent(tt.userAgent, tt.patterns), "IsExcludedUserAgent")
+		})
+	}
+}
+
+// countingAgent counts the tracers made by the agent it wraps.
+type countingAgent struct {
+	pinpoint.Agent
+	tracers int
+}
+
+func (a *countingAgent) NewSpanTracerWithReader(operation string, reader pinpoint.DistributedTracingContextReader) pinpoint.Tracer {
+	a.tracers++
+	return a.Agent.NewSpanTracerWithReader(operation, reader)
+}
+
+func Test_NewHttpServerTracer_ExcludeUserAgents(t *testing.T) {
+	var buf bytes.Buffer
+	agent := &countingAgent{Agent: exportAgent(t, &buf, pinpoint.WithSamplingExcludeUserAgents([]string{"kube-probe"}))}
+
+	req := httptest.NewRequest("GET", "/healthz", nil)
+	req.Header.Set("User-Agent", "kube-probe/1.27")
+	tracer := NewHttpServerTracer(agent, req, "test")
+	header := http.Header{}
+	tracer.Inject(pinpoint.HttpHeaderWriter(header))
+	tracer.EndSpan()
+
+	req = httptest.NewRequest("GET", "/users", nil)
+	req.Header.Set("User-Agent", "Mozilla/5.0")
+	NewHttpServerTracer(agent, req, "test").EndSpan()
+	agent.Shutdown()
+
+	assert.Equal(t, 1, agent.tracers, "excluded request is not passed to the sampler")
+	assert.Equal(t, "s0", header.Get(pinpoint.HttpSampled), "downstream not sampled")
+	assert.NotContains(t, buf.String(), `"rpc": "/healthz"`, "excluded")
+	assert.Contains(t, buf.String(), `"rpc": "/users"`, "sampled")
+}
@@ -3,6 +3,7 @@ package sarama
 import (
 	"bytes"
 	"strconv"
+	"time"
 
 	"github.com/Shopify/sarama"
 	pinpoint "github.com/pinpoint-apm/pinpoint-go-agent"
@@ -68,6 +69,7 @@ func WrapPartitionConsumer(pc sarama.PartitionConsumer, agent pinpoint.Agent) *P
 			tracer.Span().Annotations().AppendString(annotationKafkaTopic, msg.Topic)
 			tracer.Span().Annotations().AppendInt(annotationKafkaPartition, msg.Partition)
 			tracer.Span().Annotations().AppendInt(annotationKafkaOffset, int32(msg.Offset))
+			pinpoint.RecordMessageLag(tracer, msg.Timestamp, time.Now())
 
 			wrapped.messages <- &ConsumerMessage{msg, tracer}
 		}
@@ -62,8 +62,17 @@ func NewSyncProducer(addrs []string, config *sarama.Config) (*SyncProducer, erro
 	return &SyncProducer{SyncProducer: producer, addrs: addrs}, nil
 }
 
+// startProducerSpan records the message as a span event of the transaction of ctx.
+// A message produced outside of any transaction is not traced and is sent without the pinpoint headers.
 func startProducerSpan(ctx context.Context, addrs []string, msg *sarama.ProducerMessage) pinpoint.Tracer {
-	tracer := pinpoint.FromContext(ctx)
+	var tracer pinpoint.Tracer
+	if ctx != nil {
+		tracer = pinpoint.FromContext(ctx)
+	}
+	if tracer == nil {
+		return pinpoint.NoopTracer()
+	}
+
 	span := tracer.NewSpanEvent("kafka.produce")
 	span.SpanEvent().SetServiceType(serviceTypeKafkaClient)
 	tracer.SpanEvent().Annotations().AppendString(annotationKafkaTopic, msg.Topic)
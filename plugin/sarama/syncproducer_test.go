@@ -0,0 +1,27 @@
+package sarama
+
+import (
+	"context"
+	"testing"
+
+	"github.com/Shopify/sarama"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_startProducerSpan_NoTransaction(t *testing.T) {
+	tests := []struct {
+		name string
+		ctx  context.Context
+	}{
+		{"no context", nil},
+		{"no tracer", context.Background()},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			msg := &sarama.ProducerMessage{Topic: "topic"}
+			span := startProducerSpan(tt.ctx, []string{"localhost:9092"}, msg)
+			span.EndSpanEvent()
+			assert.Empty(t, msg.Headers, "no pinpoint headers")
+		})
+	}
+}
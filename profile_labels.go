@@ -0,0 +1,36 @@
+package pinpoint
+
+import (
+	"context"
+	"runtime/pprof"
+	"strconv"
+)
+
+const (
+	ProfileLabelTransactionId = "pinpoint.txid"
+	ProfileLabelSpanId        = "pinpoint.spanid"
+)
+
+// ProfileLabels returns the pprof labels that identify the transaction of the tracer.
+// A CPU profile taken while the goroutines are labeled with them can be filtered by the transaction,
+// for example with 'go tool pprof -tagfocus pinpoint.txid=<transaction id>'.
+func ProfileLabels(tracer Tracer) pprof.LabelSet {
+	return pprof.Labels(
+		ProfileLabelTransactionId, tracer.TransactionId().String(),
+		ProfileLabelSpanId, strconv.FormatInt(tracer.SpanId(), 10),
+	)
+}
+
+func profileLabelsEnabled(agent Agent) bool {
+	return agent != nil && agent.Config().Span.ProfileLabels
+}
+
+// DoWithProfileLabels calls f labeling the current goroutine with ProfileLabels of the tracer, if WithSpanProfileLabels is enabled.
+// The labels are added to those of ctx, which f is passed with, and the previous labels of the goroutine are restored when f returns.
+func DoWithProfileLabels(ctx context.Context, tracer Tracer, f func(ctx context.Context)) {
+	if s, ok := tracer.(*span); ok && profileLabelsEnabled(s.agent) {
+		pprof.Do(ctx, ProfileLabels(s), f)
+	} else {
+		f(ctx)
+	}
+}
@@ -0,0 +1,67 @@
+package pinpoint
+
+import (
+	"context"
+	"runtime/pprof"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_span_WrapGo_ProfileLabels(t *testing.T) {
+	agent := newMockAgent()
+	agent.(*mockAgent).config.Span.ProfileLabels = true
+
+	s := defaultSpan()
+	s.agent = agent
+	s.Extract(&DistributedTracingContextMap{map[string]string{
+		HttpTraceId: "t123456^12345^1",
+		HttpSpanId:  "67890",
+	}})
+	s.NewSpanEvent("t1")
+
+	labels := make(chan [2]string)
+	s.WrapGo(context.Background(), func(ctx context.Context) {
+		txid, _ := pprof.Label(ctx, ProfileLabelTransactionId)
+		spanid, _ := pprof.Label(ctx, ProfileLabelSpanId)
+		labels <- [2]string{txid, spanid}
+	})
+
+	l := <-labels
+	assert.Equal(t, s.txId.String(), l[0], "txid")
+	assert.Equal(t, strconv.FormatInt(s.spanId, 10), l[1], "spanid")
+
+	s.EndSpan()
+}
+
+func Test_DoWithProfileLabels(t *testing.T) {
+	agent := newMockAgent()
+	agent.(*mockAgent).config.Span.ProfileLabels = true
+
+	s := defaultSpan()
+	s.agent = agent
+	s.Extract(&DistributedTracingContextMap{map[string]string{
+		HttpTraceId: "t123456^12345^1",
+		HttpSpanId:  "67890",
+	}})
+	defer s.EndSpan()
+
+	ctx := pprof.WithLabels(context.Background(), pprof.Labels("handler", "orders"))
+	called := false
+	DoWithProfileLabels(ctx, s, func(ctx context.Context) {
+		called = true
+		txid, _ := pprof.Label(ctx, ProfileLabelTransactionId)
+		assert.Equal(t, s.txId.String(), txid, "txid")
+		handler, _ := pprof.Label(ctx, "handler")
+		assert.Equal(t, "orders", handler, "labels of the caller")
+	})
+	assert.True(t, called, "called")
+
+	called = false
+	DoWithProfileLabels(ctx, newNoopSpan(agent), func(c context.Context) {
+		called = true
+		assert.Equal(t, ctx, c, "ctx")
+	})
+	assert.True(t, called, "called without labels")
+}
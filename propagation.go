@@ -0,0 +1,43 @@
+package pinpoint
+
+import (
+	"net/http"
+
+	"google.golang.org/grpc/metadata"
+)
+
+// HttpHeaderReader reads the pinpoint headers from http headers.
+// The keys are canonicalized, so they are looked up case-insensitively.
+type HttpHeaderReader http.Header
+
+func (r HttpHeaderReader) Get(key string) string {
+	return http.Header(r).Get(key)
+}
+
+// HttpHeaderWriter writes the pinpoint headers to http headers, replacing the existing values.
+// The header must not be nil.
+type HttpHeaderWriter http.Header
+
+func (w HttpHeaderWriter) Set(key string, value string) {
+	http.Header(w).Set(key, value)
+}
+
+// MetadataReader reads the pinpoint headers from gRPC metadata.
+// The keys of gRPC metadata are lowercase, so they are looked up case-insensitively.
+type MetadataReader metadata.MD
+
+func (r MetadataReader) Get(key string) string {
+	v := metadata.MD(r).Get(key)
+	if len(v) == 0 {
+		return ""
+	}
+	return v[0]
+}
+
+// MetadataWriter writes the pinpoint headers to gRPC metadata, replacing the existing values.
+// The metadata must not be nil.
+type MetadataWriter metadata.MD
+
+func (w MetadataWriter) Set(key string, value string) {
+	metadata.MD(w).Set(key, value)
+}
@@ -0,0 +1,58 @@
+package pinpoint
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc/metadata"
+)
+
+func TestMetadataReaderWriter(t *testing.T) {
+	md := metadata.New(nil)
+	w := MetadataWriter(md)
+	w.Set(HttpTraceId, "agent^1600000000000^1")
+	w.Set(HttpSpanId, "1")
+	w.Set(HttpSpanId, "2")
+
+	assert.Equal(t, []string{"agent^1600000000000^1"}, md["pinpoint-traceid"], "lowercase key")
+	assert.Equal(t, []string{"2"}, md["pinpoint-spanid"], "replaced")
+
+	md.Append(HttpSampled, "s0", "s1")
+	r := MetadataReader(md)
+	assert.Equal(t, "agent^1600000000000^1", r.Get(HttpTraceId), "TraceId")
+	assert.Equal(t, "2", r.Get(HttpSpanId), "SpanId")
+	assert.Equal(t, "s0", r.Get(HttpSampled), "first value")
+	assert.Equal(t, "", r.Get(HttpFlags), "missing")
+	assert.Equal(t, "", MetadataReader(nil).Get(HttpFlags), "nil")
+}
+
+func TestHttpHeaderReaderWriter(t *testing.T) {
+	keys := []string{
+		HttpTraceId,
+		HttpSpanId,
+		HttpParentSpanId,
+		HttpSampled,
+		HttpFlags,
+		HttpParentApplicationName,
+		HttpParentApplicationType,
+		HttpParentApplicationNamespace,
+		HttpHost,
+	}
+
+	h := http.Header{}
+	w := HttpHeaderWriter(h)
+	for _, k := range keys {
+		w.Set(k, "v-"+k)
+	}
+	assert.Equal(t, len(keys), len(h), "len")
+
+	r := HttpHeaderReader(h)
+	for _, k := range keys {
+		assert.Equal(t, "v-"+k, r.Get(k), k)
+	}
+
+	h = http.Header{}
+	h.Add("pinpoint-spanid", "1")
+	assert.Equal(t, "1", HttpHeaderReader(h).Get(HttpSpanId), "case-insensitive")
+}
@@ -90,6 +90,7 @@ type PStatMessage struct {
 	// Types that are valid to be assigned to Field:
 	//	*PStatMessage_AgentStat
 	//	*PStatMessage_AgentStatBatch
+	//	*PStatMessage_AgentUriStat
 	Field                isPStatMessage_Field `protobuf_oneof:"field"`
 	XXX_NoUnkeyedLiteral struct{}             `json:"-"`
 	XXX_unrecognized     []byte               `json:"-"`
@@ -133,10 +134,16 @@ type PStatMessage_AgentStatBatch struct {
 	AgentStatBatch *PAgentStatBatch `protobuf:"bytes,2,opt,name=agentStatBatch,proto3,oneof"`
 }
 
+type PStatMessage_AgentUriStat struct {
+	AgentUriStat *PAgentUriStat `protobuf:"bytes,3,opt,name=agentUriStat,proto3,oneof"`
+}
+
 func (*PStatMessage_AgentStat) isPStatMessage_Field() {}
 
 func (*PStatMessage_AgentStatBatch) isPStatMessage_Field() {}
 
+func (*PStatMessage_AgentUriStat) isPStatMessage_Field() {}
+
 func (m *PStatMessage) GetField() isPStatMessage_Field {
 	if m != nil {
 		return m.Field
@@ -158,11 +165,19 @@ func (m *PStatMessage) GetAgentStatBatch() *PAgentStatBatch {
 	return nil
 }
 
+func (m *PStatMessage) GetAgentUriStat() *PAgentUriStat {
+	if x, ok := m.GetField().(*PStatMessage_AgentUriStat); ok {
+		return x.AgentUriStat
+	}
+	return nil
+}
+
 // XXX_OneofWrappers is for the internal use of the proto package.
 func (*PStatMessage) XXX_OneofWrappers() []interface{} {
 	return []interface{}{
 		(*PStatMessage_AgentStat)(nil),
 		(*PStatMessage_AgentStatBatch)(nil),
+		(*PStatMessage_AgentUriStat)(nil),
 	}
 }
 
@@ -1340,6 +1355,171 @@ func (m *PDirectBuffer) GetMappedMemoryUsed() int64 {
 	return 0
 }
 
+type PAgentUriStat struct {
+	BucketVersion        int32           `protobuf:"varint,1,opt,name=bucketVersion,proto3" json:"bucketVersion,omitempty"`
+	EachUriStat          []*PEachUriStat `protobuf:"bytes,2,rep,name=eachUriStat,proto3" json:"eachUriStat,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}        `json:"-"`
+	XXX_unrecognized     []byte          `json:"-"`
+	XXX_sizecache        int32           `json:"-"`
+}
+
+func (m *PAgentUriStat) Reset()         { *m = PAgentUriStat{} }
+func (m *PAgentUriStat) String() string { return proto.CompactTextString(m) }
+func (*PAgentUriStat) ProtoMessage()    {}
+func (*PAgentUriStat) Descriptor() ([]byte, []int) {
+	return fileDescriptor_29a37052f84a5404, []int{20}
+}
+
+func (m *PAgentUriStat) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_PAgentUriStat.Unmarshal(m, b)
+}
+func (m *PAgentUriStat) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_PAgentUriStat.Marshal(b, m, deterministic)
+}
+func (m *PAgentUriStat) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_PAgentUriStat.Merge(m, src)
+}
+func (m *PAgentUriStat) XXX_Size() int {
+	return xxx_messageInfo_PAgentUriStat.Size(m)
+}
+func (m *PAgentUriStat) XXX_DiscardUnknown() {
+	xxx_messageInfo_PAgentUriStat.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_PAgentUriStat proto.InternalMessageInfo
+
+func (m *PAgentUriStat) GetBucketVersion() int32 {
+	if m != nil {
+		return m.BucketVersion
+	}
+	return 0
+}
+
+func (m *PAgentUriStat) GetEachUriStat() []*PEachUriStat {
+	if m != nil {
+		return m.EachUriStat
+	}
+	return nil
+}
+
+type PEachUriStat struct {
+	Uri                  string         `protobuf:"bytes,1,opt,name=uri,proto3" json:"uri,omitempty"`
+	TotalHistogram       *PUriHistogram `protobuf:"bytes,2,opt,name=totalHistogram,proto3" json:"totalHistogram,omitempty"`
+	FailedHistogram      *PUriHistogram `protobuf:"bytes,3,opt,name=failedHistogram,proto3" json:"failedHistogram,omitempty"`
+	Timestamp            int64          `protobuf:"varint,4,opt,name=timestamp,proto3" json:"timestamp,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}       `json:"-"`
+	XXX_unrecognized     []byte         `json:"-"`
+	XXX_sizecache        int32          `json:"-"`
+}
+
+func (m *PEachUriStat) Reset()         { *m = PEachUriStat{} }
+func (m *PEachUriStat) String() string { return proto.CompactTextString(m) }
+func (*PEachUriStat) ProtoMessage()    {}
+func (*PEachUriStat) Descriptor() ([]byte, []int) {
+	return fileDescriptor_29a37052f84a5404, []int{21}
+}
+
+func (m *PEachUriStat) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_PEachUriStat.Unmarshal(m, b)
+}
+func (m *PEachUriStat) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_PEachUriStat.Marshal(b, m, deterministic)
+}
+func (m *PEachUriStat) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_PEachUriStat.Merge(m, src)
+}
+func (m *PEachUriStat) XXX_Size() int {
+	return xxx_messageInfo_PEachUriStat.Size(m)
+}
+func (m *PEachUriStat) XXX_DiscardUnknown() {
+	xxx_messageInfo_PEachUriStat.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_PEachUriStat proto.InternalMessageInfo
+
+func (m *PEachUriStat) GetUri() string {
+	if m != nil {
+		return m.Uri
+	}
+	return ""
+}
+
+func (m *PEachUriStat) GetTotalHistogram() *PUriHistogram {
+	if m != nil {
+		return m.TotalHistogram
+	}
+	return nil
+}
+
+func (m *PEachUriStat) GetFailedHistogram() *PUriHistogram {
+	if m != nil {
+		return m.FailedHistogram
+	}
+	return nil
+}
+
+func (m *PEachUriStat) GetTimestamp() int64 {
+	if m != nil {
+		return m.Timestamp
+	}
+	return 0
+}
+
+type PUriHistogram struct {
+	Total                int64    `protobuf:"varint,1,opt,name=total,proto3" json:"total,omitempty"`
+	Max                  int64    `protobuf:"varint,2,opt,name=max,proto3" json:"max,omitempty"`
+	Histogram            []int32  `protobuf:"varint,3,rep,packed,name=histogram,proto3" json:"histogram,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *PUriHistogram) Reset()         { *m = PUriHistogram{} }
+func (m *PUriHistogram) String() string { return proto.CompactTextString(m) }
+func (*PUriHistogram) ProtoMessage()    {}
+func (*PUriHistogram) Descriptor() ([]byte, []int) {
+	return fileDescriptor_29a37052f84a5404, []int{22}
+}
+
+func (m *PUriHistogram) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_PUriHistogram.Unmarshal(m, b)
+}
+func (m *PUriHistogram) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_PUriHistogram.Marshal(b, m, deterministic)
+}
+func (m *PUriHistogram) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_PUriHistogram.Merge(m, src)
+}
+func (m *PUriHistogram) XXX_Size() int {
+	return xxx_messageInfo_PUriHistogram.Size(m)
+}
+func (m *PUriHistogram) XXX_DiscardUnknown() {
+	xxx_messageInfo_PUriHistogram.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_PUriHistogram proto.InternalMessageInfo
+
+func (m *PUriHistogram) GetTotal() int64 {
+	if m != nil {
+		return m.Total
+	}
+	return 0
+}
+
+func (m *PUriHistogram) GetMax() int64 {
+	if m != nil {
+		return m.Max
+	}
+	return 0
+}
+
+func (m *PUriHistogram) GetHistogram() []int32 {
+	if m != nil {
+		return m.Histogram
+	}
+	return nil
+}
+
 func init() {
 	proto.RegisterEnum("v1.PJvmGcType", PJvmGcType_name, PJvmGcType_value)
 	proto.RegisterType((*PPing)(nil), "v1.PPing")
@@ -1362,6 +1542,9 @@ func init() {
 	proto.RegisterType((*PResponseTime)(nil), "v1.PResponseTime")
 	proto.RegisterType((*PDeadlock)(nil), "v1.PDeadlock")
 	proto.RegisterType((*PDirectBuffer)(nil), "v1.PDirectBuffer")
+	proto.RegisterType((*PAgentUriStat)(nil), "v1.PAgentUriStat")
+	proto.RegisterType((*PEachUriStat)(nil), "v1.PEachUriStat")
+	proto.RegisterType((*PUriHistogram)(nil), "v1.PUriHistogram")
 }
 
 func init() {
@@ -1369,99 +1552,107 @@ func init() {
 }
 
 var fileDescriptor_29a37052f84a5404 = []byte{
-	// 1492 bytes of a gzipped FileDescriptorProto
-	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x7c, 0x57, 0xdd, 0x6e, 0x1b, 0xc5,
-	0x17, 0xef, 0xae, 0x63, 0x3b, 0x3e, 0xce, 0x87, 0x3b, 0xe9, 0xff, 0xdf, 0x25, 0x54, 0x28, 0xac,
-	0x50, 0x15, 0xaa, 0xca, 0x6d, 0x53, 0x01, 0x15, 0x08, 0x50, 0xe2, 0x94, 0x24, 0x6d, 0xe2, 0x5a,
-	0xe3, 0xb4, 0x88, 0xab, 0x6a, 0xb2, 0x3b, 0x71, 0x36, 0xf5, 0x7e, 0x68, 0x77, 0xbc, 0x6d, 0xe0,
-	0x86, 0x2b, 0x24, 0xb8, 0xe1, 0x1d, 0xb8, 0xe5, 0x82, 0xd7, 0xe0, 0x2d, 0x78, 0x05, 0x1e, 0x01,
-	0x9d, 0x99, 0xfd, 0x98, 0x5d, 0x3b, 0xbd, 0xdb, 0xf9, 0xfd, 0xce, 0xcc, 0x39, 0x73, 0x3e, 0x67,
-	0x01, 0xc6, 0x82, 0x89, 0x7e, 0x14, 0x87, 0x22, 0x24, 0x66, 0xfa, 0x68, 0xf3, 0xc3, 0x49, 0x18,
-	0x4e, 0xa6, 0xfc, 0x81, 0x44, 0xce, 0x66, 0xe7, 0x0f, 0xb8, 0x1f, 0x89, 0x2b, 0x25, 0xb0, 0xd9,
-	0x3b, 0xbd, 0x88, 0x39, 0x73, 0xf7, 0x67, 0x7e, 0xa4, 0x10, 0xbb, 0x0d, 0xcd, 0xd1, 0xc8, 0x0b,
-	0x26, 0xf6, 0x2f, 0x06, 0xac, 0x8c, 0xf0, 0xac, 0x13, 0x9e, 0x24, 0x6c, 0xc2, 0x49, 0x1f, 0x3a,
-	0x6c, 0xc2, 0x03, 0x81, 0x98, 0x65, 0x6c, 0x19, 0xdb, 0xdd, 0x9d, 0xb5, 0x7e, 0xfa, 0xa8, 0x3f,
-	0xda, 0xcd, 0xd1, 0xc3, 0x1b, 0xb4, 0x14, 0x21, 0x5f, 0xc3, 0x5a, 0xb1, 0xd8, 0x63, 0xc2, 0xb9,
-	0xb0, 0x4c, 0xb9, 0x69, 0xa3, 0xba, 0x49, 0x52, 0x87, 0x37, 0x68, 0x4d, 0x78, 0xaf, 0x0d, 0xcd,
-	0x73, 0x8f, 0x4f, 0x5d, 0xfb, 0xd7, 0x06, 0x80, 0x12, 0x3f, 0x0a, 0xce, 0x43, 0xb2, 0x09, 0xcb,
-	0x17, 0x61, 0x22, 0x02, 0xe6, 0x73, 0x69, 0x45, 0x87, 0x16, 0x6b, 0xb2, 0x06, 0xa6, 0x17, 0x49,
-	0x35, 0x1d, 0x6a, 0x7a, 0x11, 0xb9, 0x05, 0xcd, 0x28, 0x8c, 0x45, 0x62, 0x35, 0x24, 0xa4, 0x16,
-	0x64, 0x0b, 0xba, 0x09, 0x8f, 0x53, 0xcf, 0xe1, 0xa7, 0x57, 0x11, 0xb7, 0x96, 0xb6, 0x8c, 0xed,
-	0x26, 0xd5, 0x21, 0xd2, 0x83, 0x46, 0xe4, 0xb9, 0x56, 0x53, 0x32, 0xf8, 0x49, 0x6c, 0x58, 0x91,
-	0xf6, 0xbd, 0xe2, 0x71, 0xe2, 0x85, 0x81, 0xd5, 0x92, 0x07, 0x56, 0x30, 0x72, 0x07, 0x3a, 0xa9,
-	0x9f, 0x0b, 0xb4, 0xa5, 0x40, 0x09, 0xe0, 0x09, 0x3c, 0x70, 0x4f, 0x3d, 0x9f, 0x27, 0x82, 0xf9,
-	0x91, 0xb5, 0xbc, 0x65, 0x6c, 0x37, 0x68, 0x05, 0xc3, 0x13, 0x78, 0xe0, 0xa2, 0x0f, 0x66, 0x89,
-	0xd5, 0x91, 0xda, 0x4b, 0x80, 0x7c, 0x05, 0x6b, 0x68, 0x24, 0x8f, 0x4f, 0xb8, 0x60, 0xfb, 0x4c,
-	0x30, 0x0b, 0x34, 0x87, 0x8e, 0x2b, 0x14, 0xad, 0x89, 0x92, 0xbb, 0xd0, 0xbe, 0x4c, 0x7d, 0xf4,
-	0xa0, 0xd5, 0x95, 0xbb, 0x56, 0xe4, 0xae, 0x67, 0x0a, 0xa3, 0x39, 0x89, 0x26, 0x38, 0x61, 0x20,
-	0x98, 0x17, 0xf0, 0xd8, 0x5a, 0xd9, 0x32, 0xb6, 0x97, 0x69, 0x09, 0xd8, 0x3f, 0xc1, 0x7a, 0x4d,
-	0x11, 0xf9, 0x08, 0x40, 0xa9, 0x92, 0x67, 0xab, 0x88, 0x68, 0x08, 0xc6, 0x20, 0xf5, 0x77, 0xe3,
-	0x89, 0x65, 0x6e, 0x35, 0x30, 0x06, 0x72, 0x41, 0x76, 0x8a, 0x18, 0xc8, 0x6d, 0x8d, 0xad, 0xc6,
-	0x76, 0x77, 0xa7, 0x57, 0x5c, 0x24, 0xc3, 0xa9, 0x2e, 0x64, 0x8f, 0x30, 0x21, 0xcb, 0xb5, 0x16,
-	0xc7, 0x61, 0x99, 0x0c, 0x3a, 0x94, 0xdb, 0xe6, 0x39, 0xfc, 0xd8, 0x3b, 0xcb, 0x0c, 0xd0, 0x10,
-	0xfb, 0x12, 0x96, 0x73, 0x0f, 0x10, 0x0b, 0xda, 0x69, 0x16, 0x3b, 0x43, 0x7a, 0x3e, 0x5f, 0x56,
-	0xe3, 0x6a, 0xd6, 0xe3, 0x7a, 0x17, 0x5a, 0x13, 0x47, 0x26, 0x12, 0x26, 0xd9, 0x5a, 0x56, 0x13,
-	0xcf, 0x52, 0xff, 0x40, 0xa2, 0x34, 0x63, 0xed, 0xbf, 0x96, 0xf2, 0x34, 0x96, 0xd5, 0x71, 0x07,
-	0x3a, 0xa2, 0xc8, 0x05, 0x43, 0xe6, 0x42, 0x09, 0x90, 0x6d, 0x58, 0x77, 0xc2, 0xe9, 0x94, 0x3b,
-	0xe2, 0x28, 0x10, 0x3c, 0x4e, 0xd9, 0x54, 0x2a, 0x6e, 0xd0, 0x3a, 0x4c, 0x36, 0xc1, 0x9c, 0x38,
-	0x52, 0x75, 0x77, 0x07, 0x4a, 0xd5, 0xd4, 0x9c, 0x38, 0x18, 0x73, 0x27, 0x9a, 0x1d, 0x87, 0xcc,
-	0x95, 0x49, 0x9e, 0xc7, 0x7c, 0xa0, 0x30, 0x9a, 0x93, 0x18, 0x0c, 0x11, 0xb3, 0x20, 0x61, 0x8e,
-	0xc0, 0x2b, 0x36, 0xa5, 0xac, 0x0a, 0xc6, 0x69, 0x89, 0x53, 0x5d, 0x08, 0xf7, 0xe0, 0x57, 0xca,
-	0x4f, 0x63, 0xe6, 0x70, 0x59, 0x0f, 0xf9, 0x9e, 0xdd, 0x12, 0xa7, 0xba, 0x10, 0x26, 0xb0, 0xcb,
-	0x04, 0x1b, 0x87, 0xb3, 0x18, 0xfd, 0x9f, 0x08, 0x59, 0x25, 0x79, 0x02, 0xef, 0x57, 0x28, 0x5a,
-	0x13, 0x25, 0x9f, 0xc1, 0x4a, 0xcc, 0x93, 0x28, 0x0c, 0x12, 0x8e, 0x05, 0x23, 0xeb, 0xa7, 0xbb,
-	0x73, 0x53, 0x6e, 0xa5, 0x1a, 0x41, 0x2b, 0x62, 0xe4, 0x53, 0x58, 0x76, 0x39, 0x73, 0xa7, 0xa1,
-	0xf3, 0x46, 0x56, 0x54, 0x77, 0x67, 0x55, 0x69, 0xcb, 0x40, 0x5a, 0xd0, 0x68, 0xde, 0xb9, 0x37,
-	0xe5, 0xfb, 0x3c, 0x71, 0x62, 0x2f, 0x12, 0x61, 0x5c, 0xa9, 0xaf, 0xef, 0x2a, 0x14, 0xad, 0x89,
-	0xa2, 0x79, 0xae, 0x17, 0x73, 0x47, 0xec, 0xcd, 0xce, 0xcf, 0x79, 0x9c, 0x15, 0x99, 0x32, 0x6f,
-	0x5f, 0x23, 0x68, 0x45, 0x0c, 0xbb, 0x99, 0xcf, 0x05, 0xc3, 0xbb, 0xca, 0x6a, 0xeb, 0xd0, 0x62,
-	0x6d, 0x7f, 0x0b, 0xeb, 0xb5, 0x36, 0x49, 0xee, 0x57, 0x7b, 0x70, 0x63, 0xbe, 0x07, 0x6b, 0x1d,
-	0xd8, 0xfe, 0xc7, 0x80, 0xae, 0xe6, 0x56, 0xd9, 0x1e, 0xdd, 0x2c, 0xbb, 0x4d, 0xcf, 0xc5, 0x2c,
-	0xd3, 0xba, 0xde, 0x20, 0x74, 0xb9, 0xcc, 0xb2, 0x26, 0xad, 0xc3, 0xd8, 0xbc, 0xd0, 0xa4, 0x33,
-	0x96, 0xa8, 0x5a, 0x53, 0xfd, 0xb4, 0x82, 0x61, 0xd3, 0x9c, 0xc5, 0x53, 0x99, 0x69, 0x1d, 0x8a,
-	0x9f, 0x64, 0x07, 0x6e, 0xa9, 0xf0, 0x0f, 0xc2, 0x20, 0xe0, 0x32, 0x6f, 0xc6, 0xde, 0x8f, 0x3c,
-	0xeb, 0xab, 0x0b, 0x39, 0x72, 0x1f, 0x6e, 0xfa, 0xec, 0x5d, 0x6d, 0x43, 0x4b, 0x6e, 0x98, 0x27,
-	0xec, 0x3d, 0x58, 0xaf, 0xe5, 0x0d, 0x79, 0x00, 0x50, 0x66, 0x4e, 0xe6, 0xa3, 0xf5, 0x5a, 0x82,
-	0x51, 0x4d, 0xc4, 0x7e, 0x0e, 0xeb, 0xb5, 0xe0, 0x92, 0x27, 0x70, 0x3b, 0x8c, 0x78, 0x50, 0x45,
-	0x07, 0xe1, 0x2c, 0x10, 0x59, 0xa9, 0x5e, 0x47, 0xdb, 0xff, 0x9a, 0xd0, 0x52, 0x15, 0x48, 0x6c,
-	0x58, 0x12, 0xd8, 0x16, 0x8c, 0x85, 0x6d, 0x41, 0x72, 0x78, 0xdb, 0xcb, 0xd4, 0x3f, 0xe1, 0x7e,
-	0x18, 0x5f, 0x1d, 0x72, 0x16, 0xbd, 0x4c, 0xb8, 0x9b, 0x55, 0xfa, 0x3c, 0x41, 0xee, 0x41, 0xaf,
-	0x02, 0x9e, 0xb0, 0x77, 0x32, 0x12, 0x0d, 0x3a, 0x87, 0xa3, 0xef, 0x0b, 0x6c, 0x18, 0x06, 0xc5,
-	0xe1, 0x4b, 0x52, 0x7e, 0x21, 0x47, 0x1e, 0xc2, 0x46, 0x1d, 0x47, 0x15, 0x4d, 0xb9, 0x65, 0x11,
-	0x45, 0x3e, 0x81, 0xd5, 0x4b, 0xbc, 0xd2, 0x8b, 0xa9, 0xab, 0xdc, 0xd3, 0x92, 0xb2, 0x55, 0x10,
-	0xb3, 0x27, 0x07, 0x64, 0xe9, 0xb6, 0xd5, 0xe8, 0xd3, 0x31, 0xf2, 0x24, 0x3b, 0x69, 0x9f, 0x0b,
-	0xe6, 0x4d, 0xb9, 0x9b, 0xd5, 0x37, 0x29, 0xdd, 0x96, 0x33, 0xb4, 0x2a, 0x68, 0xff, 0xd6, 0x80,
-	0xb5, 0xaa, 0x44, 0x61, 0xd6, 0x90, 0xbf, 0xd5, 0xa3, 0x56, 0x05, 0x0b, 0xb3, 0x86, 0xfc, 0xad,
-	0x34, 0xcb, 0xd4, 0xcc, 0xca, 0xb0, 0xcc, 0x8d, 0xa3, 0x30, 0x9c, 0x62, 0x1d, 0x0c, 0x98, 0x73,
-	0xc1, 0xa5, 0x1b, 0xd1, 0xed, 0x06, 0x5d, 0xc8, 0x65, 0x41, 0x45, 0x7c, 0xc8, 0xdf, 0x1e, 0xf0,
-	0xa0, 0xf0, 0xbb, 0x41, 0xe7, 0x09, 0x4d, 0xfa, 0xc5, 0xd4, 0xcd, 0xa5, 0x9b, 0x15, 0xe9, 0x92,
-	0x20, 0x5f, 0x82, 0x95, 0x81, 0xe3, 0x59, 0x9c, 0x7a, 0x69, 0x18, 0x8f, 0x23, 0xe6, 0x28, 0x9b,
-	0x5a, 0x72, 0xd3, 0xb5, 0x3c, 0xe9, 0x03, 0xc9, 0xb8, 0x11, 0x8f, 0xfd, 0x5c, 0x55, 0x5b, 0xee,
-	0x5a, 0xc0, 0x68, 0x77, 0xc7, 0x61, 0x9f, 0x14, 0x7a, 0x96, 0x2b, 0x77, 0xaf, 0x70, 0xf6, 0x08,
-	0x96, 0xf3, 0xf9, 0x82, 0xd3, 0xf7, 0x32, 0xf5, 0xb3, 0x95, 0x0c, 0x81, 0x41, 0x35, 0x04, 0xa3,
-	0x94, 0x5c, 0x25, 0x82, 0x17, 0x22, 0xa6, 0x14, 0xa9, 0x82, 0xf6, 0xdf, 0x26, 0xac, 0xe8, 0x63,
-	0x48, 0x76, 0x2d, 0xe6, 0x47, 0x53, 0xee, 0x16, 0xe1, 0xcd, 0x66, 0x63, 0x0d, 0x46, 0x67, 0x65,
-	0xd0, 0x20, 0x0c, 0x84, 0x17, 0xcc, 0x18, 0x1e, 0xa0, 0xb6, 0xa8, 0xba, 0xb9, 0x96, 0xc7, 0xb0,
-	0xcc, 0x82, 0xba, 0x1e, 0x55, 0x3c, 0xf3, 0x04, 0xf9, 0x06, 0x36, 0x0b, 0x70, 0x5e, 0x97, 0x2a,
-	0xa0, 0xf7, 0x48, 0xc8, 0x3b, 0xbd, 0xf1, 0xa2, 0x48, 0xd3, 0xd5, 0xca, 0xee, 0x54, 0x85, 0xe5,
-	0x9d, 0x14, 0x34, 0xaf, 0xa7, 0x9d, 0xdd, 0xe9, 0x1a, 0xde, 0xfe, 0xdd, 0x80, 0xff, 0xe9, 0xd3,
-	0xf9, 0xd0, 0x4b, 0x44, 0x38, 0x89, 0x99, 0xff, 0x9e, 0xc7, 0xcf, 0x43, 0xd8, 0xb8, 0xc8, 0xc5,
-	0xc6, 0xce, 0x05, 0xf7, 0x99, 0x7c, 0xeb, 0xa8, 0x39, 0xb1, 0x88, 0xc2, 0x2e, 0xa5, 0x0d, 0xfd,
-	0xdc, 0xdb, 0x8d, 0xed, 0x26, 0x9d, 0xc3, 0xed, 0x03, 0x58, 0xd1, 0x0d, 0x22, 0x5f, 0x40, 0xa7,
-	0x38, 0x32, 0xfb, 0xc7, 0xf8, 0xa0, 0xfe, 0xa6, 0x28, 0xac, 0xa6, 0xa5, 0xac, 0xfd, 0x18, 0x56,
-	0x2b, 0xaf, 0x00, 0x9c, 0x46, 0x2c, 0x9d, 0x64, 0x85, 0x8f, 0x9f, 0x88, 0xf8, 0xec, 0x5d, 0x96,
-	0x2b, 0xf8, 0x69, 0x53, 0xe8, 0x14, 0xef, 0x00, 0x7c, 0xa7, 0x3a, 0x45, 0xaf, 0x68, 0x52, 0xb5,
-	0xc0, 0x69, 0x22, 0x8a, 0x5f, 0x24, 0xf9, 0x82, 0xcc, 0xa7, 0x49, 0xf9, 0xe7, 0x44, 0x35, 0x11,
-	0xfb, 0x4f, 0x03, 0x56, 0x2b, 0x03, 0x1f, 0x9f, 0xa9, 0x6a, 0xe4, 0xeb, 0xad, 0x48, 0x87, 0xd0,
-	0x63, 0x6a, 0xa9, 0xfa, 0xab, 0x36, 0x04, 0xe6, 0x70, 0x3c, 0xcd, 0x67, 0x2a, 0xbc, 0x65, 0x1a,
-	0xeb, 0x10, 0x9e, 0xa6, 0x96, 0xda, 0x69, 0x2a, 0x71, 0xe7, 0xf0, 0x7b, 0x3f, 0x1b, 0x00, 0xe5,
-	0x50, 0x22, 0xb7, 0x61, 0xe3, 0xd9, 0xab, 0x93, 0xd7, 0x07, 0x83, 0xd7, 0xa7, 0x3f, 0x8c, 0x9e,
-	0xbe, 0x7e, 0x39, 0x7c, 0x3e, 0x7c, 0xf1, 0xfd, 0xb0, 0x77, 0x83, 0xfc, 0x1f, 0x88, 0x4e, 0x8c,
-	0x9f, 0xd2, 0xa3, 0xdd, 0xe3, 0x9e, 0x41, 0x2c, 0xb8, 0xa5, 0xe3, 0xa3, 0x5d, 0xba, 0x7b, 0x7c,
-	0xfc, 0xf4, 0xb8, 0x67, 0x92, 0x0d, 0x58, 0xd7, 0x99, 0xc1, 0xc9, 0xb8, 0xd7, 0x20, 0x04, 0xd6,
-	0x74, 0xf0, 0xe0, 0x51, 0x6f, 0x69, 0xef, 0x73, 0xf8, 0xd8, 0x09, 0xfd, 0x7e, 0xc0, 0x52, 0x1e,
-	0x3b, 0x61, 0x1c, 0xf5, 0x23, 0x2f, 0x88, 0x42, 0x2f, 0x10, 0xfd, 0x49, 0x1c, 0x39, 0x7d, 0x81,
-	0x21, 0xdf, 0xeb, 0xe0, 0x7b, 0x66, 0x84, 0x3f, 0xa8, 0x23, 0xe3, 0x0f, 0xb3, 0x31, 0x3a, 0x1a,
-	0x9e, 0xb5, 0xe4, 0xff, 0xea, 0xe3, 0xff, 0x02, 0x00, 0x00, 0xff, 0xff, 0xc0, 0x3e, 0x40, 0xa1,
-	0xf0, 0x0e, 0x00, 0x00,
+	// 1619 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x7c, 0x58, 0x4f, 0x73, 0xe3, 0x48,
+	0x15, 0x1f, 0xc9, 0xb1, 0x1d, 0xbf, 0xfc, 0xf3, 0x76, 0x06, 0x56, 0x84, 0x2d, 0xca, 0xa8, 0xa8,
+	0xad, 0xb0, 0xb5, 0xe5, 0xd9, 0xc9, 0x16, 0xec, 0xc2, 0x16, 0x50, 0x89, 0x33, 0x24, 0x33, 0x9b,
+	0x78, 0x5c, 0xed, 0x64, 0x29, 0x4e, 0x53, 0x1d, 0xa9, 0x63, 0x2b, 0x63, 0xa9, 0x55, 0x52, 0x5b,
+	0x33, 0x81, 0x0b, 0x57, 0xb8, 0xf0, 0x1d, 0xb8, 0x72, 0xe0, 0xc6, 0x95, 0x2b, 0xdf, 0x82, 0xaf,
+	0xc0, 0x47, 0xd8, 0x7a, 0xdd, 0x6d, 0xa9, 0x25, 0x27, 0x73, 0x73, 0xff, 0x7e, 0xef, 0x75, 0xbf,
+	0x7e, 0xff, 0xfa, 0xc9, 0x00, 0x53, 0xc9, 0xe4, 0x30, 0xcd, 0x84, 0x14, 0xc4, 0x2d, 0x9e, 0x1f,
+	0xfc, 0x78, 0x26, 0xc4, 0x6c, 0xc1, 0x9f, 0x29, 0xe4, 0x66, 0x79, 0xfb, 0x8c, 0xc7, 0xa9, 0xbc,
+	0xd7, 0x02, 0x07, 0xfd, 0xab, 0x79, 0xc6, 0x59, 0x78, 0xba, 0x8c, 0x53, 0x8d, 0xf8, 0x5d, 0x68,
+	0x4f, 0x26, 0x51, 0x32, 0xf3, 0xff, 0xe3, 0xc0, 0xf6, 0x04, 0xf7, 0xba, 0xe4, 0x79, 0xce, 0x66,
+	0x9c, 0x0c, 0xa1, 0xc7, 0x66, 0x3c, 0x91, 0x88, 0x79, 0xce, 0xc0, 0x39, 0xdc, 0x3a, 0xda, 0x1d,
+	0x16, 0xcf, 0x87, 0x93, 0xe3, 0x15, 0x7a, 0xfe, 0x84, 0x56, 0x22, 0xe4, 0x37, 0xb0, 0x5b, 0x2e,
+	0x4e, 0x98, 0x0c, 0xe6, 0x9e, 0xab, 0x94, 0xf6, 0xeb, 0x4a, 0x8a, 0x3a, 0x7f, 0x42, 0x1b, 0xc2,
+	0xe4, 0x2b, 0xd8, 0x56, 0xc8, 0x75, 0x16, 0xa9, 0x13, 0x5b, 0x4a, 0xf9, 0xa3, 0x4a, 0xd9, 0x10,
+	0xe7, 0x4f, 0x68, 0x4d, 0xf0, 0xa4, 0x0b, 0xed, 0xdb, 0x88, 0x2f, 0x42, 0xff, 0xaf, 0x2d, 0x00,
+	0x2d, 0xfa, 0x32, 0xb9, 0x15, 0xe4, 0x00, 0x36, 0xe7, 0x22, 0x97, 0x09, 0x8b, 0xb9, 0x32, 0xbf,
+	0x47, 0xcb, 0x35, 0xd9, 0x05, 0x37, 0x4a, 0x95, 0x7d, 0x3d, 0xea, 0x46, 0x29, 0x79, 0x0a, 0xed,
+	0x54, 0x64, 0x32, 0x57, 0xa7, 0xf6, 0xa8, 0x5e, 0x90, 0x01, 0x6c, 0xe5, 0x3c, 0x2b, 0xa2, 0x80,
+	0x5f, 0xdd, 0xa7, 0xdc, 0xdb, 0x18, 0x38, 0x87, 0x6d, 0x6a, 0x43, 0xa4, 0x0f, 0xad, 0x34, 0x0a,
+	0xbd, 0xb6, 0x62, 0xf0, 0x27, 0xf1, 0xcd, 0x35, 0xbe, 0xe3, 0x59, 0x1e, 0x89, 0xc4, 0xeb, 0xa8,
+	0x0d, 0x6b, 0x18, 0xf9, 0x04, 0x7a, 0x45, 0xbc, 0x12, 0xe8, 0x2a, 0x81, 0x0a, 0xc0, 0x1d, 0x78,
+	0x12, 0x5e, 0x45, 0x31, 0xcf, 0x25, 0x8b, 0x53, 0x6f, 0x73, 0xe0, 0x1c, 0xb6, 0x68, 0x0d, 0xc3,
+	0x1d, 0x78, 0x12, 0xe2, 0xf5, 0x97, 0xb9, 0xd7, 0x53, 0xa7, 0x57, 0x00, 0xf9, 0x06, 0x76, 0xd1,
+	0x48, 0x9e, 0x5d, 0x72, 0xc9, 0x4e, 0x99, 0x64, 0x1e, 0x58, 0x91, 0x98, 0xd6, 0x28, 0xda, 0x10,
+	0x25, 0x9f, 0x42, 0xf7, 0xae, 0x88, 0xd1, 0x83, 0xde, 0x96, 0xd2, 0xda, 0x56, 0x5a, 0xaf, 0x34,
+	0x46, 0x57, 0x24, 0x9a, 0x10, 0x88, 0x44, 0xb2, 0x28, 0xe1, 0x99, 0xb7, 0x3d, 0x70, 0x0e, 0x37,
+	0x69, 0x05, 0xf8, 0x7f, 0x86, 0xbd, 0xc6, 0x41, 0xe4, 0x27, 0x00, 0xfa, 0x28, 0xb5, 0xb7, 0x8e,
+	0x88, 0x85, 0x60, 0x0c, 0x8a, 0xf8, 0x38, 0x9b, 0x79, 0xee, 0xa0, 0x85, 0x31, 0x50, 0x0b, 0x72,
+	0x54, 0xc6, 0x40, 0xa9, 0xb5, 0x06, 0xad, 0xc3, 0xad, 0xa3, 0x7e, 0x79, 0x11, 0x83, 0x53, 0x5b,
+	0xc8, 0x9f, 0x60, 0x26, 0x57, 0x6b, 0x2b, 0x8e, 0xe3, 0x2a, 0x19, 0x6c, 0x68, 0x65, 0x5b, 0x14,
+	0xf0, 0x8b, 0xe8, 0xc6, 0x18, 0x60, 0x21, 0xfe, 0x1d, 0x6c, 0xae, 0x3c, 0x40, 0x3c, 0xe8, 0x16,
+	0x26, 0x76, 0x8e, 0xf2, 0xfc, 0x6a, 0x59, 0x8f, 0xab, 0xdb, 0x8c, 0xeb, 0xa7, 0xd0, 0x99, 0x05,
+	0x2a, 0x91, 0x30, 0xc9, 0x76, 0x4d, 0x31, 0xbd, 0x2a, 0xe2, 0x33, 0x85, 0x52, 0xc3, 0xfa, 0xff,
+	0xda, 0x58, 0xa5, 0xb1, 0x2a, 0xab, 0x4f, 0xa0, 0x27, 0xcb, 0x5c, 0x70, 0x54, 0x2e, 0x54, 0x00,
+	0x39, 0x84, 0xbd, 0x40, 0x2c, 0x16, 0x3c, 0x90, 0x2f, 0x13, 0xc9, 0xb3, 0x82, 0x2d, 0xd4, 0xc1,
+	0x2d, 0xda, 0x84, 0xc9, 0x01, 0xb8, 0xb3, 0xc0, 0x54, 0x15, 0x54, 0x47, 0x53, 0x77, 0x16, 0x60,
+	0xcc, 0x83, 0x74, 0x79, 0x21, 0x58, 0xe8, 0x6d, 0x58, 0x31, 0x1f, 0x69, 0x8c, 0xae, 0x48, 0x0c,
+	0x86, 0xcc, 0x58, 0x92, 0xb3, 0x40, 0xe2, 0x15, 0xdb, 0x03, 0xa7, 0x0c, 0xc6, 0x55, 0x85, 0x53,
+	0x5b, 0x08, 0x75, 0xf0, 0x57, 0xc1, 0xaf, 0x32, 0x16, 0x70, 0xaf, 0x63, 0xe9, 0x1c, 0x57, 0x38,
+	0xb5, 0x85, 0x30, 0x81, 0x43, 0x26, 0xd9, 0x54, 0x2c, 0x33, 0xf4, 0x7f, 0x2e, 0xbd, 0xae, 0x95,
+	0xc0, 0xa7, 0x35, 0x8a, 0x36, 0x44, 0xc9, 0x2f, 0x60, 0x3b, 0xe3, 0x79, 0x2a, 0x92, 0x9c, 0x63,
+	0xc1, 0x78, 0x9b, 0x56, 0x23, 0xa1, 0x16, 0x41, 0x6b, 0x62, 0xe4, 0xe7, 0xb0, 0x19, 0x72, 0x16,
+	0x2e, 0x44, 0xf0, 0x56, 0x55, 0xd4, 0xd6, 0xd1, 0x8e, 0x3e, 0xcd, 0x80, 0xb4, 0xa4, 0xd1, 0xbc,
+	0xdb, 0x68, 0xc1, 0x4f, 0x79, 0x1e, 0x64, 0x51, 0x2a, 0x45, 0x56, 0xab, 0xaf, 0xdf, 0xd7, 0x28,
+	0xda, 0x10, 0x45, 0xf3, 0xc2, 0x28, 0xe3, 0x81, 0x3c, 0x59, 0xde, 0xde, 0xf2, 0xcc, 0xdb, 0xb2,
+	0xcc, 0x3b, 0xb5, 0x08, 0x5a, 0x13, 0xc3, 0x6e, 0x16, 0x73, 0xc9, 0xf0, 0xae, 0xaa, 0xda, 0x7a,
+	0xb4, 0x5c, 0xfb, 0xbf, 0x83, 0xbd, 0x46, 0x7f, 0x25, 0x9f, 0xd7, 0x9b, 0x77, 0x6b, 0xbd, 0x79,
+	0x5b, 0xad, 0xdb, 0xff, 0x9f, 0x03, 0x5b, 0x96, 0x5b, 0x55, 0x7b, 0x0c, 0x4d, 0x76, 0xbb, 0x51,
+	0x88, 0x59, 0x66, 0x75, 0xbd, 0x91, 0x08, 0xb9, 0xca, 0xb2, 0x36, 0x6d, 0xc2, 0xd8, 0xbc, 0xd0,
+	0xa4, 0x1b, 0x96, 0xeb, 0x5a, 0xd3, 0xfd, 0xb4, 0x86, 0x61, 0xd3, 0x5c, 0x66, 0x0b, 0x95, 0x69,
+	0x3d, 0x8a, 0x3f, 0xc9, 0x11, 0x3c, 0xd5, 0xe1, 0x1f, 0x89, 0x24, 0xe1, 0x2a, 0x6f, 0xa6, 0xd1,
+	0x9f, 0xb8, 0xe9, 0xab, 0x0f, 0x72, 0xe4, 0x73, 0xf8, 0x28, 0x66, 0xef, 0x1b, 0x0a, 0x1d, 0xa5,
+	0xb0, 0x4e, 0xf8, 0x27, 0xb0, 0xd7, 0xc8, 0x1b, 0xf2, 0x0c, 0xa0, 0xca, 0x1c, 0xe3, 0xa3, 0xbd,
+	0x46, 0x82, 0x51, 0x4b, 0xc4, 0xff, 0x16, 0xf6, 0x1a, 0xc1, 0x25, 0x5f, 0xc3, 0xc7, 0x22, 0xe5,
+	0x49, 0x1d, 0x1d, 0x89, 0x65, 0x22, 0x4d, 0xa9, 0x3e, 0x46, 0xfb, 0xff, 0x77, 0xa1, 0xa3, 0x2b,
+	0x90, 0xf8, 0xb0, 0x21, 0xb1, 0x2d, 0x38, 0x0f, 0xb6, 0x05, 0xc5, 0xe1, 0x6d, 0xef, 0x8a, 0xf8,
+	0x92, 0xc7, 0x22, 0xbb, 0x3f, 0xe7, 0x2c, 0xbd, 0xce, 0x79, 0x68, 0x2a, 0x7d, 0x9d, 0x20, 0x9f,
+	0x41, 0xbf, 0x06, 0x5e, 0xb2, 0xf7, 0x2a, 0x12, 0x2d, 0xba, 0x86, 0xa3, 0xef, 0x4b, 0x6c, 0x2c,
+	0x92, 0x72, 0xf3, 0x0d, 0x25, 0xff, 0x20, 0x47, 0xbe, 0x80, 0xfd, 0x26, 0x8e, 0x47, 0xb4, 0x95,
+	0xca, 0x43, 0x14, 0xf9, 0x19, 0xec, 0xdc, 0xe1, 0x95, 0x5e, 0x2f, 0x42, 0xed, 0x9e, 0x8e, 0x92,
+	0xad, 0x83, 0x98, 0x3d, 0x2b, 0x40, 0x95, 0x6e, 0x57, 0x3f, 0x7d, 0x36, 0x46, 0xbe, 0x36, 0x3b,
+	0x9d, 0x72, 0xc9, 0xa2, 0x05, 0x0f, 0x4d, 0x7d, 0x93, 0xca, 0x6d, 0x2b, 0x86, 0xd6, 0x05, 0xfd,
+	0xbf, 0xb5, 0x60, 0xb7, 0x2e, 0x51, 0x9a, 0x35, 0xe6, 0xef, 0xec, 0xa8, 0xd5, 0xc1, 0xd2, 0xac,
+	0x31, 0x7f, 0xa7, 0xcc, 0x72, 0x2d, 0xb3, 0x0c, 0x66, 0xdc, 0x38, 0x11, 0x62, 0x81, 0x75, 0x30,
+	0x62, 0xc1, 0x9c, 0x2b, 0x37, 0xa2, 0xdb, 0x1d, 0xfa, 0x20, 0x67, 0x82, 0x8a, 0xf8, 0x98, 0xbf,
+	0x3b, 0xe3, 0x49, 0xe9, 0x77, 0x87, 0xae, 0x13, 0x96, 0xf4, 0xeb, 0x45, 0xb8, 0x92, 0x6e, 0xd7,
+	0xa4, 0x2b, 0x82, 0xfc, 0x1a, 0x3c, 0x03, 0x4e, 0x97, 0x59, 0x11, 0x15, 0x22, 0x9b, 0xa6, 0x2c,
+	0xd0, 0x36, 0x75, 0x94, 0xd2, 0xa3, 0x3c, 0x19, 0x02, 0x31, 0xdc, 0x84, 0x67, 0xf1, 0xea, 0xa8,
+	0xae, 0xd2, 0x7a, 0x80, 0xb1, 0xee, 0x8e, 0x8f, 0x7d, 0x5e, 0x9e, 0xb3, 0x59, 0xbb, 0x7b, 0x8d,
+	0xf3, 0x27, 0xb0, 0xb9, 0x7a, 0x5f, 0xf0, 0xf5, 0xbd, 0x2b, 0x62, 0xb3, 0x52, 0x21, 0x70, 0xa8,
+	0x85, 0x60, 0x94, 0xf2, 0xfb, 0x5c, 0xf2, 0x52, 0xc4, 0x55, 0x22, 0x75, 0xd0, 0xff, 0xaf, 0x0b,
+	0xdb, 0xf6, 0x33, 0xa4, 0xba, 0x16, 0x8b, 0xd3, 0x05, 0x0f, 0xcb, 0xf0, 0x9a, 0xb7, 0xb1, 0x01,
+	0xa3, 0xb3, 0x0c, 0x34, 0x12, 0x89, 0x8c, 0x92, 0x25, 0xc3, 0x0d, 0xb4, 0x8a, 0xae, 0x9b, 0x47,
+	0x79, 0x0c, 0xcb, 0x32, 0x69, 0x9e, 0xa3, 0x8b, 0x67, 0x9d, 0x20, 0xbf, 0x85, 0x83, 0x65, 0xf2,
+	0xd8, 0x5e, 0xa6, 0x80, 0x3e, 0x20, 0xa1, 0xee, 0xf4, 0x36, 0x4a, 0x53, 0xeb, 0xac, 0x8e, 0xb9,
+	0x53, 0x1d, 0x56, 0x77, 0xd2, 0xd0, 0xfa, 0x39, 0x5d, 0x73, 0xa7, 0x47, 0x78, 0xff, 0xef, 0x0e,
+	0xfc, 0xc0, 0x7e, 0x9d, 0xcf, 0xa3, 0x5c, 0x8a, 0x59, 0xc6, 0xe2, 0x0f, 0x0c, 0x3f, 0x5f, 0xc0,
+	0xfe, 0x7c, 0x25, 0x36, 0x0d, 0xe6, 0x3c, 0x66, 0x6a, 0xd6, 0xd1, 0xef, 0xc4, 0x43, 0x14, 0x76,
+	0x29, 0xeb, 0xd1, 0x5f, 0x79, 0xbb, 0x75, 0xd8, 0xa6, 0x6b, 0xb8, 0x7f, 0x06, 0xdb, 0xb6, 0x41,
+	0xe4, 0x2b, 0xe8, 0x95, 0x5b, 0x9a, 0x8f, 0x93, 0x1f, 0x35, 0x67, 0x8a, 0xd2, 0x6a, 0x5a, 0xc9,
+	0xfa, 0x5f, 0xc2, 0x4e, 0x6d, 0x0a, 0xc0, 0xd7, 0x88, 0x15, 0x33, 0x53, 0xf8, 0xf8, 0x13, 0x91,
+	0x98, 0xbd, 0x37, 0xb9, 0x82, 0x3f, 0x7d, 0x0a, 0xbd, 0x72, 0x0e, 0xc0, 0x39, 0x35, 0x28, 0x7b,
+	0x45, 0x9b, 0xea, 0x05, 0xbe, 0x26, 0xb2, 0xfc, 0xb6, 0xf2, 0x5c, 0xeb, 0x35, 0xa9, 0x3e, 0xb9,
+	0xa8, 0x25, 0xe2, 0xff, 0xd3, 0x81, 0x9d, 0xda, 0x83, 0x8f, 0x63, 0xaa, 0x7e, 0xf2, 0xed, 0x56,
+	0x64, 0x43, 0xe8, 0x31, 0xbd, 0xd4, 0xfd, 0xd5, 0x7a, 0x04, 0xd6, 0x70, 0xdc, 0x2d, 0x66, 0x3a,
+	0xbc, 0x55, 0x1a, 0xdb, 0x10, 0xee, 0xa6, 0x97, 0xd6, 0x6e, 0x3a, 0x71, 0xd7, 0x70, 0x3f, 0x82,
+	0x9d, 0xda, 0x57, 0x18, 0xd6, 0xe4, 0xcd, 0x32, 0x78, 0xcb, 0xcb, 0x0f, 0x1d, 0xed, 0x8d, 0x3a,
+	0x88, 0xc3, 0x1f, 0x67, 0xc1, 0xdc, 0x28, 0x19, 0xb7, 0xe8, 0xe1, 0xef, 0x45, 0x85, 0x53, 0x5b,
+	0xc8, 0xff, 0x37, 0x7e, 0x88, 0x5a, 0xac, 0x9e, 0x17, 0x22, 0x33, 0xb6, 0xe3, 0x4f, 0xf2, 0x2b,
+	0xd8, 0x95, 0x42, 0xb2, 0x45, 0x19, 0x61, 0xcf, 0xb5, 0xa6, 0xa8, 0xeb, 0x2c, 0xaa, 0x42, 0xdf,
+	0x10, 0x24, 0xdf, 0xc0, 0xde, 0xad, 0xea, 0xfd, 0x95, 0x6e, 0xeb, 0x31, 0xdd, 0xa6, 0x64, 0x7d,
+	0x16, 0xdf, 0x68, 0xcc, 0xe2, 0xfe, 0x35, 0xec, 0xd4, 0xf4, 0x31, 0x53, 0xd4, 0xe9, 0x26, 0x94,
+	0x7a, 0xb1, 0x9e, 0x5e, 0xb8, 0xed, 0xdc, 0xb2, 0x06, 0x2b, 0xa0, 0x02, 0x3e, 0xfb, 0x8b, 0x03,
+	0x50, 0xcd, 0x03, 0xe4, 0x63, 0xd8, 0x7f, 0xf5, 0xdd, 0xe5, 0x9b, 0xb3, 0xd1, 0x9b, 0xab, 0x3f,
+	0x4e, 0x5e, 0xbc, 0xb9, 0x1e, 0x7f, 0x3b, 0x7e, 0xfd, 0x87, 0x71, 0xff, 0x09, 0xf9, 0x21, 0x10,
+	0x9b, 0x98, 0xbe, 0xa0, 0x2f, 0x8f, 0x2f, 0xfa, 0x0e, 0xf1, 0xe0, 0xa9, 0x8d, 0x4f, 0x8e, 0xe9,
+	0xf1, 0xc5, 0xc5, 0x8b, 0x8b, 0xbe, 0x4b, 0xf6, 0x61, 0xcf, 0x66, 0x46, 0x97, 0xd3, 0x7e, 0x8b,
+	0x10, 0xd8, 0xb5, 0xc1, 0xb3, 0xe7, 0xfd, 0x8d, 0x93, 0x5f, 0xc2, 0x4f, 0x03, 0x11, 0x0f, 0x13,
+	0x56, 0xf0, 0x2c, 0x10, 0x59, 0x3a, 0x4c, 0xa3, 0x24, 0x15, 0x51, 0x22, 0x87, 0xb3, 0x2c, 0x0d,
+	0x86, 0x12, 0xab, 0xed, 0xa4, 0x87, 0xc1, 0x9a, 0x64, 0x42, 0x8a, 0x89, 0xf3, 0x0f, 0xb7, 0x35,
+	0x79, 0x39, 0xbe, 0xe9, 0xa8, 0xff, 0x18, 0xbe, 0xfc, 0x7e, 0x00, 0x87, 0xbe, 0x3e, 0xf5, 0xa4,
+	0x10, 0x00, 0x00,
 }
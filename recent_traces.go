@@ -0,0 +1,96 @@
+package pinpoint
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// TraceSummary is a summary of a span kept in the recent traces buffer.
+type TraceSummary struct {
+	TransactionId string
+	SpanId        int64
+	ParentSpanId  int64
+	AsyncId       int32
+	Operation     string
+	RpcName       string
+	EndPoint      string
+	RemoteAddr    string
+	StartTime     time.Time
+	Duration      time.Duration
+	Error         bool
+	SpanEvents    int
+}
+
+func newTraceSummary(span *span) TraceSummary {
+	return TraceSummary{
+		TransactionId: span.txId.String(),
+		SpanId:        span.spanId,
+		ParentSpanId:  span.parentSpanId,
+		AsyncId:       span.asyncId,
+		Operation:     span.operationName,
+		RpcName:       span.rpcName,
+		EndPoint:      span.endPoint,
+		RemoteAddr:    span.remoteAddr,
+		StartTime:     span.startTime,
+		Duration:      span.duration,
+		Error:         span.err != 0,
+		SpanEvents:    len(span.spanEvents),
+	}
+}
+
+// traceRing keeps the summaries of the last spans queued to be sent to the collector.
+type traceRing struct {
+	mux  sync.Mutex
+	buf  []TraceSummary
+	next int
+	full bool
+}
+
+func newTraceRing(size int) *traceRing {
+	if size <= 0 {
+		return nil
+	}
+	return &traceRing{buf: make([]TraceSummary, size)}
+}
+
+func (r *traceRing) add(summary TraceSummary) {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+
+	r.buf[r.next] = summary
+	r.next++
+	if r.next == len(r.buf) {
+		r.next = 0
+		r.full = true
+	}
+}
+
+// list returns the summaries from the newest.
+func (r *traceRing) list() []TraceSummary {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+
+	n := r.next
+	if r.full {
+		n = len(r.buf)
+	}
+
+	traces := make([]TraceSummary, 0, n)
+	for i := 1; i <= n; i++ {
+		traces = append(traces, r.buf[(r.next-i+len(r.buf))%len(r.buf)])
+	}
+	return traces
+}
+
+// RecentTracesHandler returns a http handler which writes the recent traces of the agent as JSON.
+// It is meant to be served on a debug port, as the traces can contain sensitive data.
+func RecentTracesHandler(agent Agent) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(agent.RecentTraces()); err != nil {
+			log("agent").Errorf("fail to write recent traces: %v", err)
+		}
+	})
+}
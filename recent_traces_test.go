@@ -0,0 +1,82 @@
+package pinpoint
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_traceRing(t *testing.T) {
+	assert.Nil(t, newTraceRing(0), "disabled")
+
+	r := newTraceRing(3)
+	assert.Equal(t, 0, len(r.list()), "empty")
+
+	for i := int64(1); i <= 5; i++ {
+		s := defaultSpan()
+		s.spanId = i
+		r.add(newTraceSummary(s))
+	}
+
+	var ids []int64
+	for _, summary := range r.list() {
+		ids = append(ids, summary.SpanId)
+	}
+	assert.Equal(t, []int64{5, 4, 3}, ids, "newest first")
+}
+
+func Test_agent_RecentTraces_Dropped(t *testing.T) {
+	c, _ := NewConfig(WithAppName("test"), WithAgentId("testagent"), WithSpanQueueSize(1),
+		WithSpanQueueFullPolicy(SpanQueueDropNewest), WithSpanRecentTraces(10))
+	c.OffGrpc = true
+	a, _ := NewAgent(c)
+	agent := a.(*agent)
+	agent.enable = true
+
+	queued, dropped := defaultSpan(), defaultSpan()
+	queued.spanId, dropped.spanId = 1, 2
+	assert.True(t, agent.TryEnqueueSpan(queued), "queued")
+	assert.False(t, agent.TryEnqueueSpan(dropped), "dropped")
+
+	traces := agent.RecentTraces()
+	assert.Equal(t, 1, len(traces), "len")
+	assert.Equal(t, int64(1), traces[0].SpanId, "only the queued span")
+}
+
+func Test_RecentTracesHandler(t *testing.T) {
+	c, _ := NewConfig(WithAppName("test"), WithAgentId("testagent"), WithSpanRecentTraces(10))
+	c.OffGrpc = true
+	a, _ := NewAgent(c)
+	agent := a.(*agent)
+	agent.enable = true
+
+	span := defaultSpan()
+	span.spanId = 7
+	span.rpcName = "/users/1"
+	assert.True(t, agent.TryEnqueueSpan(span), "enqueue")
+
+	w := httptest.NewRecorder()
+	RecentTracesHandler(agent).ServeHTTP(w, httptest.NewRequest("GET", "/debug/pinpoint/traces", nil))
+
+	assert.Equal(t, http.StatusOK, w.Code, "status")
+	assert.Equal(t, "application/json", w.Header().Get("Content-Type"), "content type")
+
+	var traces []TraceSummary
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &traces), "json")
+	assert.Equal(t, 1, len(traces), "len")
+	assert.Equal(t, int64(7), traces[0].SpanId, "span id")
+	assert.Equal(t, "/users/1", traces[0].RpcName, "rpc")
+}
+
+func Test_RecentTracesHandler_Disabled(t *testing.T) {
+	c, _ := NewConfig(WithAppName("test"), WithAgentId("testagent"))
+	c.OffGrpc = true
+	a, _ := NewAgent(c)
+
+	w := httptest.NewRecorder()
+	RecentTracesHandler(a).ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+	assert.Equal(t, "null\n", w.Body.String(), "no traces")
+}
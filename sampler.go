@@ -6,6 +6,15 @@ import (
 	"time"
 )
 
+// The types of the trace sampler set by WithSamplingType, which are named after those of the Pinpoint Java agent.
+// The sampled transactions of both types are limited to the throughput per second if it is set.
+const (
+	// SamplingTypeCounting samples 1/rate of the transactions.
+	SamplingTypeCounting = "COUNTING"
+	// SamplingTypePercent samples rate percent of the transactions.
+	SamplingTypePercent = "PERCENT"
+)
+
 type sampler interface {
 	isSampled() bool
 }
@@ -28,87 +37,250 @@ func (s *rateSampler) isSampled() bool {
 	return isSampled == 0
 }
 
+type percentSampler struct {
+	percent uint64
+	counter uint64
+}
+
+func newPercentSampler(percent uint64) *percentSampler {
+	return &percentSampler{
+		percent: percent,
+		counter: 0,
+	}
+}
+
+func (s *percentSampler) isSampled() bool {
+	count := atomic.AddUint64(&s.counter, s.percent) - s.percent
+	return count%100 < s.percent
+}
+
 type traceSampler interface {
 	isNewSampled() bool
 	isContinueSampled() bool
+	sampleNew() SpanStatus
+	sampleContinue() SpanStatus
+	tokens() (newTokens float64, continueTokens float64)
+}
+
+// SamplerState is a snapshot of the sampling settings in effect and the recent sampling decisions.
+type SamplerState struct {
+	Rate               int
+	ContinuationRate   int
+	NewThroughput      int
+	ContinueThroughput int
+
+	// estimated tokens left in the throughput limiters, -1 if the throughput is not limited
+	NewTokens      float64
+	ContinueTokens float64
+
+	// decisions since the last stat collection
+	SampledNew        int64
+	SampledContinue   int64
+	UnsampledNew      int64
+	UnsampledContinue int64
+	SkippedNew        int64
+	SkippedContinue   int64
+}
+
+func newTraceSampler(config *Config) traceSampler {
+	newSampler := func(rate int) sampler {
+		if config.Sampling.Type == SamplingTypePercent {
+			return newPercentSampler(uint64(rate))
+		}
+		return newRateSampler(uint64(rate))
+	}
+	baseSampler := newSampler(config.Sampling.Rate)
+
+	//continuation transactions are sampled at the same rate as new ones unless the rate is set
+	continueSampler := baseSampler
+	if config.Sampling.ContinuationRate > 0 {
+		continueSampler = newSampler(config.Sampling.ContinuationRate)
+	}
+
+	if config.Sampling.NewThroughput > 0 || config.Sampling.ContinueThroughput > 0 {
+		return newThroughputLimitTraceSampler(baseSampler, continueSampler, config.Sampling.NewThroughput, config.Sampling.ContinueThroughput)
+	}
+	return newBasicTraceSampler(baseSampler, continueSampler)
 }
 
 type basicTraceSampler struct {
-	baseSampler sampler
+	baseSampler     sampler
+	continueSampler sampler
 }
 
-func newBasicTraceSampler(base sampler) *basicTraceSampler {
+func newBasicTraceSampler(base sampler, cont sampler) *basicTraceSampler {
 	return &basicTraceSampler{
-		baseSampler: base,
+		baseSampler:     base,
+		continueSampler: cont,
 	}
 }
 
 func (s *basicTraceSampler) isNewSampled() bool {
-	sampled := s.baseSampler.isSampled()
-	if sampled {
+	return s.sampleNew() == SpanStatusSampled
+}
+
+func (s *basicTraceSampler) isContinueSampled() bool {
+	return s.sampleContinue() == SpanStatusSampled
+}
+
+func (s *basicTraceSampler) sampleNew() SpanStatus {
+	if s.baseSampler.isSampled() {
 		incrSampleNew()
-	} else {
-		incrUnsampleNew()
+		return SpanStatusSampled
 	}
-	return sampled
+
+	incrUnsampleNew()
+	return SpanStatusUnsampled
 }
 
-func (s *basicTraceSampler) isContinueSampled() bool {
-	sampled := s.baseSampler.isSampled()
-	if sampled {
+func (s *basicTraceSampler) tokens() (float64, float64) {
+	return -1, -1
+}
+
+func (s *basicTraceSampler) sampleContinue() SpanStatus {
+	if s.continueSampler.isSampled() {
 		incrSampleCont()
-	} else {
-		incrUnsampleCont()
+		return SpanStatusSampled
 	}
-	return sampled
+
+	incrUnsampleCont()
+	return SpanStatusUnsampled
 }
 
 type throughputLimitTraceSampler struct {
+	newLastAllowed        int64 //accessed atomically
+	continueLastAllowed   int64
 	baseSampler           sampler
+	continueSampler       sampler
 	newSamplelimiter      *rate.Limiter
 	continueSamplelimiter *rate.Limiter
 }
 
-func newThroughputLimitTraceSampler(base sampler, newTps int, continueTps int) *throughputLimitTraceSampler {
+func newThroughputLimitTraceSampler(base sampler, cont sampler, newTps int, continueTps int) *throughputLimitTraceSampler {
 	return &throughputLimitTraceSampler{
 		baseSampler:           base,
+		continueSampler:       cont,
 		newSamplelimiter:      rate.NewLimiter(per(newTps, time.Second), 1),
 		continueSamplelimiter: rate.NewLimiter(per(continueTps, time.Second), 1),
 	}
 }
 
 func per(throughput int, d time.Duration) rate.Limit {
+	if throughput <= 0 {
+		return rate.Inf
+	}
 	return rate.Every(d / time.Duration(throughput))
 }
 
 func (s *throughputLimitTraceSampler) isNewSampled() bool {
-	sampled := s.baseSampler.isSampled()
-	if sampled {
-		sampled = s.newSamplelimiter.Allow()
-		if sampled {
-			incrSampleNew()
-		} else {
-			incrSkipNew()
-		}
-	} else {
+	return s.sampleNew() == SpanStatusSampled
+}
+
+func (s *throughputLimitTraceSampler) isContinueSampled() bool {
+	return s.sampleContinue() == SpanStatusSampled
+}
+
+func (s *throughputLimitTraceSampler) sampleNew() SpanStatus {
+	if !s.baseSampler.isSampled() {
 		incrUnsampleNew()
+		return SpanStatusUnsampled
+	}
+
+	if !s.newSamplelimiter.Allow() {
+		incrSkipNew()
+		return SpanStatusDropped
 	}
+	atomic.StoreInt64(&s.newLastAllowed, time.Now().UnixNano())
 
-	return sampled
+	incrSampleNew()
+	return SpanStatusSampled
 }
 
-func (s *throughputLimitTraceSampler) isContinueSampled() bool {
-	sampled := s.baseSampler.isSampled()
-	if sampled {
-		sampled = s.continueSamplelimiter.Allow()
-		if sampled {
-			incrSampleCont()
+func (s *throughputLimitTraceSampler) sampleContinue() SpanStatus {
+	if !s.continueSampler.isSampled() {
+		incrUnsampleCont()
+		return SpanStatusUnsampled
+	}
+
+	if !s.continueSamplelimiter.Allow() {
+		incrSkipCont()
+		return SpanStatusDropped
+	}
+	atomic.StoreInt64(&s.continueLastAllowed, time.Now().UnixNano())
+
+	incrSampleCont()
+	return SpanStatusSampled
+}
+
+func (s *throughputLimitTraceSampler) tokens() (float64, float64) {
+	now := time.Now()
+	return estimateTokens(s.newSamplelimiter, atomic.LoadInt64(&s.newLastAllowed), now),
+		estimateTokens(s.continueSamplelimiter, atomic.LoadInt64(&s.continueLastAllowed), now)
+}
+
+func estimateTokens(limiter *rate.Limiter, lastAllowed int64, now time.Time) float64 {
+	//the limiter doesn't expose its tokens, so they are estimated from the time of the last allowed event
+	if limiter.Limit() == rate.Inf {
+		return -1
+	}
+
+	burst := float64(limiter.Burst())
+	if lastAllowed == 0 {
+		return burst
+	}
+
+	tokens := now.Sub(time.Unix(0, lastAllowed)).Seconds() * float64(limiter.Limit())
+	if tokens > burst {
+		return burst
+	}
+	return tokens
+}
+
+// SamplingKeyFunc extracts a sampling key, such as a tenant id, from the pinpoint context reader of the incoming request.
+// The reader of the http plugins reads the request header, and the reader of the grpc plugin reads the metadata.
+type SamplingKeyFunc func(reader DistributedTracingContextReader) string
+
+// keySampler samples the new transactions of the keys which have their own rate.
+type keySampler struct {
+	keyFunc  SamplingKeyFunc
+	samplers map[string]sampler
+}
+
+func newKeySampler(config *Config) *keySampler {
+	if config.Sampling.KeyFunc == nil || len(config.Sampling.KeyRates) == 0 {
+		return nil
+	}
+
+	s := &keySampler{
+		keyFunc:  config.Sampling.KeyFunc,
+		samplers: make(map[string]sampler, len(config.Sampling.KeyRates)),
+	}
+	for key, r := range config.Sampling.KeyRates {
+		if r > 0 {
+			s.samplers[key] = newRateSampler(uint64(r))
 		} else {
-			incrSkipCont()
+			s.samplers[key] = nil
 		}
-	} else {
-		incrUnsampleCont()
+	}
+	return s
+}
+
+// sampleNew returns false if the key of the request has no rate of its own.
+func (s *keySampler) sampleNew(reader DistributedTracingContextReader) (SpanStatus, bool) {
+	if s == nil {
+		return SpanStatusUnsampled, false
+	}
+
+	smp, ok := s.samplers[s.keyFunc(reader)]
+	if !ok {
+		return SpanStatusUnsampled, false
+	}
+
+	if smp != nil && smp.isSampled() {
+		incrSampleNew()
+		return SpanStatusSampled, true
 	}
 
-	return sampled
+	incrUnsampleNew()
+	return SpanStatusUnsampled, true
 }
@@ -1,6 +1,8 @@
 package pinpoint
 
 import (
+	"github.com/stretchr/testify/assert"
+	"net/http"
 	"testing"
 )
 
@@ -63,8 +65,8 @@ func Test_throughputLimitTraceSampler_isNewSampled(t *testing.T) {
 		fields fields
 		want   bool
 	}{
-		{"1", fields{newThroughputLimitTraceSampler(newRateSampler(1), 10, 10)}, true},
-		{"2", fields{newThroughputLimitTraceSampler(newRateSampler(10), 10, 10)}, false},
+		{"1", fields{newThroughputLimitTraceSampler(newRateSampler(1), newRateSampler(1), 10, 10)}, true},
+		{"2", fields{newThroughputLimitTraceSampler(newRateSampler(10), newRateSampler(10), 10, 10)}, false},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -75,3 +77,158 @@ func Test_throughputLimitTraceSampler_isNewSampled(t *testing.T) {
 		})
 	}
 }
+
+func Test_newTraceSampler_ContinuationRate(t *testing.T) {
+	tests := []struct {
+		name             string
+		rate             int
+		continuationRate int
+		wantNew          int
+		wantContinue     int
+	}{
+		{"1", 1, 0, 10, 10},
+		{"2", 1, 5, 10, 2},
+		{"3", 5, 1, 2, 10},
+		{"4", 5, 0, 2, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := defaultConfig()
+			config.Sampling.Rate = tt.rate
+			config.Sampling.ContinuationRate = tt.continuationRate
+			s := newTraceSampler(config)
+
+			newCount, continueCount := 0, 0
+			for i := 0; i < 10; i++ {
+				if s.isNewSampled() {
+					newCount++
+				}
+			}
+			for i := 0; i < 10; i++ {
+				if s.isContinueSampled() {
+					continueCount++
+				}
+			}
+			if newCount != tt.wantNew || continueCount != tt.wantContinue {
+				t.Errorf("sampled = %d/%d, want %d/%d", newCount, continueCount, tt.wantNew, tt.wantContinue)
+			}
+		})
+	}
+}
+
+func Test_newTraceSampler_Type(t *testing.T) {
+	tests := []struct {
+		name        string
+		typ         string
+		rate        int
+		throughput  int
+		wantSampled int
+		wantSkipped int64
+	}{
+		{"counting", SamplingTypeCounting, 1, 1, 1, 9},
+		{"counting rate", SamplingTypeCounting, 5, 0, 2, 0},
+		{"percent", SamplingTypePercent, 100, 1, 1, 9},
+		{"percent rate", SamplingTypePercent, 20, 0, 2, 0},
+		{"percent zero", SamplingTypePercent, 0, 0, 0, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := defaultConfig()
+			config.Sampling.Type = tt.typ
+			config.Sampling.Rate = tt.rate
+			config.Sampling.NewThroughput = tt.throughput
+			s := newTraceSampler(config)
+
+			_, _, _, _, skipped, _ := getSamplingCounts()
+			sampled := 0
+			for i := 0; i < 10; i++ {
+				if s.isNewSampled() {
+					sampled++
+				}
+			}
+			_, _, _, _, skippedAfter, _ := getSamplingCounts()
+			assert.Equal(t, tt.wantSampled, sampled, "sampled")
+			assert.Equal(t, tt.wantSkipped, skippedAfter-skipped, "skipped")
+		})
+	}
+}
+
+func Test_percentSampler(t *testing.T) {
+	s := newPercentSampler(30)
+	sampled := 0
+	for i := 0; i < 1000; i++ {
+		if s.isSampled() {
+			sampled++
+		}
+	}
+	assert.Equal(t, 300, sampled, "30 percent")
+}
+
+func Test_checkSamplingConfig(t *testing.T) {
+	tests := []struct {
+		name     string
+		typ      string
+		rate     int
+		wantType string
+		wantRate int
+	}{
+		{"counting", "COUNTING", 200, SamplingTypeCounting, 200},
+		{"lowercase", "percent", 20, SamplingTypePercent, 20},
+		{"percent over 100", SamplingTypePercent, 200, SamplingTypePercent, 100},
+		{"unknown", "RATE", 10, SamplingTypeCounting, 10},
+		{"empty", "", 10, SamplingTypeCounting, 10},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, _ := NewConfig(WithAppName("test"), WithAgentId("testagent"), WithSamplingType(tt.typ), WithSamplingRate(tt.rate))
+			assert.Equal(t, tt.wantType, c.Sampling.Type, "type")
+			assert.Equal(t, tt.wantRate, c.Sampling.Rate, "rate")
+		})
+	}
+}
+
+func Test_traceSampler_tokens(t *testing.T) {
+	newTokens, contTokens := newBasicTraceSampler(newRateSampler(1), newRateSampler(1)).tokens()
+	assert.Equal(t, float64(-1), newTokens, "basic")
+	assert.Equal(t, float64(-1), contTokens, "basic")
+
+	s := newThroughputLimitTraceSampler(newRateSampler(1), newRateSampler(1), 1, 0)
+	newTokens, contTokens = s.tokens()
+	assert.Equal(t, float64(1), newTokens, "initial")
+	assert.Equal(t, float64(-1), contTokens, "unlimited")
+
+	s.sampleNew()
+	newTokens, _ = s.tokens()
+	assert.Less(t, newTokens, float64(0.5), "after sampled")
+}
+
+func Test_keySampler_sampleNew(t *testing.T) {
+	config := defaultConfig()
+	assert.Nil(t, newKeySampler(config), "disabled")
+
+	config.Sampling.KeyFunc = func(reader DistributedTracingContextReader) string {
+		return reader.Get("X-Tenant-Id")
+	}
+	config.Sampling.KeyRates = map[string]int{"always": 1, "never": 0}
+	s := newKeySampler(config)
+
+	tests := []struct {
+		name   string
+		tenant string
+		want   SpanStatus
+		keyed  bool
+	}{
+		{"1", "always", SpanStatusSampled, true},
+		{"2", "never", SpanStatusUnsampled, true},
+		{"3", "other", SpanStatusUnsampled, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			header := http.Header{}
+			header.Set("X-Tenant-Id", tt.tenant)
+			status, keyed := s.sampleNew(HttpHeaderReader(header))
+			assert.Equal(t, tt.want, status, "status")
+			assert.Equal(t, tt.keyed, keyed, "keyed")
+		})
+	}
+}
@@ -0,0 +1,76 @@
+package pinpoint
+
+import (
+	"encoding/json"
+	"runtime"
+	"sync/atomic"
+
+	"google.golang.org/grpc"
+)
+
+// SelfTestCommand is the message of the echo command which makes the agent reply its health
+// instead of the message, so that a misbehaving agent can be diagnosed from the collector.
+const SelfTestCommand = "pinpoint:self-test"
+
+// AgentHealth is the reply of the self-test command.
+type AgentHealth struct {
+	Enable       bool
+	Connections  map[string]string
+	Streams      StreamStats
+	SpanQueue    int
+	MetaQueue    int
+	DroppedSpans int64
+	ActiveSpans  int
+	Goroutines   int
+	Sampler      SamplerState
+}
+
+func (agent *agent) health() AgentHealth {
+	health := AgentHealth{
+		Enable:       agent.Enable(),
+		Connections:  make(map[string]string),
+		Streams:      agent.StreamStats(),
+		SpanQueue:    len(agent.spanChan),
+		MetaQueue:    len(agent.metaChan),
+		DroppedSpans: atomic.LoadInt64(&droppedSpan),
+		Goroutines:   runtime.NumGoroutine(),
+		Sampler:      agent.SamplerState(),
+	}
+
+	conns := agent.grpc()
+	if conns.agent != nil {
+		health.Connections["agent"] = connState(conns.agent.agentConn)
+	}
+	if conns.span != nil {
+		health.Connections["span"] = connState(conns.span.spanConn)
+	}
+	if conns.stat != nil {
+		health.Connections["stat"] = connState(conns.stat.statConn)
+	}
+	if conns.cmd != nil {
+		health.Connections["command"] = connState(conns.cmd.agentConn)
+	}
+
+	activeSpan.Range(func(k, v interface{}) bool {
+		health.ActiveSpans++
+		return true
+	})
+
+	return health
+}
+
+func connState(conn *grpc.ClientConn) string {
+	if conn == nil {
+		return "NONE"
+	}
+	return conn.GetState().String()
+}
+
+func (agent *agent) selfTestMessage() string {
+	b, err := json.Marshal(agent.health())
+	if err != nil {
+		log("cmd").Errorf("fail to make self-test message: %v", err)
+		return err.Error()
+	}
+	return string(b)
+}
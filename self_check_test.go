@@ -0,0 +1,31 @@
+package pinpoint
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_agent_selfTestMessage(t *testing.T) {
+	opts := []ConfigOption{
+		WithAppName("test"),
+		WithAgentId("testagent"),
+	}
+	c, _ := NewConfig(opts...)
+	c.OffGrpc = true
+	a, _ := NewAgent(c)
+	agent := a.(*agent)
+	agent.enable = true
+	agent.spanChan = make(chan *span, 1)
+
+	agent.TryEnqueueSpan(defaultSpan())
+	agent.TryEnqueueSpan(defaultSpan())
+
+	var health AgentHealth
+	assert.NoError(t, json.Unmarshal([]byte(agent.selfTestMessage()), &health), "json")
+	assert.True(t, health.Enable, "Enable")
+	assert.Equal(t, 1, health.SpanQueue, "SpanQueue")
+	assert.GreaterOrEqual(t, health.DroppedSpans, int64(1), "DroppedSpans")
+	assert.Greater(t, health.Goroutines, 0, "Goroutines")
+}
@@ -0,0 +1,56 @@
+package pinpoint
+
+import "sync"
+
+// service types known to the pinpoint collector, which are used by this agent and its plugins
+var serviceTypes = map[int32]string{
+	100:                     "ASYNC",
+	1130:                    "GRPC_SERVER",
+	ServiceTypeGoApp:        "GO",
+	ServiceTypeGoFunction:   "GO_FUNCTION",
+	2100:                    "MYSQL",
+	2101:                    "MYSQL_EXECUTE_QUERY",
+	2500:                    "POSTGRESQL",
+	2501:                    "POSTGRESQL_EXECUTE_QUERY",
+	2600:                    "CASSANDRA",
+	2601:                    "CASSANDRA_EXECUTE_QUERY",
+	2650:                    "MONGO",
+	2651:                    "MONGO_EXECUTE_QUERY",
+	8200:                    "REDIS",
+	8660:                    "KAFKA_CLIENT",
+	8800:                    "HBASE_CLIENT",
+	9160:                    "GRPC",
+	9203:                    "ELASTICSEARCH",
+	ServiceTypeGoHttpClient: "GO_HTTP_CLIENT",
+}
+
+var serviceTypeMux sync.RWMutex
+var warnedServiceTypes sync.Map
+
+// RegisterServiceType adds a service type code to the known service types,
+// so that the agent doesn't warn about it. It is for the codes added to the collector later.
+func RegisterServiceType(code int32, name string) {
+	serviceTypeMux.Lock()
+	defer serviceTypeMux.Unlock()
+
+	serviceTypes[code] = name
+}
+
+func isKnownServiceType(code int32) bool {
+	serviceTypeMux.RLock()
+	defer serviceTypeMux.RUnlock()
+
+	_, ok := serviceTypes[code]
+	return ok
+}
+
+// checkServiceType logs a warning once for each unknown code. The code is used anyway.
+func checkServiceType(code int32) {
+	if isKnownServiceType(code) {
+		return
+	}
+
+	if _, warned := warnedServiceTypes.LoadOrStore(code, true); !warned {
+		log("agent").Warnf("unknown service type: %d, the collector may drop or mis-render the span", code)
+	}
+}
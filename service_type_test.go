@@ -0,0 +1,32 @@
+package pinpoint
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_isKnownServiceType(t *testing.T) {
+	tests := []struct {
+		name string
+		code int32
+		want bool
+	}{
+		{"1", ServiceTypeGoApp, true},
+		{"2", ServiceTypeGoHttpClient, true},
+		{"3", 2101, true},
+		{"4", 1234, false},
+		{"5", -1, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, isKnownServiceType(tt.code), "isKnownServiceType")
+		})
+	}
+}
+
+func Test_RegisterServiceType(t *testing.T) {
+	assert.False(t, isKnownServiceType(9999), "before")
+	RegisterServiceType(9999, "NEW_CLIENT")
+	assert.True(t, isKnownServiceType(9999), "after")
+}
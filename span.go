@@ -2,14 +2,21 @@ package pinpoint
 
 import (
 	"container/list"
+	"context"
+	"math"
 	"math/rand"
+	"runtime/pprof"
 	"strconv"
 	"strings"
+	"sync"
 	"sync/atomic"
 	"time"
+
+	pb "github.com/pinpoint-apm/pinpoint-go-agent/protobuf"
 )
 
 var asyncIdGen int32 = 0
+var candidateSpanCount int32 = 0
 
 type span struct {
 	agent              Agent
@@ -24,6 +31,7 @@ type span struct {
 	endPoint           string
 	remoteAddr         string
 	acceptorHost       string
+	uriTemplate        string
 	spanEvents         []*spanEvent
 	annotations        annotation
 	loggingInfo        int32
@@ -38,15 +46,44 @@ type span struct {
 	sampled       bool
 	flags         int
 	err           int
+	errorFuncId   int32
+	errorString   string
 	asyncId       int32
+
+	//the W3C Trace Context of the caller, which is passed on to the downstream
+	w3cTraceId    string
+	w3cTraceState string
+
 	asyncSequence int32
+	asyncEvents   map[int32]*spanEvent //the span events by their async id, looked up by the goroutines making async spans
 	stack         *list.List
+
+	//an unsampled span which is sent only if it turns out to be worth keeping
+	candidate bool
+
+	//guards what the owner goroutine records against finishOnMaxDuration, which copies the span on a timer goroutine
+	mux              *sync.Mutex
+	maxDurationTimer *time.Timer
+	finished         int32
 }
 
 func toMicroseconds(d time.Duration) int64 { return int64(d) / 1e3 }
 
 func toMilliseconds(d time.Duration) int64 { return int64(d) / 1e6 }
 
+// elapsedMilliseconds converts a duration to the int32 milliseconds of the span message.
+// A negative duration, which a wall clock stepping backwards can cause, is clamped to zero.
+func elapsedMilliseconds(d time.Duration) int32 {
+	ms := toMilliseconds(d)
+	if ms < 0 {
+		return 0
+	}
+	if ms > math.MaxInt32 {
+		return math.MaxInt32
+	}
+	return int32(ms)
+}
+
 func generateSpanId() int64 {
 	return rand.Int63()
 }
@@ -62,6 +99,8 @@ func defaultSpan() *span {
 	span.startTime = time.Now()
 
 	span.stack = list.New()
+	span.mux = &sync.Mutex{}
+	span.annotations.mux = span.mux
 	return &span
 }
 
@@ -69,12 +108,21 @@ func newSampledSpan(agent Agent, operation string) Tracer {
 	span := defaultSpan()
 
 	span.agent = agent
-	span.operationName = operation
+	span.operationName = truncateName(operation)
 
 	return span
 }
 
 func (span *span) EndSpan() {
+	if span.maxDurationTimer != nil {
+		span.maxDurationTimer.Stop()
+	}
+
+	if !atomic.CompareAndSwapInt32(&span.finished, 0, 1) {
+		//already sent when the max duration was exceeded
+		return
+	}
+
 	for e := span.stack.Front(); e != nil; e = e.Next() {
 		se := e.Value.(*spanEvent)
 		se.end()
@@ -83,18 +131,175 @@ func (span *span) EndSpan() {
 	dropActiveSpan(span.spanId)
 
 	span.duration = time.Now().Sub(span.startTime)
-	collectResponseTime(toMilliseconds(span.duration))
+	span.send()
+}
+
+func (span *span) send() {
+	elapsed := int64(elapsedMilliseconds(span.duration))
+	collectResponseTime(elapsed)
+	if span.uriTemplate != "" && span.agent.Config().Http.UriStat {
+		collectUriStat(span.uriTemplate, elapsed, span.err != 0)
+	}
+
+	if span.candidate {
+		atomic.AddInt32(&candidateSpanCount, -1)
+		if !span.worthKeeping() {
+			return
+		}
+		log("span").Debug("keep unsampled span: ", span.txId, span.duration)
+	}
 
+	span.sampleAnnotations()
 	if !span.agent.TryEnqueueSpan(span) {
 		log("span").Debug("span channel - max capacity reached or closed")
 	}
 }
 
+// EndSpanWithStatus records err as the outcome of the span if it is not nil, and ends the span.
+func (span *span) EndSpanWithStatus(err error) {
+	if err != nil {
+		span.SetError(err)
+	}
+	span.EndSpan()
+}
+
+func (span *span) startMaxDurationTimer() {
+	if span.agent == nil {
+		return
+	}
+
+	max := time.Duration(span.agent.Config().Span.MaxDuration) * time.Millisecond
+	if max <= 0 {
+		return
+	}
+
+	if span.maxDurationTimer != nil {
+		span.maxDurationTimer.Stop()
+	}
+	span.maxDurationTimer = time.AfterFunc(max, span.finishOnMaxDuration)
+}
+
+// finishOnMaxDuration sends a copy of the span, which is still in progress, as if it ended now.
+// What is recorded on the span afterwards is not sent, and EndSpan does nothing but cleanup.
+func (span *span) finishOnMaxDuration() {
+	if !atomic.CompareAndSwapInt32(&span.finished, 0, 1) {
+		return
+	}
+
+	now := time.Now()
+	log("span").Warn("max duration exceeded, finish the span: ", span.txId, span.spanId)
+	dropActiveSpan(span.spanId)
+
+	finished := span.snapshot(now)
+	finished.send()
+}
+
+// snapshot copies the span and its span events as if they ended at now, while the owner goroutine may still record on them.
+func (span *span) snapshot(now time.Time) *span {
+	span.mux.Lock()
+	defer span.mux.Unlock()
+
+	finished := *span
+	finished.duration = now.Sub(span.startTime)
+	finished.annotations = annotation{list: append([]*pb.PAnnotation(nil), span.annotations.list...)}
+	finished.annotations.AppendString(AnnotationMaxDurationExceeded, "max-duration-exceeded")
+
+	inProgress := make(map[*spanEvent]bool)
+	for e := span.stack.Front(); e != nil; e = e.Next() {
+		inProgress[e.Value.(*spanEvent)] = true
+	}
+
+	finished.spanEvents = make([]*spanEvent, len(span.spanEvents))
+	for i, se := range span.spanEvents {
+		e := *se
+		e.annotations = annotation{list: append([]*pb.PAnnotation(nil), se.annotations.list...)}
+		if inProgress[se] && !e.isTimeFixed {
+			e.duration = now.Sub(e.startTime)
+		}
+		finished.spanEvents[i] = &e
+	}
+	return &finished
+}
+
+func (span *span) worthKeeping() bool {
+	threshold := time.Duration(span.agent.Config().Sampling.KeepSlowThreshold) * time.Millisecond
+	return span.duration >= threshold
+}
+
+// slow reports whether the span is slower than Sampling.KeepSlowThreshold, if the threshold is set.
+func (span *span) slow() bool {
+	return span.agent.Config().Sampling.KeepSlowThreshold > 0 && span.worthKeeping()
+}
+
+var annotationSampleCounter uint64
+
+// sampleAnnotations drops the span event annotations of a span which is neither failed nor slow,
+// except for 1 of every Annotation.SampleRate spans. The SQL of the span events is kept.
+// A span is slow by the same threshold as the transactions kept by the tail-based sampling.
+// The span events are copied, as those of a span finished by the max duration are still in use.
+func (span *span) sampleAnnotations() {
+	config := span.agent.Config().Annotation
+	if config.SampleRate <= 1 || span.failed() || span.slow() {
+		return
+	}
+	if atomic.AddUint64(&annotationSampleCounter, 1)%uint64(config.SampleRate) == 0 {
+		return
+	}
+
+	sampled := false
+	events := make([]*spanEvent, len(span.spanEvents))
+	for i, se := range span.spanEvents {
+		events[i] = se
+		if len(se.annotations.list) == 0 {
+			continue
+		}
+
+		kept := make([]*pb.PAnnotation, 0, 1)
+		for _, a := range se.annotations.list {
+			if a.Key == AnnotationSqlId {
+				kept = append(kept, a)
+			}
+		}
+		if len(kept) < len(se.annotations.list) {
+			stripped := *se
+			stripped.annotations = annotation{list: kept}
+			events[i] = &stripped
+			sampled = true
+		}
+	}
+
+	if sampled {
+		span.spanEvents = events
+		span.annotations.AppendString(AnnotationSampledOut, "annotations sampled out")
+	}
+}
+
+func (span *span) failed() bool {
+	if span.err != 0 {
+		return true
+	}
+	for _, se := range span.spanEvents {
+		if se.errorString != "" {
+			return true
+		}
+	}
+	return false
+}
+
 func (span *span) Inject(writer DistributedTracingContextWriter) {
+	if span.candidate {
+		//the downstream can't know if this span is kept at the end
+		writer.Set(HttpSampled, "s0")
+		return
+	}
+
 	writer.Set(HttpTraceId, span.txId.String())
 
 	se := span.stack.Front().Value.(*spanEvent)
+	span.mux.Lock()
 	nextSpanId := se.generateNextSpanId()
+	se.endPoint = se.destinationId
+	span.mux.Unlock()
 	writer.Set(HttpSpanId, strconv.FormatInt(nextSpanId, 10))
 
 	writer.Set(HttpParentSpanId, strconv.FormatInt(span.spanId, 10))
@@ -103,19 +308,19 @@ func (span *span) Inject(writer DistributedTracingContextWriter) {
 	writer.Set(HttpParentApplicationType, strconv.Itoa(int(span.agent.Config().ApplicationType)))
 	writer.Set(HttpParentApplicationNamespace, "")
 
-	se.endPoint = se.destinationId
 	writer.Set(HttpHost, se.destinationId)
 
+	if span.agent.Config().Propagation.W3C {
+		span.injectW3C(writer, nextSpanId)
+	}
+
 	log("span").Debug("span inject: ", span.txId, nextSpanId, span.spanId, se.destinationId)
 }
 
 func (span *span) Extract(reader DistributedTracingContextReader) {
 	tid := reader.Get(HttpTraceId)
-	if tid != "" {
-		s := strings.Split(tid, "^")
-		span.txId.AgentId = s[0]
-		span.txId.StartTime, _ = strconv.ParseInt(s[1], 10, 0)
-		span.txId.Sequence, _ = strconv.ParseInt(s[2], 10, 0)
+	if txId, ok := ParseTransactionId(tid); ok {
+		span.txId = txId
 	} else {
 		span.txId = span.agent.GenerateTransactionId()
 	}
@@ -161,12 +366,53 @@ func (span *span) Extract(reader DistributedTracingContextReader) {
 		span.sampled = true
 	}
 
+	if span.agent != nil && span.agent.Config().Propagation.W3C {
+		if tp, ok := parseTraceParent(reader.Get(W3CTraceParent)); ok {
+			span.w3cTraceId = tp.traceId
+			span.w3cTraceState = reader.Get(W3CTraceState)
+		}
+	}
+
 	addActiveSpan(span.spanId, span.startTime)
+	span.startMaxDurationTimer()
 	log("span").Debug("span extract: ", tid, spanid, pappname, pspanid, papptype, host, sampled)
 }
 
+// ParseTransactionId parses the transaction id of the Pinpoint-TraceID header, which is in the form of agentId^startTime^sequence.
+func ParseTransactionId(tid string) (TransactionId, bool) {
+	var txId TransactionId
+	var err error
+
+	s := strings.Split(tid, "^")
+	if len(s) != 3 {
+		return txId, false
+	}
+
+	txId.AgentId = s[0]
+	if txId.StartTime, err = strconv.ParseInt(s[1], 10, 0); err != nil {
+		return txId, false
+	}
+	if txId.Sequence, err = strconv.ParseInt(s[2], 10, 0); err != nil {
+		return txId, false
+	}
+
+	return txId, true
+}
+
 func (span *span) NewSpanEvent(operationName string) Tracer {
-	se := newSpanEvent(span, operationName)
+	return span.pushSpanEvent(newSpanEvent(span, operationName))
+}
+
+func (span *span) NewSpanEventWithApiId(apiId int32) Tracer {
+	se := newSpanEvent(span, "")
+	se.apiId = apiId
+	return span.pushSpanEvent(se)
+}
+
+func (span *span) pushSpanEvent(se *spanEvent) Tracer {
+	span.mux.Lock()
+	defer span.mux.Unlock()
+
 	span.eventSequence++
 	span.eventDepth++
 
@@ -177,26 +423,91 @@ func (span *span) NewSpanEvent(operationName string) Tracer {
 }
 
 func (span *span) EndSpanEvent() {
+	span.mux.Lock()
+	defer span.mux.Unlock()
+
 	if span.stack.Len() > 0 {
 		e := span.stack.Front()
 		span.stack.Remove(e).(*spanEvent).end()
 	}
 }
 
+// EndSpanEventWithStatus records err on the current span event if it is not nil, and ends the span event.
+func (span *span) EndSpanEventWithStatus(err error) {
+	if span.stack.Len() > 0 {
+		span.stack.Front().Value.(*spanEvent).SetError(err)
+	}
+	span.EndSpanEvent()
+}
+
 func (span *span) NewAsyncSpan() Tracer {
-	se := span.stack.Front().Value.(*spanEvent)
+	return span.NewAsyncSpanWithId(span.AsyncId())
+}
+
+func (span *span) NewAsyncSpanWithId(asyncId int32) Tracer {
+	if span.candidate {
+		return newNoopSpan(span.agent)
+	}
+
+	se := span.findAsyncSpanEvent(asyncId)
+	if se == nil {
+		log("span").Warn("no span event for async id: ", asyncId)
+		return newNoopSpan(span.agent)
+	}
+
 	asyncSpan := newSpanForAsync(span)
+	asyncSpan.asyncId = asyncId
+	asyncSpan.asyncSequence = atomic.AddInt32(&se.asyncSeqGen, 1)
+	asyncSpan.newSpanEventForAsync()
+
+	return asyncSpan
+}
 
+func (span *span) AsyncId() int32 {
+	if span.stack.Len() == 0 {
+		return 0
+	}
+
+	span.mux.Lock()
+	defer span.mux.Unlock()
+
+	se := span.stack.Front().Value.(*spanEvent)
 	if se.asyncId == 0 {
 		se.asyncId = atomic.AddInt32(&asyncIdGen, 1)
+		if span.asyncEvents == nil {
+			span.asyncEvents = make(map[int32]*spanEvent)
+		}
+		span.asyncEvents[se.asyncId] = se
 	}
-	asyncSpan.asyncId = se.asyncId
+	return se.asyncId
+}
 
-	se.asyncSeqGen++
-	asyncSpan.asyncSequence = se.asyncSeqGen
-	asyncSpan.newSpanEventForAsync()
+func (span *span) findAsyncSpanEvent(asyncId int32) *spanEvent {
+	if asyncId == 0 {
+		return nil
+	}
 
-	return asyncSpan
+	span.mux.Lock()
+	defer span.mux.Unlock()
+	return span.asyncEvents[asyncId]
+}
+
+func (span *span) WrapGo(ctx context.Context, f func(ctx context.Context)) {
+	asyncTracer := span.NewAsyncSpan()
+	go span.runAsync(ctx, asyncTracer, f)
+}
+
+// runAsync runs f with the async tracer in its context. If f panics, FinalizeSpan records the panic
+// on the async span and ends it before panicking again.
+func (span *span) runAsync(ctx context.Context, asyncTracer Tracer, f func(ctx context.Context)) {
+	defer FinalizeSpan(asyncTracer)
+	ctx = NewContext(ctx, asyncTracer)
+
+	if profileLabelsEnabled(span.agent) {
+		pprof.Do(ctx, ProfileLabels(span), f)
+	} else {
+		f(ctx)
+	}
 }
 
 func newSpanForAsync(parentSpan *span) *span {
@@ -205,6 +516,8 @@ func newSpanForAsync(parentSpan *span) *span {
 	span.agent = parentSpan.agent
 	span.txId = parentSpan.txId
 	span.spanId = parentSpan.spanId
+	span.w3cTraceId = parentSpan.w3cTraceId
+	span.w3cTraceState = parentSpan.w3cTraceState
 
 	return span
 }
@@ -213,12 +526,7 @@ func (span *span) newSpanEventForAsync() {
 	se := newSpanEvent(span, "")
 	se.serviceType = 100 // ASYNC
 	se.apiId = asyncApiId
-
-	span.eventSequence++
-	span.eventDepth++
-
-	span.spanEvents = append(span.spanEvents, se)
-	span.stack.PushFront(se)
+	span.pushSpanEvent(se)
 }
 
 func (span *span) TransactionId() TransactionId {
@@ -238,32 +546,63 @@ func (span *span) SpanEvent() SpanEventRecorder {
 }
 
 func (span *span) SetError(e error) {
-	//se := span.stack.Front().Value.(*spanEvent)
-	//se.SetError(e)
+	var id int32
+	if e != nil {
+		id = span.agent.CacheErrorFunc(span.operationName)
+	}
+
+	span.mux.Lock()
+	defer span.mux.Unlock()
+
 	span.err = 1
+	if e == nil {
+		return
+	}
+
+	span.errorFuncId = id
+	span.errorString = e.Error()
 }
 
 func (span *span) SetApiId(id int32) {
+	span.mux.Lock()
+	defer span.mux.Unlock()
+
 	span.apiId = id
 }
 
 func (span *span) SetServiceType(typ int32) {
+	span.mux.Lock()
+	defer span.mux.Unlock()
+
+	checkServiceType(typ)
 	span.serviceType = typ
 }
 
 func (span *span) SetRpcName(rpc string) {
-	span.rpcName = rpc
+	span.mux.Lock()
+	defer span.mux.Unlock()
+
+	span.rpcName = truncateName(rpc)
 }
 
 func (span *span) SetRemoteAddress(remoteAddress string) {
+	span.mux.Lock()
+	defer span.mux.Unlock()
+
 	span.remoteAddr = remoteAddress
 }
 
 func (span *span) SetEndPoint(endPoint string) {
+	span.mux.Lock()
+	defer span.mux.Unlock()
+
 	span.endPoint = endPoint
 }
 
 func (span *span) SetAcceptorHost(host string) {
+	span.mux.Lock()
+	defer span.mux.Unlock()
+
 	span.acceptorHost = host
 }
 
@@ -272,5 +611,34 @@ func (span *span) Annotations() Annotation {
 }
 
 func (span *span) SetLogging(logInfo int32) {
+	span.mux.Lock()
+	defer span.mux.Unlock()
+
 	span.loggingInfo = logInfo
 }
+
+// SetParentApplication sets the caller of the transaction recorded for the server map,
+// in place of the one passed by the Pinpoint-pAppName and Pinpoint-pAppType headers.
+func (span *span) SetParentApplication(name string, typ int) {
+	span.mux.Lock()
+	defer span.mux.Unlock()
+
+	span.parentAppName = name
+	span.parentAppType = typ
+}
+
+func (span *span) RecordAttribute(key string, value interface{}) {
+	span.annotations.appendAttribute(key, value)
+}
+
+func (span *span) AddLink(txId TransactionId) {
+	span.annotations.AppendString(AnnotationLinkedTransaction, txId.String())
+}
+
+// SetUriTemplate sets the route template of the request, such as /users/:id, which URI stats are collected by.
+func (span *span) SetUriTemplate(template string) {
+	span.mux.Lock()
+	defer span.mux.Unlock()
+
+	span.uriTemplate = template
+}
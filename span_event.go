@@ -1,6 +1,9 @@
 package pinpoint
 
 import (
+	"fmt"
+	"runtime"
+	"strings"
 	"time"
 )
 
@@ -17,6 +20,7 @@ type spanEvent struct {
 	annotations   annotation
 	endPoint      string
 	destinationId string
+	destOverride  string
 	errorFuncId   int32
 	errorString   string
 	asyncId       int32
@@ -33,12 +37,13 @@ func newSpanEvent(span *span, operationName string) *spanEvent {
 	se.startElapsed = se.startTime.Sub(span.startTime)
 	se.sequence = span.eventSequence
 	se.depth = span.eventDepth
-	se.operationName = operationName
+	se.operationName = truncateName(operationName)
 	se.endPoint = ""
 	se.asyncId = 0
 	se.asyncSeqGen = 0
 	se.serviceType = ServiceTypeGoFunction
 	se.isTimeFixed = false
+	se.annotations.mux = span.mux
 
 	return &se
 }
@@ -50,6 +55,20 @@ func (se *spanEvent) end() {
 	}
 }
 
+// lock guards what is recorded on the span event against the copy of the span made when the max duration is exceeded.
+// A span event which does not belong to a span made by defaultSpan has nothing to guard.
+func (se *spanEvent) lock() {
+	if se.parentSpan != nil && se.parentSpan.mux != nil {
+		se.parentSpan.mux.Lock()
+	}
+}
+
+func (se *spanEvent) unlock() {
+	if se.parentSpan != nil && se.parentSpan.mux != nil {
+		se.parentSpan.mux.Unlock()
+	}
+}
+
 func (se *spanEvent) generateNextSpanId() int64 {
 	se.nextSpanId = generateSpanId()
 	return se.nextSpanId
@@ -61,23 +80,115 @@ func (se *spanEvent) SetError(e error) {
 	}
 
 	id := se.parentSpan.agent.CacheErrorFunc(se.operationName)
+	se.lock()
 	se.errorFuncId = id
 	se.errorString = e.Error()
+	se.unlock()
+
+	if depth := se.parentSpan.agent.Config().Span.ErrorStackDepth; depth > 0 {
+		se.annotations.AppendString(AnnotationErrorStack, errorStack(depth))
+	}
+}
+
+const maxErrorStackDepth = 64
+
+// errorStack formats the call stack of the goroutine setting an error, up to depth frames,
+// without the frames of the span event methods.
+func errorStack(depth int) string {
+	if depth > maxErrorStackDepth {
+		depth = maxErrorStackDepth
+	}
+
+	pcs := make([]uintptr, depth+4)
+	n := runtime.Callers(2, pcs)
+	return formatFrames(runtime.CallersFrames(pcs[:n]), depth, func(f runtime.Frame) bool {
+		return strings.Contains(f.Function, ".(*spanEvent).")
+	})
+}
+
+func formatFrames(frames *runtime.Frames, depth int, skip func(f runtime.Frame) bool) string {
+	var b strings.Builder
+	for count, more := 0, true; more && count < depth; {
+		var f runtime.Frame
+		f, more = frames.Next()
+		if f.Function == "" || skip(f) {
+			continue
+		}
+
+		if count > 0 {
+			b.WriteByte('\n')
+		}
+		fmt.Fprintf(&b, "%s\n\t%s:%d", f.Function, f.File, f.Line)
+		count++
+	}
+	return b.String()
+}
+
+func (se *spanEvent) SetErrorWithSpan(e error, markSpan bool) {
+	if e == nil {
+		return
+	}
+
+	se.SetError(e)
+	if markSpan {
+		se.parentSpan.SetError(e)
+	}
+}
+
+func (se *spanEvent) SetTransportError(e error) {
+	if e == nil {
+		return
+	}
+
+	se.SetError(e)
+	//the request did not reach the server, so no span will be made with the next span id
+	se.lock()
+	se.nextSpanId = -1
+	se.unlock()
 }
 
 func (se *spanEvent) SetApiId(id int32) {
+	se.lock()
+	defer se.unlock()
+
 	se.apiId = id
 }
 
 func (se *spanEvent) SetServiceType(typ int32) {
+	se.lock()
+	defer se.unlock()
+
+	checkServiceType(typ)
 	se.serviceType = typ
 }
 
 func (se *spanEvent) SetDestination(id string) {
+	se.lock()
+	defer se.unlock()
+
 	se.destinationId = id
 }
 
+// OverrideDestination sets the destination recorded for the server map in place of the one set by SetDestination,
+// such as the real service behind a proxy. The Pinpoint-Host header passed to the downstream is not changed.
+func (se *spanEvent) OverrideDestination(id string) {
+	se.lock()
+	defer se.unlock()
+
+	se.destOverride = id
+}
+
+func (se *spanEvent) destination() string {
+	if se.destOverride != "" {
+		return se.destOverride
+	}
+	return se.destinationId
+}
+
 func (se *spanEvent) SetEndPoint(endPoint string) {
+	se.lock()
+	defer se.unlock()
+
 	se.endPoint = endPoint
 }
 
@@ -89,7 +200,15 @@ func (se *spanEvent) SetSQL(sql string) {
 	normalizer := newSqlNormalizer(sql)
 	nsql, param := normalizer.run()
 	id := se.parentSpan.agent.CacheSql(nsql)
-	se.annotations.AppendIntStringString(20, id, param, "" /* bind value for prepared stmt */)
+	se.annotations.AppendIntStringString(AnnotationSqlId, id, param, "" /* bind value for prepared stmt */)
+}
+
+func (se *spanEvent) SetSQLRowsAffected(n int64) {
+	se.annotations.appendLong(AnnotationSqlRowsAffected, n)
+}
+
+func (se *spanEvent) RecordAttribute(key string, value interface{}) {
+	se.annotations.appendAttribute(key, value)
 }
 
 func (span *spanEvent) Annotations() Annotation {
@@ -97,6 +216,9 @@ func (span *spanEvent) Annotations() Annotation {
 }
 
 func (se *spanEvent) FixDuration(start time.Time, end time.Time) {
+	se.lock()
+	defer se.unlock()
+
 	se.startTime = start
 	se.startElapsed = start.Sub(se.parentSpan.startTime)
 	se.duration = end.Sub(start)
@@ -1,7 +1,10 @@
 package pinpoint
 
 import (
+	"context"
 	"errors"
+	"net/http"
+	"strings"
 	"testing"
 	"time"
 
@@ -95,6 +98,61 @@ func Test_spanEvent_SetError(t *testing.T) {
 			se.SetError(errors.New("TEST_ERROR"))
 			assert.Equal(t, se.errorFuncId, int32(1), "errorFuncId")
 			assert.Equal(t, se.errorString, "TEST_ERROR", "errorString")
+			assert.Equal(t, 0, tt.args.span.err, "span err")
+		})
+	}
+}
+
+func Test_spanEvent_SetErrorWithSpan(t *testing.T) {
+	tests := []struct {
+		name     string
+		markSpan bool
+		want     int
+	}{
+		{"1", false, 0},
+		{"2", true, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := defaultSpan()
+			s.agent = newMockAgent()
+			se := newSpanEvent(s, "retry")
+			se.SetErrorWithSpan(errors.New("timeout"), tt.markSpan)
+			assert.Equal(t, "timeout", se.errorString, "errorString")
+			assert.Equal(t, tt.want, s.err, "span err")
+		})
+	}
+}
+
+func Test_spanEvent_SetError_Stack(t *testing.T) {
+	tests := []struct {
+		name  string
+		depth int
+		want  int
+	}{
+		{"disabled", 0, 0},
+		{"1", 1, 1},
+		{"2", 2, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			agent := newMockAgent()
+			agent.(*mockAgent).config.Span.ErrorStackDepth = tt.depth
+			s := defaultSpan()
+			s.agent = agent
+			se := newSpanEvent(s, "t1")
+			se.SetErrorWithSpan(errors.New("TEST_ERROR"), false)
+
+			l := se.annotations.List()
+			if tt.want == 0 {
+				assert.Equal(t, 0, len(l), "annotations")
+				return
+			}
+
+			assert.Equal(t, int32(AnnotationErrorStack), l[0].Key, "key")
+			stack := strings.Split(l[0].Value.GetStringValue(), "\n")
+			assert.Equal(t, tt.want*2, len(stack), "frames")
+			assert.Contains(t, stack[0], "Test_spanEvent_SetError_Stack", "caller")
 		})
 	}
 }
@@ -119,3 +177,82 @@ func Test_spanEvent_SetSQL(t *testing.T) {
 		})
 	}
 }
+
+func Test_spanEvent_SetTransportError(t *testing.T) {
+	type args struct {
+		span          *span
+		operationName string
+	}
+	tests := []struct {
+		name string
+		args args
+	}{
+		{"1", args{defaultSpan(), "t1"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.args.span.agent = newMockAgent()
+			se := newSpanEvent(tt.args.span, tt.args.operationName)
+			se.SetDestination("localhost:8080")
+			se.generateNextSpanId()
+			se.SetTransportError(errors.New("connection refused"))
+			assert.Equal(t, se.errorString, "connection refused", "errorString")
+			assert.Equal(t, se.nextSpanId, int64(-1), "nextSpanId")
+		})
+	}
+}
+
+func Test_spanEvent_ClockStepBackward(t *testing.T) {
+	s := defaultSpan()
+	s.agent = newMockAgent()
+	assert.Contains(t, s.startTime.String(), "m=", "monotonic start time")
+
+	se := newSpanEvent(s, "t1")
+	assert.Contains(t, se.startTime.String(), "m=", "monotonic start time")
+
+	//wall clock readings without monotonic clock, stepped back by one second
+	start := s.startTime.Round(0).Add(-500 * time.Millisecond)
+	end := start.Add(-1 * time.Second)
+	se.FixDuration(start, end)
+
+	pse := makePSpanEventList([]*spanEvent{se}, AnnotationApi, 0)[0]
+	assert.Equal(t, int32(0), pse.StartElapsed, "StartElapsed")
+	assert.Equal(t, int32(0), pse.EndElapsed, "EndElapsed")
+}
+
+func TestRecordConnectionWait(t *testing.T) {
+	s := defaultSpan()
+	s.agent = newMockAgent()
+	ctx := NewContext(context.Background(), s)
+
+	start := s.startTime.Add(10 * time.Millisecond)
+	RecordConnectionWait(ctx, start, start.Add(50*time.Millisecond), nil)
+
+	assert.Equal(t, 1, len(s.spanEvents), "spanEvents")
+	se := s.spanEvents[0]
+	assert.Equal(t, int32(ServiceTypeGoFunction), se.serviceType, "serviceType")
+	assert.Equal(t, 10*time.Millisecond, se.startElapsed, "startElapsed")
+	assert.Equal(t, 50*time.Millisecond, se.duration, "duration")
+	assert.Equal(t, int32(1), s.eventDepth, "eventDepth")
+}
+
+func Test_spanEvent_OverrideDestination(t *testing.T) {
+	s := defaultSpan()
+	s.agent = newMockAgent()
+	s.SetParentApplication("order-service", ServiceTypeGoApp)
+
+	se := newSpanEvent(s, "t1")
+	se.SetDestination("proxy:8080")
+	se.OverrideDestination("payment-service")
+	s.spanEvents = append(s.spanEvents, se)
+
+	header := http.Header{}
+	s.stack.PushFront(se)
+	s.Inject(HttpHeaderWriter(header))
+	assert.Equal(t, "proxy:8080", header.Get(HttpHost), "Pinpoint-Host")
+
+	pspan := makePSpan(s).GetSpan()
+	assert.Equal(t, "order-service", pspan.GetAcceptEvent().GetParentInfo().GetParentApplicationName(), "parent name")
+	assert.Equal(t, int32(ServiceTypeGoApp), pspan.GetAcceptEvent().GetParentInfo().GetParentApplicationType(), "parent type")
+	assert.Equal(t, "payment-service", pspan.GetSpanEvent()[0].GetNextEvent().GetMessageEvent().GetDestinationId(), "destination")
+}
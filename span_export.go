@@ -0,0 +1,44 @@
+package pinpoint
+
+import (
+	"io"
+	"os"
+
+	"github.com/golang/protobuf/jsonpb"
+)
+
+var spanJsonMarshaler = jsonpb.Marshaler{Indent: "  "}
+
+// startSpanDebugExport writes spans as JSON to the configured writer instead of sending them to the collector.
+func (agent *agent) startSpanDebugExport() {
+	agent.setEnable(true)
+	agent.wg.Add(1)
+	go agent.exportSpanWorker()
+}
+
+func (agent *agent) exportSpanWorker() {
+	log("agent").Info("span export goroutine start")
+	defer agent.wg.Done()
+
+	w := agent.Config().Span.DebugExportWriter
+	if w == nil {
+		w = os.Stdout
+	}
+
+	for span := range agent.spanChan {
+		if err := writeSpanJson(w, span); err != nil {
+			log("agent").Errorf("fail to writeSpanJson(): %v", err)
+		}
+	}
+
+	log("agent").Info("span export goroutine finish")
+}
+
+func writeSpanJson(w io.Writer, span *span) error {
+	if err := spanJsonMarshaler.Marshal(w, makePSpanMessage(span)); err != nil {
+		return err
+	}
+
+	_, err := io.WriteString(w, "\n")
+	return err
+}
@@ -0,0 +1,27 @@
+package pinpoint
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_agent_SpanDebugExport(t *testing.T) {
+	var buf bytes.Buffer
+	c, _ := NewConfig(
+		WithAppName("test"),
+		WithAgentId("testagent"),
+		WithSpanDebugExport(true),
+		WithSpanDebugExportWriter(&buf),
+	)
+	a, _ := NewAgent(c)
+
+	span := a.NewSpanTracer("test")
+	span.EndSpan()
+	a.Shutdown()
+
+	out := buf.String()
+	assert.Contains(t, out, "\"transactionId\"", "transactionId")
+	assert.Contains(t, out, "\"testagent\"", "agentId")
+}
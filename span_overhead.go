@@ -0,0 +1,56 @@
+package pinpoint
+
+import (
+	"sync"
+	"time"
+)
+
+// SpanOverhead is the time the agent spent sending spans since the previous stat sample.
+// BuildAvg is the time to build the protobuf message of a span from the recorded data,
+// and SendAvg the time to serialize and write it to the span stream.
+type SpanOverhead struct {
+	Count    int64
+	BuildAvg int64 //us
+	SendAvg  int64 //us
+	BuildMax int64 //us
+	SendMax  int64 //us
+}
+
+var spanOverheadMux sync.Mutex
+var spanOverhead SpanOverhead
+var accSpanBuildTime int64
+var accSpanSendTime int64
+
+func collectSpanOverhead(build time.Duration, send time.Duration) {
+	b, s := toMicroseconds(build), toMicroseconds(send)
+
+	spanOverheadMux.Lock()
+	defer spanOverheadMux.Unlock()
+
+	spanOverhead.Count++
+	accSpanBuildTime += b
+	accSpanSendTime += s
+	if spanOverhead.BuildMax < b {
+		spanOverhead.BuildMax = b
+	}
+	if spanOverhead.SendMax < s {
+		spanOverhead.SendMax = s
+	}
+}
+
+// takeSpanOverhead returns the overhead collected since the previous call.
+func takeSpanOverhead() SpanOverhead {
+	spanOverheadMux.Lock()
+	defer spanOverheadMux.Unlock()
+
+	taken := spanOverhead
+	if taken.Count > 0 {
+		taken.BuildAvg = accSpanBuildTime / taken.Count
+		taken.SendAvg = accSpanSendTime / taken.Count
+	}
+
+	spanOverhead = SpanOverhead{}
+	accSpanBuildTime = 0
+	accSpanSendTime = 0
+	return taken
+}
@@ -1,8 +1,13 @@
 package pinpoint
 
 import (
+	"context"
+	"errors"
+	pb "github.com/pinpoint-apm/pinpoint-go-agent/protobuf"
 	"github.com/stretchr/testify/assert"
+	"strings"
 	"testing"
+	"time"
 )
 
 func Test_defaultSpan(t *testing.T) {
@@ -111,6 +116,22 @@ func Test_span_NewSpanEvent(t *testing.T) {
 	}
 }
 
+func Test_span_NewSpanEventWithApiId(t *testing.T) {
+	span := defaultSpan()
+	span.NewSpanEventWithApiId(7)
+	assert.Equal(t, span.eventSequence, int32(1), "eventSequence")
+	assert.Equal(t, span.eventDepth, int32(2), "eventDepth")
+
+	se := span.spanEvents[0]
+	assert.Equal(t, int32(7), se.apiId, "apiId")
+	assert.Equal(t, "", se.operationName, "operationName")
+
+	var pevent pb.PSpanEvent
+	fillPSpanEvent(&pevent, se, AnnotationApi, 0)
+	assert.Equal(t, int32(7), pevent.ApiId, "ApiId")
+	assert.Equal(t, 0, len(pevent.Annotation), "Annotation")
+}
+
 func Test_span_EndSpanEvent(t *testing.T) {
 	type args struct {
 		operationName string
@@ -135,6 +156,34 @@ func Test_span_EndSpanEvent(t *testing.T) {
 	}
 }
 
+func Test_span_EndSpanWithStatus(t *testing.T) {
+	tests := []struct {
+		name    string
+		err     error
+		wantErr int
+	}{
+		{"1", nil, 0},
+		{"2", errors.New("fail"), 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			span := defaultSpan()
+			span.agent = newMockAgent()
+			span.NewSpanEvent("t1")
+			span.EndSpanEventWithStatus(tt.err)
+			assert.Equal(t, 0, span.stack.Len(), "stack.len")
+			if tt.err != nil {
+				assert.Equal(t, tt.err.Error(), span.spanEvents[0].errorString, "errorString")
+			} else {
+				assert.Equal(t, "", span.spanEvents[0].errorString, "errorString")
+			}
+
+			span.EndSpanWithStatus(tt.err)
+			assert.Equal(t, tt.wantErr, span.err, "err")
+		})
+	}
+}
+
 func Test_span_NewAsyncSpan(t *testing.T) {
 	type args struct {
 		operationName string
@@ -145,8 +194,10 @@ func Test_span_NewAsyncSpan(t *testing.T) {
 	}{
 		{"1", args{"t1"}},
 	}
+	defer func(id int32) { asyncIdGen = id }(asyncIdGen)
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
+			asyncIdGen = 0
 			s := defaultSpan()
 			s.agent = newMockAgent()
 			s.NewSpanEvent(tt.args.operationName)
@@ -166,3 +217,304 @@ func Test_span_NewAsyncSpan(t *testing.T) {
 		})
 	}
 }
+
+func Test_span_WrapGo(t *testing.T) {
+	tests := []struct {
+		name string
+	}{
+		{"1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := defaultSpan()
+			s.agent = newMockAgent()
+			s.NewSpanEvent("t1")
+
+			done := make(chan Tracer)
+			s.WrapGo(context.Background(), func(ctx context.Context) {
+				done <- FromContext(ctx)
+			})
+
+			as := (<-done).(*span)
+			assert.Equal(t, as.txId, s.txId, "txId")
+			assert.Equal(t, as.spanId, s.spanId, "spanId")
+			assert.Equal(t, as.asyncId, s.stack.Front().Value.(*spanEvent).asyncId, "asyncId")
+		})
+	}
+}
+
+func Test_span_WrapGo_Panic(t *testing.T) {
+	s := defaultSpan()
+	s.agent = newMockAgent()
+	s.NewSpanEvent("t1")
+	as := s.NewAsyncSpan().(*span)
+
+	var recovered interface{}
+	func() {
+		defer func() {
+			recovered = recover()
+		}()
+		s.runAsync(context.Background(), as, func(ctx context.Context) {
+			panic("async panic")
+		})
+	}()
+
+	assert.Equal(t, "async panic", recovered, "re-panicked")
+	assert.Equal(t, 1, as.err, "err")
+	assert.Equal(t, "panic: async panic", as.errorString, "error")
+	assert.Greater(t, int64(as.duration), int64(0), "ended")
+}
+
+func Test_span_NewAsyncSpanWithId(t *testing.T) {
+	s := defaultSpan()
+	s.agent = newMockAgent()
+	s.NewSpanEvent("t1")
+
+	asyncId := s.AsyncId()
+	assert.NotEqual(t, asyncId, int32(0), "asyncId")
+	assert.Equal(t, asyncId, s.AsyncId(), "asyncId")
+
+	s.NewSpanEvent("t2")
+	a1 := s.NewAsyncSpanWithId(asyncId).(*span)
+	a2 := s.NewAsyncSpanWithId(asyncId).(*span)
+	assert.Equal(t, a1.asyncId, asyncId, "asyncId")
+	assert.Equal(t, a1.asyncSequence, int32(1), "asyncSequence")
+	assert.Equal(t, a2.asyncSequence, int32(2), "asyncSequence")
+
+	_, ok := s.NewAsyncSpanWithId(asyncId + 1000).(*noopSpan)
+	assert.True(t, ok, "unknown asyncId")
+}
+
+func Test_span_NewAsyncSpanWithId_WhileRecording(t *testing.T) {
+	s := defaultSpan()
+	s.agent = newMockAgent()
+	s.NewSpanEvent("t1")
+	asyncId := s.AsyncId()
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 100; i++ {
+			a := s.NewAsyncSpanWithId(asyncId).(*span)
+			assert.Equal(t, asyncId, a.asyncId, "asyncId")
+			a.EndSpan()
+		}
+	}()
+
+	for i := 0; i < 100; i++ {
+		s.NewSpanEvent("t2")
+		s.AsyncId()
+		s.EndSpanEvent()
+	}
+	<-done
+}
+
+func TestFinalizeSpan(t *testing.T) {
+	s := defaultSpan()
+	s.agent = newMockAgent()
+	s.spanId = 1234
+	addActiveSpan(s.spanId, s.startTime)
+
+	var recovered interface{}
+	func() {
+		defer func() {
+			recovered = recover()
+		}()
+		defer FinalizeSpan(s)
+		defer s.NewSpanEvent("handler").EndSpanEvent()
+
+		panic("handler panic")
+	}()
+
+	assert.Equal(t, "handler panic", recovered, "re-panicked")
+	assert.Equal(t, 1, s.err, "err")
+	assert.Greater(t, int64(s.duration), int64(0), "ended")
+
+	var stack string
+	for _, a := range s.annotations.List() {
+		if a.Key == AnnotationErrorStack {
+			stack = a.Value.GetStringValue()
+		}
+	}
+	assert.True(t, strings.HasPrefix(stack, "github.com/pinpoint-apm/pinpoint-go-agent.TestFinalizeSpan.func1\n"), "panic stack")
+
+	_, active := activeSpan.Load(s.spanId)
+	assert.False(t, active, "active span")
+}
+
+func TestFinalizeSpanWithContext(t *testing.T) {
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+	expired, cancel2 := context.WithTimeout(context.Background(), -time.Second)
+	defer cancel2()
+
+	tests := []struct {
+		name  string
+		ctx   context.Context
+		err   int
+		class string
+	}{
+		{"ok", context.Background(), 0, ""},
+		{"timeout", expired, 1, ContextErrorTimeout},
+		{"canceled", canceled, 1, ContextErrorCanceled},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := defaultSpan()
+			s.agent = newMockAgent()
+			FinalizeSpanWithContext(tt.ctx, s)
+
+			assert.Equal(t, tt.err, s.err, "err")
+			if tt.class == "" {
+				assert.Equal(t, 0, len(s.annotations.list), "annotations")
+			} else {
+				a := s.annotations.list[len(s.annotations.list)-1]
+				assert.Equal(t, int32(AnnotationContextError), a.Key, "key")
+				assert.Equal(t, tt.class, a.GetValue().GetStringValue(), "class")
+			}
+		})
+	}
+}
+
+func Test_span_MaxDuration(t *testing.T) {
+	opts := []ConfigOption{
+		WithAppName("test"),
+		WithAgentId("testagent"),
+		WithSpanMaxDuration(50),
+	}
+	c, _ := NewConfig(opts...)
+	c.OffGrpc = true
+	a, _ := NewAgent(c)
+	agent := a.(*agent)
+	agent.enable = true
+
+	tracer := agent.NewSpanTracer("stream")
+	tracer.NewSpanEvent("recv")
+	s := tracer.(*span)
+
+	var finished *span
+	select {
+	case finished = <-agent.spanChan:
+	case <-time.After(3 * time.Second):
+		t.Fatal("span is not finished on max duration")
+	}
+
+	assert.NotEqual(t, s, finished, "copy")
+	assert.GreaterOrEqual(t, int64(finished.duration), int64(50*time.Millisecond), "duration")
+	assert.Greater(t, int64(finished.spanEvents[0].duration), int64(0), "event duration")
+	l := finished.annotations.List()
+	assert.Equal(t, int32(AnnotationMaxDurationExceeded), l[len(l)-1].GetKey(), "annotation")
+
+	_, active := activeSpan.Load(s.spanId)
+	assert.False(t, active, "active span")
+
+	tracer.EndSpanEvent()
+	tracer.EndSpan()
+	assert.Equal(t, 0, len(agent.spanChan), "sent twice")
+}
+
+func Test_span_MaxDurationWhileRecording(t *testing.T) {
+	c, _ := NewConfig(WithAppName("test"), WithAgentId("testagent"), WithSpanMaxDuration(20))
+	c.OffGrpc = true
+	a, _ := NewAgent(c)
+	agent := a.(*agent)
+	agent.enable = true
+
+	tracer := agent.NewSpanTracer("stream")
+	done := make(chan struct{})
+	recorded := make(chan struct{})
+	go func() {
+		defer close(recorded)
+		for {
+			select {
+			case <-done:
+				return
+			default:
+			}
+			tracer.NewSpanEvent("recv")
+			tracer.SpanEvent().SetDestination("db")
+			tracer.SpanEvent().Annotations().AppendString(AnnotationAttribute, "a")
+			tracer.Span().SetEndPoint("host")
+			tracer.EndSpanEvent()
+		}
+	}()
+
+	var finished *span
+	select {
+	case finished = <-agent.spanChan:
+	case <-time.After(3 * time.Second):
+		t.Fatal("span is not finished on max duration")
+	}
+	close(done)
+	<-recorded
+
+	assert.Equal(t, "stream", finished.operationName, "operation")
+	l := finished.annotations.List()
+	assert.Equal(t, int32(AnnotationMaxDurationExceeded), l[len(l)-1].GetKey(), "annotation")
+	tracer.EndSpan()
+}
+
+func Test_span_sampleAnnotations(t *testing.T) {
+	tests := []struct {
+		name     string
+		duration time.Duration
+		err      error
+		kept     int
+	}{
+		{"normal", 10 * time.Millisecond, nil, 1},
+		{"slow", 2 * time.Second, nil, 3},
+		{"failed", 10 * time.Millisecond, errors.New("fail"), 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, _ := NewConfig(WithAppName("test"), WithAgentId("testagent"), WithAnnotationSampleRate(1000), WithSamplingKeepSlowThreshold(1000))
+			c.OffGrpc = true
+			a, _ := NewAgent(c)
+
+			s := newTestSpan(a)
+			s.NewSpanEvent("query")
+			se := s.spanEvents[0]
+			se.annotations.AppendIntStringString(AnnotationSqlId, 1, "", "")
+			se.annotations.AppendString(AnnotationAttribute, "a")
+			se.annotations.AppendString(AnnotationAttribute, "b")
+			se.SetErrorWithSpan(tt.err, true)
+			s.duration = tt.duration
+
+			s.sampleAnnotations()
+			assert.Equal(t, tt.kept, len(s.spanEvents[0].annotations.list), "kept")
+			assert.Equal(t, 3, len(se.annotations.list), "original")
+			if tt.kept < 3 {
+				l := s.annotations.List()
+				assert.Equal(t, int32(AnnotationSampledOut), l[len(l)-1].GetKey(), "sampled out")
+			}
+		})
+	}
+}
+
+func Test_span_sampleAnnotations_NoSlowThreshold(t *testing.T) {
+	c, _ := NewConfig(WithAppName("test"), WithAgentId("testagent"), WithAnnotationSampleRate(1000))
+	c.OffGrpc = true
+	a, _ := NewAgent(c)
+
+	s := newTestSpan(a)
+	s.NewSpanEvent("call")
+	s.spanEvents[0].annotations.AppendString(AnnotationAttribute, "a")
+	s.duration = time.Hour
+
+	s.sampleAnnotations()
+	assert.Equal(t, 0, len(s.spanEvents[0].annotations.list), "no span is slow without the threshold")
+}
+
+func Test_span_AddLink(t *testing.T) {
+	s := defaultSpan()
+	for _, tid := range []string{"agent-a^1000^1", "agent-b^2000^7"} {
+		txId, ok := ParseTransactionId(tid)
+		assert.True(t, ok, "parse")
+		s.AddLink(txId)
+	}
+
+	assert.Equal(t, 2, len(s.annotations.list), "annotations")
+	assert.Equal(t, int32(AnnotationLinkedTransaction), s.annotations.list[0].Key, "key")
+	assert.Equal(t, "agent-a^1000^1", s.annotations.list[0].GetValue().GetStringValue(), "link")
+	assert.Equal(t, "agent-b^2000^7", s.annotations.list[1].GetValue().GetStringValue(), "link")
+}
@@ -2,7 +2,9 @@ package pinpoint
 
 import (
 	"context"
+	"database/sql"
 	"database/sql/driver"
+	"time"
 )
 
 type DatabaseTrace struct {
@@ -42,6 +44,31 @@ func NewDatabaseTracerWithQuery(ctx context.Context, funcName string, dt *Databa
 	return NewDatabaseTracer(ctx, funcName, dt)
 }
 
+// RecordConnectionWait records the time spent waiting for a pooled database connection
+// as a span event, separately from the query execution.
+// The collector has no service type for it, so the span event is a function named ConnectionWait.
+func RecordConnectionWait(ctx context.Context, start time.Time, end time.Time, err error) {
+	tracer := FromContext(ctx)
+	if tracer == nil {
+		return
+	}
+
+	tracer.NewSpanEvent("ConnectionWait")
+	se := tracer.SpanEvent()
+	se.SetServiceType(ServiceTypeGoFunction)
+	se.FixDuration(start, end)
+	se.SetError(err)
+	tracer.EndSpanEvent()
+}
+
+// AcquireConn returns a connection from the pool of db, recording the acquisition wait time.
+func AcquireConn(ctx context.Context, db *sql.DB) (*sql.Conn, error) {
+	start := time.Now()
+	conn, err := db.Conn(ctx)
+	RecordConnectionWait(ctx, start, time.Now(), err)
+	return conn, err
+}
+
 func makeDriver(drv *PinpointSqlDriver) driver.Driver {
 	if _, ok := drv.originDriver.(driver.DriverContext); ok {
 		return struct {
@@ -148,6 +175,7 @@ func (c *PinpointSqlConn) ExecContext(ctx context.Context, query string, args []
 	tracer := NewDatabaseTracerWithQuery(ctx, "ExecContext", &c.trace, query)
 	result, err := c.originConn.(driver.ExecerContext).ExecContext(ctx, query, args)
 	if tracer != nil {
+		recordRowsAffected(tracer, result, err)
 		tracer.EndSpanEvent()
 	}
 	return result, err
@@ -197,6 +225,17 @@ func (c *PinpointSqlConn) ResetSession(ctx context.Context) error {
 	return nil
 }
 
+// recordRowsAffected records nothing if the driver doesn't report the number of rows.
+func recordRowsAffected(tracer Tracer, result driver.Result, err error) {
+	if err != nil || result == nil {
+		return
+	}
+
+	if n, err := result.RowsAffected(); err == nil {
+		tracer.SpanEvent().SetSQLRowsAffected(n)
+	}
+}
+
 type PinpointSqlStmt struct {
 	trace      *DatabaseTrace
 	originStmt driver.Stmt
@@ -206,6 +245,7 @@ func (s *PinpointSqlStmt) ExecContext(ctx context.Context, args []driver.NamedVa
 	tracer := NewDatabaseTracer(ctx, "StmtExecContext", s.trace)
 	result, err := s.originStmt.(driver.StmtExecContext).ExecContext(ctx, args)
 	if tracer != nil {
+		recordRowsAffected(tracer, result, err)
 		tracer.EndSpanEvent()
 	}
 	return result, err
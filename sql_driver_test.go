@@ -0,0 +1,38 @@
+package pinpoint
+
+import (
+	"database/sql/driver"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_recordRowsAffected(t *testing.T) {
+	tests := []struct {
+		name   string
+		result driver.Result
+		err    error
+		want   []int64
+	}{
+		{"1", driver.RowsAffected(3), nil, []int64{3}},
+		{"2", driver.ResultNoRows, nil, []int64{}},
+		{"3", nil, errors.New("deadlock"), []int64{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := defaultSpan()
+			s.agent = newMockAgent()
+			s.NewSpanEvent("ExecContext")
+			recordRowsAffected(s, tt.result, tt.err)
+
+			got := []int64{}
+			for _, a := range s.SpanEvent().Annotations().List() {
+				if a.GetKey() == AnnotationSqlRowsAffected {
+					got = append(got, a.GetValue().GetLongValue())
+				}
+			}
+			assert.Equal(t, tt.want, got, "rows affected")
+		})
+	}
+}
@@ -3,6 +3,7 @@ package pinpoint
 import (
 	"runtime"
 	"sync"
+	"sync/atomic"
 	"syscall"
 	"time"
 )
@@ -18,6 +19,11 @@ type inspectorStats struct {
 	nonHeapMax   int64
 	gcNum        int64
 	gcTime       int64
+	gcPauseMax   int64
+	gcForced     int64
+	offHeap      int64
+	heapRetained int64
+	cgoCalls     int64
 	responseAvg  int64
 	responseMax  int64
 	sampleNew    int64
@@ -26,35 +32,57 @@ type inspectorStats struct {
 	unSampleCont int64
 	skipNew      int64
 	skipCont     int64
+	droppedSpan  int64
 	activeSpan   []int32
+	fdCount      int64 //-1 if unknown
+	fdLimit      int64
+
+	goroutineLeak   bool
+	collectInterval int64 //ms
+	spanQueueDepth  int
+	streamStats     StreamStats
+	uriStats        []UriStat
+	spanOverhead    SpanOverhead
+	customStats     map[string]float64
 }
 
 var lastRusage syscall.Rusage
 var lastMemStats runtime.MemStats
 var lastCollectTime time.Time
+var lastCgoCalls int64
 var statsMux sync.Mutex
 
 var accResponseTime int64
 var maxResponseTime int64
 var requestCount int64
 
+// the sampling counters are accessed atomically not to lock on every request
 var sampleNew int64
 var unsampleNew int64
 var sampleCont int64
 var unsampleCont int64
 var skipNew int64
 var skipCont int64
+var droppedSpan int64          //total since the agent started, accessed atomically
+var collectedDroppedSpan int64 //droppedSpan at the last collection, accessed atomically
+var lastDropLog int64          //unix nano, accessed atomically
 
 var activeSpan sync.Map
 
 func initStats() {
+	statsMux.Lock()
+	defer statsMux.Unlock()
+
 	err := syscall.Getrusage(syscall.RUSAGE_SELF, &lastRusage)
 	if err != nil {
 		log("stats").Error(err)
 	}
 
 	runtime.ReadMemStats(&lastMemStats)
+	lastCgoCalls = runtime.NumCgoCall()
 	lastCollectTime = time.Now()
+	resetResponseTime()
+	takeSamplingCounts()
 
 	activeSpan = sync.Map{}
 }
@@ -73,7 +101,12 @@ func getStats() *inspectorStats {
 
 	var mem runtime.MemStats
 	runtime.ReadMemStats(&mem)
-	dur := now.Sub(lastCollectTime)
+
+	//rates are zero until the stats are initialized
+	var dur time.Duration
+	if !lastCollectTime.IsZero() {
+		dur = now.Sub(lastCollectTime)
+	}
 
 	activeSpanCount := []int32{0, 0, 0, 0}
 	activeSpan.Range(func(k, v interface{}) bool {
@@ -93,6 +126,14 @@ func getStats() *inspectorStats {
 		return true
 	})
 
+	cgoCalls := runtime.NumCgoCall()
+	sn, sc, un, uc, kn, kc := takeSamplingCounts()
+
+	fdCount, ok := openFileDescriptors()
+	if !ok {
+		fdCount = -1
+	}
+
 	stats := inspectorStats{
 		sampleTime:   now,
 		cpuUserTime:  cpuUtilization(rsg.Utime, lastRusage.Utime, dur),
@@ -104,33 +145,119 @@ func getStats() *inspectorStats {
 		nonHeapMax:   int64(mem.StackSys),
 		gcNum:        int64(mem.NumGC - lastMemStats.NumGC),
 		gcTime:       int64(mem.PauseTotalNs-lastMemStats.PauseTotalNs) / int64(time.Millisecond),
+		gcPauseMax:   maxGcPause(&mem, lastMemStats.NumGC),
+		gcForced:     int64(mem.NumForcedGC - lastMemStats.NumForcedGC),
+		offHeap:      int64(mem.Sys - mem.HeapSys - mem.StackSys),
+		heapRetained: int64(mem.HeapIdle - mem.HeapReleased),
+		cgoCalls:     cgoCalls - lastCgoCalls,
 		responseAvg:  calcResponseAvg(),
 		responseMax:  maxResponseTime,
-		sampleNew:    sampleNew / int64(dur.Seconds()),
-		sampleCont:   sampleCont / int64(dur.Seconds()),
-		unSampleNew:  unsampleNew / int64(dur.Seconds()),
-		unSampleCont: unsampleCont / int64(dur.Seconds()),
-		skipNew:      skipNew / int64(dur.Seconds()),
-		skipCont:     skipCont / int64(dur.Seconds()),
+		sampleNew:    perSecond(sn, dur),
+		sampleCont:   perSecond(sc, dur),
+		unSampleNew:  perSecond(un, dur),
+		unSampleCont: perSecond(uc, dur),
+		skipNew:      perSecond(kn, dur),
+		skipCont:     perSecond(kc, dur),
+		droppedSpan:  droppedSpanDelta(),
 		activeSpan:   activeSpanCount,
+		fdCount:      fdCount,
+		fdLimit:      fileDescriptorLimit(),
+		uriStats:     takeUriStats(),
+		spanOverhead: takeSpanOverhead(),
 	}
 
 	lastRusage = rsg
 	lastMemStats = mem
+	lastCgoCalls = cgoCalls
 	lastCollectTime = now
 	resetResponseTime()
 
 	return &stats
 }
 
+// maxGcPause returns the longest pause in microseconds of the GC cycles since the previous cycle count.
+// The runtime keeps the pauses of the last 256 cycles only.
+func maxGcPause(mem *runtime.MemStats, lastNumGC uint32) int64 {
+	n := mem.NumGC - lastNumGC
+	if n > uint32(len(mem.PauseNs)) {
+		n = uint32(len(mem.PauseNs))
+	}
+
+	var max uint64
+	for i := uint32(0); i < n; i++ {
+		pause := mem.PauseNs[(mem.NumGC-i+255)%256]
+		if pause > max {
+			max = pause
+		}
+	}
+	return int64(max) / int64(time.Microsecond)
+}
+
+type goroutineMonitor struct {
+	threshold int
+	window    int
+	samples   []int
+	warnOnce  sync.Once
+}
+
+func newGoroutineMonitor(threshold int, window int) *goroutineMonitor {
+	return &goroutineMonitor{
+		threshold: threshold,
+		window:    window,
+		samples:   make([]int, 0, window),
+	}
+}
+
+func (m *goroutineMonitor) check(num int) bool {
+	if m.threshold <= 0 || m.window < 2 {
+		return false
+	}
+
+	if len(m.samples) == m.window {
+		m.samples = m.samples[1:]
+	}
+	m.samples = append(m.samples, num)
+
+	if len(m.samples) < m.window {
+		return false
+	}
+
+	for i := 1; i < len(m.samples); i++ {
+		if m.samples[i] <= m.samples[i-1] {
+			return false
+		}
+	}
+
+	first, last := m.samples[0], m.samples[len(m.samples)-1]
+	if last-first < m.threshold {
+		return false
+	}
+
+	//the leak is flagged in the stats of every sample, but warned only once not to flood the log
+	m.warnOnce.Do(func() {
+		log("stats").Warnf("goroutine count keeps increasing: %d -> %d over %d samples, possible goroutine leak", first, last, m.window)
+	})
+	return true
+}
+
 func cpuTime(timeval syscall.Timeval) time.Time {
 	return time.Unix(timeval.Sec, int64(timeval.Usec)*1000)
 }
 
 func cpuUtilization(cur syscall.Timeval, prev syscall.Timeval, dur time.Duration) float64 {
+	if dur <= 0 {
+		return 0
+	}
 	return float64(toMicroseconds(cpuTime(cur).Sub(cpuTime(prev)))) / float64(toMicroseconds(dur)) * 100 / float64(runtime.NumCPU())
 }
 
+func perSecond(count int64, dur time.Duration) int64 {
+	if dur <= 0 {
+		return 0
+	}
+	return int64(float64(count) / dur.Seconds())
+}
+
 func calcResponseAvg() int64 {
 	if requestCount > 0 {
 		return accResponseTime / requestCount
@@ -141,41 +268,55 @@ func calcResponseAvg() int64 {
 
 func (agent *agent) sendStatsWorker() {
 	log("stats").Info("stat goroutine start")
-	defer agent.wg.Done()
 
 	initStats()
-	resetResponseTime()
 
-	sleepTime := time.Duration(agent.config.Stat.CollectInterval) * time.Millisecond
-	time.Sleep(sleepTime)
+	sleepTime := time.Duration(agent.Config().Stat.CollectInterval) * time.Millisecond
+	if !agent.sleep(sleepTime) {
+		log("stats").Info("stat goroutine finish")
+		return
+	}
 
-	agent.statStream = agent.statGrpc.newStatStreamWithRetry()
-	collected := make([]*inspectorStats, agent.config.Stat.BatchCount)
-	batch := 0
+	agent.statStream = agent.grpc().stat.newStatStreamWithRetry()
+	config := agent.Config().Stat
+	sizer := newBatchSizer(config.BatchCount, config.MaxBatchCount, time.Duration(config.SlowSendThreshold)*time.Millisecond, config.AdaptiveBatch)
+	collected := make([]*inspectorStats, 0, sizer.max)
+	monitor := newGoroutineMonitor(agent.Config().Stat.GoroutineLeakThreshold, agent.Config().Stat.GoroutineLeakWindow)
 
 	for true {
-		if !agent.enable {
+		if !agent.Enable() {
 			break
 		}
 
-		collected[batch] = getStats()
-		batch++
-
-		if batch == agent.config.Stat.BatchCount {
+		stats := getStats()
+		stats.streamStats = agent.streams().stats()
+		stats.goroutineLeak = monitor.check(stats.goroutineNum)
+		stats.customStats = agent.custom.snapshot()
+		stats.collectInterval = int64(agent.Config().Stat.CollectInterval)
+		stats.spanQueueDepth = len(agent.spanChan)
+		notifyStatsSinks(agent.Config().Stat.Sinks, stats)
+		collected = append(collected, stats)
+
+		if len(collected) >= sizer.current() {
+			start := time.Now()
 			agent.statStreamReq = true
 			err := agent.statStream.sendStats(collected)
 			agent.statStreamReq = false
 			agent.statStreamReqCount++
+			sizer.adjust(time.Since(start))
 
 			if err != nil {
 				log("stats").Errorf("fail to sendStats(): %v", err)
+				agent.streams().recordError(streamStat, err)
 				agent.statStream.close()
-				agent.statStream = agent.statGrpc.newStatStreamWithRetry()
+				agent.statStream = agent.grpc().stat.newStatStreamWithRetry()
 			}
-			batch = 0
+			collected = collected[:0]
 		}
 
-		time.Sleep(sleepTime)
+		if !agent.sleep(sleepTime) {
+			break
+		}
 	}
 
 	agent.statStream.close()
@@ -198,12 +339,72 @@ func resetResponseTime() {
 	accResponseTime = 0
 	requestCount = 0
 	maxResponseTime = 0
-	sampleNew = 0
-	unsampleNew = 0
-	sampleCont = 0
-	unsampleCont = 0
-	skipNew = 0
-	skipCont = 0
+}
+
+type StreamStat struct {
+	Reconnects    int64
+	LastError     string
+	LastErrorTime time.Time
+	LastSendTime  time.Time //the last successful ping, recorded for the ping stream only
+}
+
+type StreamStats struct {
+	Ping    StreamStat
+	Span    StreamStat
+	Stat    StreamStat
+	Command StreamStat
+}
+
+const (
+	streamPing = iota
+	streamSpan
+	streamStat
+	streamCommand
+	numStreams
+)
+
+// streamRecorder keeps the reconnects and the last errors of the streams of an agent.
+type streamRecorder struct {
+	mu        sync.Mutex
+	table     [numStreams]StreamStat
+	connected [numStreams]bool
+}
+
+func (r *streamRecorder) recordConnect(kind int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.connected[kind] {
+		r.table[kind].Reconnects++
+	}
+	r.connected[kind] = true
+}
+
+func (r *streamRecorder) recordError(kind int, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.table[kind].LastError = err.Error()
+	r.table[kind].LastErrorTime = time.Now()
+}
+
+func (r *streamRecorder) recordSend(kind int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.table[kind].LastSendTime = time.Now()
+}
+
+func (r *streamRecorder) stats() StreamStats {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return StreamStats{
+		Ping:    r.table[streamPing],
+		Span:    r.table[streamSpan],
+		Stat:    r.table[streamStat],
+		Command: r.table[streamCommand],
+	}
 }
 
 func addActiveSpan(spanId int64, start time.Time) {
@@ -237,21 +438,50 @@ func getActiveSpanCount(now time.Time) []int32 {
 	return activeSpanCount
 }
 
+func getSamplingCounts() (int64, int64, int64, int64, int64, int64) {
+	return atomic.LoadInt64(&sampleNew), atomic.LoadInt64(&sampleCont), atomic.LoadInt64(&unsampleNew),
+		atomic.LoadInt64(&unsampleCont), atomic.LoadInt64(&skipNew), atomic.LoadInt64(&skipCont)
+}
+
+// takeSamplingCounts returns the sampling counts of the stat interval and starts counting the next one.
+func takeSamplingCounts() (int64, int64, int64, int64, int64, int64) {
+	return atomic.SwapInt64(&sampleNew, 0), atomic.SwapInt64(&sampleCont, 0), atomic.SwapInt64(&unsampleNew, 0),
+		atomic.SwapInt64(&unsampleCont, 0), atomic.SwapInt64(&skipNew, 0), atomic.SwapInt64(&skipCont, 0)
+}
+
+// droppedSpanDelta returns the spans dropped since the last collection.
+func droppedSpanDelta() int64 {
+	total := atomic.LoadInt64(&droppedSpan)
+	return total - atomic.SwapInt64(&collectedDroppedSpan, total)
+}
+
 func incrSampleNew() {
-	sampleNew++
+	atomic.AddInt64(&sampleNew, 1)
 }
 func incrUnsampleNew() {
-	unsampleNew++
+	atomic.AddInt64(&unsampleNew, 1)
 }
 func incrSampleCont() {
-	sampleCont++
+	atomic.AddInt64(&sampleCont, 1)
 }
 func incrUnsampleCont() {
-	unsampleCont++
+	atomic.AddInt64(&unsampleCont, 1)
 }
 func incrSkipNew() {
-	skipNew++
+	atomic.AddInt64(&skipNew, 1)
 }
 func incrSkipCont() {
-	skipCont++
+	atomic.AddInt64(&skipCont, 1)
+}
+
+// recordDroppedSpan counts the spans dropped as the span queue is full,
+// and logs it at most once per the interval not to flood the log under load.
+func recordDroppedSpan(n int64, interval time.Duration) {
+	total := atomic.AddInt64(&droppedSpan, n) - atomic.LoadInt64(&collectedDroppedSpan)
+
+	now := time.Now().UnixNano()
+	last := atomic.LoadInt64(&lastDropLog)
+	if now-last >= int64(interval) && atomic.CompareAndSwapInt64(&lastDropLog, last, now) {
+		log("agent").Warnf("span queue is full, %d spans dropped in the stat interval", total)
+	}
 }
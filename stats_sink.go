@@ -0,0 +1,119 @@
+package pinpoint
+
+import (
+	"time"
+)
+
+// Stats is a snapshot of the agent statistics collected at every stat collect interval.
+type Stats struct {
+	SampleTime time.Time
+
+	CpuUserTime float64 // percent of the available CPUs
+	CpuSysTime  float64 // percent of the available CPUs
+
+	GoroutineNum  int
+	GoroutineLeak bool
+
+	HeapAlloc    int64 // bytes
+	HeapMax      int64 // bytes obtained from the OS
+	NonHeapAlloc int64 // stack bytes in use
+	NonHeapMax   int64 // stack bytes obtained from the OS
+	GcNum        int64 // GC cycles since the previous sample
+	GcTime       int64 // GC pause time since the previous sample, ms
+	GcPauseMax   int64 // the longest GC pause since the previous sample, us
+	GcForced     int64 // GC cycles forced by the application since the previous sample
+	OffHeap      int64 // bytes obtained from the OS for the runtime itself, other than the heap and the stacks
+	HeapRetained int64 // bytes of the idle heap kept by the runtime, not returned to the OS
+	CgoCalls     int64 // cgo calls since the previous sample
+
+	ResponseAvg int64 // ms
+	ResponseMax int64 // ms
+
+	// transactions per second since the previous sample
+	SampleNew    int64
+	SampleCont   int64
+	UnSampleNew  int64
+	UnSampleCont int64
+	SkipNew      int64
+	SkipCont     int64
+
+	DroppedSpan    int64 // spans dropped since the previous sample as the span queue is full
+	SpanQueueDepth int   // spans waiting in the span queue when sampled
+
+	// number of active spans by elapsed time: < 1s, < 3s, < 5s, >= 5s
+	ActiveSpan []int32
+
+	FileDescriptors     int64 // open file descriptors, -1 if unknown on the platform
+	FileDescriptorLimit int64 // soft limit, 0 if unknown
+
+	Streams StreamStats
+
+	// collected if enabled by WithHttpUriStat
+	UriStats []UriStat
+
+	SpanOverhead SpanOverhead
+
+	// recorded by Agent.RecordCustomStat
+	CustomStats map[string]float64
+}
+
+// StatsSink receives every collected stat sample before it is sent to the collector.
+// It is called from the stat goroutine and should return quickly.
+type StatsSink func(stats Stats)
+
+func (stats *inspectorStats) snapshot() Stats {
+	activeSpan := make([]int32, len(stats.activeSpan))
+	copy(activeSpan, stats.activeSpan)
+
+	return Stats{
+		SampleTime:          stats.sampleTime,
+		CpuUserTime:         stats.cpuUserTime,
+		CpuSysTime:          stats.cpuSysTime,
+		GoroutineNum:        stats.goroutineNum,
+		GoroutineLeak:       stats.goroutineLeak,
+		HeapAlloc:           stats.heapAlloc,
+		HeapMax:             stats.heapMax,
+		NonHeapAlloc:        stats.nonHeapAlloc,
+		NonHeapMax:          stats.nonHeapMax,
+		GcNum:               stats.gcNum,
+		GcTime:              stats.gcTime,
+		GcPauseMax:          stats.gcPauseMax,
+		GcForced:            stats.gcForced,
+		OffHeap:             stats.offHeap,
+		HeapRetained:        stats.heapRetained,
+		CgoCalls:            stats.cgoCalls,
+		ResponseAvg:         stats.responseAvg,
+		ResponseMax:         stats.responseMax,
+		SampleNew:           stats.sampleNew,
+		SampleCont:          stats.sampleCont,
+		UnSampleNew:         stats.unSampleNew,
+		UnSampleCont:        stats.unSampleCont,
+		SkipNew:             stats.skipNew,
+		SkipCont:            stats.skipCont,
+		DroppedSpan:         stats.droppedSpan,
+		SpanQueueDepth:      stats.spanQueueDepth,
+		ActiveSpan:          activeSpan,
+		FileDescriptors:     stats.fdCount,
+		FileDescriptorLimit: stats.fdLimit,
+		Streams:             stats.streamStats,
+		UriStats:            stats.uriStats,
+		SpanOverhead:        stats.spanOverhead,
+		CustomStats:         stats.customStats,
+	}
+}
+
+func notifyStatsSinks(sinks []StatsSink, stats *inspectorStats) {
+	for _, sink := range sinks {
+		callStatsSink(sink, stats.snapshot())
+	}
+}
+
+func callStatsSink(sink StatsSink, stats Stats) {
+	defer func() {
+		if r := recover(); r != nil {
+			log("stats").Errorf("fail to call stats sink: %v", r)
+		}
+	}()
+
+	sink(stats)
+}
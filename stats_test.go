@@ -0,0 +1,351 @@
+package pinpoint
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"runtime"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	pb "github.com/pinpoint-apm/pinpoint-go-agent/protobuf"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_goroutineMonitor_check(t *testing.T) {
+	type args struct {
+		threshold int
+		window    int
+		samples   []int
+	}
+	tests := []struct {
+		name string
+		args args
+		want bool
+	}{
+		{"1", args{0, 3, []int{10, 20, 30}}, false},
+		{"2", args{10, 3, []int{10, 20, 30}}, true},
+		{"3", args{10, 3, []int{10, 20, 15}}, false},
+		{"4", args{100, 3, []int{10, 20, 30}}, false},
+		{"5", args{10, 3, []int{50, 10, 20, 30}}, true},
+		{"6", args{10, 4, []int{10, 20, 30}}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := newGoroutineMonitor(tt.args.threshold, tt.args.window)
+
+			var got bool
+			for _, n := range tt.args.samples {
+				got = m.check(n)
+			}
+			assert.Equal(t, tt.want, got, "check")
+		})
+	}
+}
+
+func Test_goroutineMonitor_check_WarnOnce(t *testing.T) {
+	var buf bytes.Buffer
+	out := logger.Out
+	logger.SetOutput(&buf)
+	defer logger.SetOutput(out)
+
+	m := newGoroutineMonitor(10, 3)
+	for n := 10; n < 100; n += 10 {
+		m.check(n)
+	}
+	//the buffer is read after the other goroutines stop writing the log to it
+	logger.SetOutput(out)
+
+	assert.True(t, m.check(100), "still flagged")
+	assert.Equal(t, 1, strings.Count(buf.String(), "possible goroutine leak"), "warnings")
+}
+
+func Test_perSecond(t *testing.T) {
+	type args struct {
+		count int64
+		dur   time.Duration
+	}
+	tests := []struct {
+		name string
+		args args
+		want int64
+	}{
+		{"1", args{100, 5 * time.Second}, 20},
+		{"2", args{10, 500 * time.Millisecond}, 20},
+		{"3", args{30, 1500 * time.Millisecond}, 20},
+		{"4", args{10, 0}, 0},
+		{"5", args{10, -1 * time.Second}, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, perSecond(tt.args.count, tt.args.dur), "perSecond")
+		})
+	}
+}
+
+func Test_getStats_FirstInterval(t *testing.T) {
+	origCollectTime, origSampleNew := lastCollectTime, sampleNew
+	defer func() {
+		lastCollectTime, sampleNew = origCollectTime, origSampleNew
+	}()
+
+	lastCollectTime = time.Time{}
+	sampleNew = 10
+	stats := getStats()
+	assert.Equal(t, int64(0), stats.sampleNew, "uninitialized")
+
+	initStats()
+	lastCollectTime = time.Now().Add(-500 * time.Millisecond)
+	sampleNew = 10
+	stats = getStats()
+	assert.Greater(t, stats.sampleNew, int64(10), "sampleNew")
+	assert.LessOrEqual(t, stats.sampleNew, int64(20), "sampleNew")
+}
+
+func Test_takeSamplingCounts_WhileCounting(t *testing.T) {
+	takeSamplingCounts()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 1000; j++ {
+				incrSampleNew()
+				incrSkipCont()
+			}
+		}()
+	}
+
+	var sampled, skipped int64
+	for i := 0; i < 10; i++ {
+		sn, _, _, _, _, kc := takeSamplingCounts()
+		sampled += sn
+		skipped += kc
+	}
+	wg.Wait()
+	sn, _, _, _, _, kc := takeSamplingCounts()
+
+	assert.Equal(t, int64(4000), sampled+sn, "sampleNew")
+	assert.Equal(t, int64(4000), skipped+kc, "skipCont")
+}
+
+func Test_notifyStatsSinks(t *testing.T) {
+	var got []Stats
+	sinks := []StatsSink{
+		func(stats Stats) { panic("sink") },
+		func(stats Stats) { got = append(got, stats) },
+	}
+
+	stats := &inspectorStats{goroutineNum: 10, heapAlloc: 1024, sampleNew: 3, activeSpan: []int32{1, 2, 0, 0}}
+	notifyStatsSinks(sinks, stats)
+	stats.activeSpan[0] = 5
+
+	assert.Equal(t, 1, len(got), "called")
+	assert.Equal(t, 10, got[0].GoroutineNum, "GoroutineNum")
+	assert.Equal(t, int64(1024), got[0].HeapAlloc, "HeapAlloc")
+	assert.Equal(t, int64(3), got[0].SampleNew, "SampleNew")
+	assert.Equal(t, []int32{1, 2, 0, 0}, got[0].ActiveSpan, "ActiveSpan")
+}
+
+func Test_collectUriStat(t *testing.T) {
+	takeUriStats()
+	collectUriStat("/users/:id", 50, false)
+	collectUriStat("/users/:id", 700, true)
+	collectUriStat("/login", 9000, false)
+
+	stats := takeUriStats()
+	assert.Equal(t, 2, len(stats), "len")
+	assert.Equal(t, UriStat{
+		Uri:             "/login",
+		Count:           1,
+		TotalTime:       9000,
+		MaxTime:         9000,
+		Histogram:       []int64{0, 0, 0, 0, 0, 0, 0, 1},
+		FailedHistogram: []int64{0, 0, 0, 0, 0, 0, 0, 0},
+	}, stats[0], "login")
+	assert.Equal(t, UriStat{
+		Uri:             "/users/:id",
+		Count:           2,
+		ErrorCount:      1,
+		TotalTime:       750,
+		MaxTime:         700,
+		Histogram:       []int64{1, 0, 0, 1, 0, 0, 0, 0},
+		FailedTotalTime: 700,
+		FailedMaxTime:   700,
+		FailedHistogram: []int64{0, 0, 0, 1, 0, 0, 0, 0},
+	}, stats[1], "users")
+	assert.Equal(t, 0, len(takeUriStats()), "reset")
+}
+
+func Test_collectSpanOverhead(t *testing.T) {
+	takeSpanOverhead()
+	collectSpanOverhead(100*time.Microsecond, 300*time.Microsecond)
+	collectSpanOverhead(200*time.Microsecond, 100*time.Microsecond)
+
+	assert.Equal(t, SpanOverhead{2, 150, 200, 200, 300}, takeSpanOverhead(), "overhead")
+	assert.Equal(t, SpanOverhead{}, takeSpanOverhead(), "reset")
+}
+
+func Test_customStats(t *testing.T) {
+	c := newCustomStats(2)
+	assert.Nil(t, c.snapshot(), "empty")
+
+	c.record("queue.depth", 3)
+	c.record("cache.size", 1.5)
+	c.record("queue.depth", 7)
+	c.record("over", 1)
+	c.record("", 1)
+
+	stats := c.snapshot()
+	assert.Equal(t, map[string]float64{"queue.depth": 7, "cache.size": 1.5}, stats, "stats")
+	assert.Equal(t, "cache.size=1.5,queue.depth=7", encodeCustomStats(stats), "encoded")
+	assert.Equal(t, "", encodeCustomStats(nil), "encoded empty")
+}
+
+func Test_streamRecorder_recordSend(t *testing.T) {
+	var r streamRecorder
+	before := time.Now()
+	r.recordSend(streamPing)
+
+	stats := r.stats()
+	assert.False(t, stats.Ping.LastSendTime.Before(before), "ping")
+	assert.True(t, stats.Span.LastSendTime.IsZero(), "span")
+}
+
+func Test_streamRecorder_recordConnect(t *testing.T) {
+	var r streamRecorder
+	r.recordConnect(streamSpan)
+	assert.Equal(t, int64(0), r.stats().Span.Reconnects, "first connect")
+
+	r.recordError(streamSpan, errors.New("connection reset"))
+	r.recordConnect(streamSpan)
+	r.recordConnect(streamSpan)
+
+	stats := r.stats()
+	assert.Equal(t, int64(2), stats.Span.Reconnects, "reconnects")
+	assert.Equal(t, "connection reset", stats.Span.LastError, "last error")
+	assert.False(t, stats.Span.LastErrorTime.IsZero(), "last error time")
+	assert.Equal(t, StreamStat{}, stats.Stat, "other stream")
+}
+
+type failingStatGrpcClient struct{}
+
+func (c *failingStatGrpcClient) SendAgentStat(ctx context.Context) (pb.Stat_SendAgentStatClient, error) {
+	return nil, errors.New("unavailable")
+}
+
+func Test_agent_StreamStats(t *testing.T) {
+	c, _ := NewConfig(WithAppName("test"), WithAgentId("testagent"))
+	c.OffGrpc = true
+	a1, _ := NewAgent(c)
+	a2, _ := NewAgent(c)
+
+	a1.(*agent).statGrpc = &statGrpc{statClient: &failingStatGrpcClient{}, agent: a1}
+	a1.(*agent).statGrpc.newStatStream()
+
+	assert.Equal(t, "unavailable", a1.StreamStats().Stat.LastError, "agent of the stream")
+	assert.Equal(t, StreamStats{}, a2.StreamStats(), "other agent")
+}
+
+func Test_recordDroppedSpan(t *testing.T) {
+	getStats()
+	recordDroppedSpan(1, time.Minute)
+	recordDroppedSpan(2, time.Minute)
+
+	assert.Equal(t, int64(3), getStats().droppedSpan, "dropped")
+	assert.Equal(t, int64(0), getStats().droppedSpan, "reset")
+
+	total := atomic.LoadInt64(&droppedSpan)
+	recordDroppedSpan(1, time.Minute)
+	assert.Equal(t, int64(1), getStats().droppedSpan, "dropped")
+	assert.Equal(t, total+1, atomic.LoadInt64(&droppedSpan), "total is kept for the self-test")
+}
+
+func Test_maxGcPause(t *testing.T) {
+	var mem runtime.MemStats
+	mem.NumGC = 258
+	mem.PauseNs[(256+255)%256] = 3000000
+	mem.PauseNs[(257+255)%256] = 500000
+	mem.PauseNs[(258+255)%256] = 1000000
+
+	assert.Equal(t, int64(0), maxGcPause(&mem, 258), "no cycle")
+	assert.Equal(t, int64(1000), maxGcPause(&mem, 257), "last cycle")
+	assert.Equal(t, int64(3000), maxGcPause(&mem, 255), "three cycles")
+	assert.Equal(t, int64(3000), maxGcPause(&mem, 0), "over the buffer")
+}
+
+func Test_openFileDescriptors(t *testing.T) {
+	if _, err := os.Stat("/proc/self/fd"); err != nil {
+		t.Skip("no procfs")
+	}
+
+	before, ok := openFileDescriptors()
+	assert.True(t, ok, "ok")
+
+	f, _ := os.Open("/proc/self/fd")
+	defer f.Close()
+	after, _ := openFileDescriptors()
+	assert.Equal(t, before+1, after, "opened")
+	assert.Greater(t, fileDescriptorLimit(), int64(0), "limit")
+}
+
+func Test_makePFileDescriptor(t *testing.T) {
+	assert.Nil(t, makePFileDescriptor(&inspectorStats{fdCount: -1}), "unknown")
+	assert.Equal(t, int64(12), makePFileDescriptor(&inspectorStats{fdCount: 12}).GetOpenFileDescriptorCount(), "count")
+}
+
+func Test_makePAgentStat_CollectInterval(t *testing.T) {
+	stat := &inspectorStats{collectInterval: 10000, activeSpan: []int32{0, 0, 0, 0}}
+	assert.Equal(t, int64(10000), makePAgentStat(stat).GetCollectInterval(), "interval")
+}
+
+func Test_makePAgentStat_Gc(t *testing.T) {
+	stat := &inspectorStats{gcNum: 3, gcTime: 12, gcPauseMax: 5000, gcForced: 1, activeSpan: []int32{0, 0, 0, 0}}
+	gc := makePAgentStat(stat).GetGc()
+	assert.Equal(t, int64(3), gc.GetJvmGcOldCount(), "gc count")
+	assert.Equal(t, int64(12), gc.GetJvmGcOldTime(), "gc time")
+	assert.Equal(t, int64(3), gc.GetJvmGcDetailed().GetJvmGcNewCount(), "new gc count")
+	assert.Equal(t, int64(12), gc.GetJvmGcDetailed().GetJvmGcNewTime(), "new gc time")
+}
+
+func Test_makePAgentUriStat(t *testing.T) {
+	stat := &inspectorStats{
+		sampleTime: time.Unix(10, 0),
+		uriStats: []UriStat{{
+			Uri:             "/users/:id",
+			Count:           2,
+			ErrorCount:      1,
+			TotalTime:       750,
+			MaxTime:         700,
+			Histogram:       []int64{1, 0, 0, 1, 0, 0, 0, 0},
+			FailedTotalTime: 700,
+			FailedMaxTime:   700,
+			FailedHistogram: []int64{0, 0, 0, 1, 0, 0, 0, 0},
+		}},
+	}
+
+	u := makePAgentUriStat(stat)
+	assert.Equal(t, int32(0), u.GetBucketVersion(), "bucket version")
+	assert.Equal(t, 1, len(u.GetEachUriStat()), "len")
+
+	each := u.GetEachUriStat()[0]
+	assert.Equal(t, "/users/:id", each.GetUri(), "uri")
+	assert.Equal(t, int64(10000), each.GetTimestamp(), "each timestamp")
+	assert.Equal(t, int64(750), each.GetTotalHistogram().GetTotal(), "total")
+	assert.Equal(t, int64(700), each.GetTotalHistogram().GetMax(), "max")
+	assert.Equal(t, []int32{1, 0, 0, 1, 0, 0, 0, 0}, each.GetTotalHistogram().GetHistogram(), "histogram")
+	assert.Equal(t, int64(700), each.GetFailedHistogram().GetTotal(), "failed total")
+	assert.Equal(t, []int32{0, 0, 0, 1, 0, 0, 0, 0}, each.GetFailedHistogram().GetHistogram(), "failed histogram")
+}
+
+func Test_makePDirectBuffer(t *testing.T) {
+	buf := makePDirectBuffer(&inspectorStats{offHeap: 4096, heapRetained: 1024, cgoCalls: 3})
+	assert.Equal(t, int64(4096), buf.GetDirectMemoryUsed(), "direct memory")
+	assert.Equal(t, int64(1024), buf.GetMappedMemoryUsed(), "mapped memory")
+	assert.Equal(t, int64(0), buf.GetDirectCount(), "no direct count")
+}
@@ -1,8 +1,11 @@
 package pinpoint
 
 import (
+	"context"
 	"fmt"
 	"time"
+
+	pb "github.com/pinpoint-apm/pinpoint-go-agent/protobuf"
 )
 
 type TransactionId struct {
@@ -15,26 +18,79 @@ func (tid TransactionId) String() string {
 	return fmt.Sprintf("%s^%d^%d", tid.AgentId, tid.StartTime, tid.Sequence)
 }
 
+// Agent creates the tracers of the transactions and sends them to the collector.
+// The tracers returned by the NewSpanTracer methods are never nil. If the agent is disabled or the transaction is not sampled,
+// they are tracers which record nothing, like the one returned by NoopTracer.
 type Agent interface {
 	Shutdown()
+	ShutdownWithTimeout(timeout time.Duration) (flushed int, undrained int)
+	ReconnectCollector(host string, agentPort int, spanPort int, statPort int) error
 	NewSpanTracer(operation string) Tracer
 	NewSpanTracerWithReader(operation string, reader DistributedTracingContextReader) Tracer
+	NewSpanTracerWithStatus(operation string) (Tracer, SpanStatus)
+	NewSpanTracerWithReaderAndStatus(operation string, reader DistributedTracingContextReader) (Tracer, SpanStatus)
 	RegisterSpanApiId(descriptor string, apiType int) int32
 	Config() Config
 	GenerateTransactionId() TransactionId
 	TryEnqueueSpan(span *span) bool
 	Enable() bool
+	RecordCustomStat(name string, value float64)
+	// OnEnableChange registers a function called when the agent is enabled, by connecting to the collector, or disabled, by shutting down.
+	OnEnableChange(f func(enabled bool))
+	StreamStats() StreamStats
+	streams() *streamRecorder
+	SamplerState() SamplerState
+	RecentTraces() []TraceSummary
 	StartTime() int64
 	CacheErrorFunc(funcname string) int32
 	CacheSql(sql string) int32
 	CacheSpanApiId(descriptor string, apiType int) int32
 }
 
+// SpanStatus tells why a tracer is created as it is.
+// A tracer with SpanStatusSampled records the transaction,
+// and one with SpanStatusCandidate records it to be sent only if it turns out slow.
+type SpanStatus int
+
+const (
+	SpanStatusSampled   SpanStatus = iota
+	SpanStatusUnsampled            //not sampled by the sampling rate or the upstream
+	SpanStatusDisabled             //the agent is not connected to the collector or shut down
+	SpanStatusDropped              //over the sampling throughput limit
+	SpanStatusCandidate            //not sampled, but kept if slower than WithSamplingKeepSlowThreshold
+)
+
+func (s SpanStatus) String() string {
+	switch s {
+	case SpanStatusSampled:
+		return "Sampled"
+	case SpanStatusUnsampled:
+		return "Unsampled"
+	case SpanStatusDisabled:
+		return "Disabled"
+	case SpanStatusDropped:
+		return "Dropped"
+	case SpanStatusCandidate:
+		return "Candidate"
+	}
+	return "Unknown"
+}
+
 type Tracer interface {
 	NewSpanEvent(operationName string) Tracer
+	// NewSpanEventWithApiId starts a span event of the api id returned by Agent.RegisterSpanApiId,
+	// so that hot code can register the api once and skip recording the operation name for every event.
+	NewSpanEventWithApiId(apiId int32) Tracer
 	NewAsyncSpan() Tracer
+	NewAsyncSpanWithId(asyncId int32) Tracer
+	AsyncId() int32
+	// WrapGo runs f on a new goroutine with an async span in its context, and ends the async span when f returns.
+	// If f panics, the panic is recorded as the error of the async span and panicked again after the span is ended.
+	WrapGo(ctx context.Context, f func(ctx context.Context))
 	EndSpan()
 	EndSpanEvent()
+	EndSpanWithStatus(err error)
+	EndSpanEventWithStatus(err error)
 
 	Inject(writer DistributedTracingContextWriter)
 	Extract(reader DistributedTracingContextReader)
@@ -56,15 +112,31 @@ type SpanRecorder interface {
 	SetAcceptorHost(host string)
 	Annotations() Annotation
 	SetLogging(logInfo int32)
+	SetUriTemplate(template string)
+	SetParentApplication(name string, typ int)
+	// AddLink records a transaction the span derives from, other than its parent, such as one of the messages of a batch.
+	// The transaction id is recorded with the AnnotationLinkedTransaction annotation.
+	AddLink(txId TransactionId)
+	// RecordAttribute records a key-value data of the application, such as an order id, with the AnnotationAttribute annotation.
+	// A value of a type other than string, bool, integers and floats is formatted by fmt.Sprint.
+	RecordAttribute(key string, value interface{})
 }
 
 type SpanEventRecorder interface {
 	SetApiId(id int32)
 	SetServiceType(typ int32)
 	SetDestination(id string)
+	OverrideDestination(id string)
 	SetEndPoint(endPoint string)
 	SetError(e error)
+	// SetErrorWithSpan records the error on the span event, and on the span as well if markSpan is true.
+	// SetError records it on the span event only, for handled errors that don't fail the transaction.
+	SetErrorWithSpan(e error, markSpan bool)
+	SetTransportError(e error)
 	SetSQL(sql string)
+	SetSQLRowsAffected(n int64)
+	// RecordAttribute records a key-value data of the application like SpanRecorder.RecordAttribute.
+	RecordAttribute(key string, value interface{})
 	Annotations() Annotation
 	FixDuration(start time.Time, end time.Time)
 }
@@ -75,6 +147,7 @@ type Annotation interface {
 	AppendStringString(key int32, s1 string, s2 string)
 	AppendIntStringString(key int32, i int32, s1 string, s2 string)
 	AppendLongIntIntByteByteString(key int32, l int64, i1 int32, i2 int32, b1 int32, b2 int32, s string)
+	List() []*pb.PAnnotation
 }
 
 type DistributedTracingContextReader interface {
@@ -96,6 +169,10 @@ const (
 	HttpParentApplicationNamespace = "Pinpoint-pAppNamespace"
 	HttpHost                       = "Pinpoint-Host"
 
+	//bits of the Pinpoint-Flags header, which are passed on to the downstream
+	FlagForceSample = 0x1 //sample the transaction regardless of the local sampler
+	FlagDropSample  = 0x2 //don't sample the transaction
+
 	LogTransactionIdKey = "PtxId"
 	LogSpanIdKey        = "PspanId"
 	Logged              = 1
@@ -105,8 +182,8 @@ const (
 	ServiceTypeGoFunction   = 1801
 	ServiceTypeGoHttpClient = 9401
 
-	ApiTypeWebRequest = 100
-	ApiTypeInvocation = 200
+	ApiTypeWebRequest = 100 //entry point of a request served by the application
+	ApiTypeInvocation = 200 //method or job invoked inside the application
 
 	MaxAgentIdLength = 23
 )
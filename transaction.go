@@ -0,0 +1,42 @@
+package pinpoint
+
+// NewTransactionTracer starts a transaction that is not tied to an incoming network request,
+// such as a domain workflow triggered by an event. The operation is registered as the api of the span,
+// and each step of the workflow can be recorded as a span event with NewSpanEvent.
+// If serviceType is 0, ServiceTypeGoApp is used.
+func NewTransactionTracer(agent Agent, operation string, serviceType int32) Tracer {
+	return newEntryTracer(agent, operation, serviceType, ApiTypeWebRequest)
+}
+
+// NewBatchTracer starts a transaction of a scheduled or batch job, such as a cron task or a queue worker loop.
+// The job is registered as an api of ApiTypeInvocation instead of ApiTypeWebRequest,
+// so that the runs of the job are told apart from the web requests in the UI.
+// The span has ServiceTypeGoApp, the service type of the application, as the collector has no batch service type for Go.
+func NewBatchTracer(agent Agent, job string) Tracer {
+	return newEntryTracer(agent, job, 0, ApiTypeInvocation)
+}
+
+// NewOrphanCallTracer starts a transaction for an outgoing call made outside of any transaction,
+// such as a call at startup or from a background goroutine, if it is enabled by WithHttpTraceOrphanClientCalls.
+// Otherwise it returns nil, and the call is to be made without tracing and without the pinpoint headers.
+// The client plugins record the call as a span event of the transaction, and end the transaction after the call.
+func NewOrphanCallTracer(agent Agent, operation string) Tracer {
+	if agent == nil || !agent.Enable() || !agent.Config().Http.TraceOrphanClientCalls {
+		return nil
+	}
+	return newEntryTracer(agent, operation, 0, ApiTypeInvocation)
+}
+
+func newEntryTracer(agent Agent, operation string, serviceType int32, apiType int) Tracer {
+	tracer := agent.NewSpanTracer(operation)
+
+	if serviceType != 0 {
+		tracer.Span().SetServiceType(serviceType)
+	}
+	tracer.Span().SetRpcName(operation)
+	if apiId := agent.RegisterSpanApiId(operation, apiType); apiId > 0 {
+		tracer.Span().SetApiId(apiId)
+	}
+
+	return tracer
+}
@@ -0,0 +1,88 @@
+package pinpoint
+
+import (
+	"sort"
+	"sync"
+)
+
+// UriStat is the count and the response time of the transactions of a URI template
+// since the previous stat sample.
+type UriStat struct {
+	Uri        string
+	Count      int64
+	ErrorCount int64
+	TotalTime  int64 //ms
+	MaxTime    int64 //ms
+
+	// counts by response time: <= 100ms, 300ms, 500ms, 1s, 3s, 5s, 8s and > 8s
+	Histogram []int64
+
+	// the same as above for the failed transactions only
+	FailedTotalTime int64 //ms
+	FailedMaxTime   int64 //ms
+	FailedHistogram []int64
+}
+
+// uriStatBuckets are the upper bounds of the histogram buckets, which are those of the bucket version 0 of the collector.
+var uriStatBuckets = []int64{100, 300, 500, 1000, 3000, 5000, 8000}
+
+const uriStatBucketVersion = 0
+
+var uriStatMux sync.Mutex
+var uriStats = make(map[string]*UriStat)
+
+func collectUriStat(uri string, elapsed int64, failed bool) {
+	uriStatMux.Lock()
+	defer uriStatMux.Unlock()
+
+	stat, ok := uriStats[uri]
+	if !ok {
+		stat = &UriStat{
+			Uri:             uri,
+			Histogram:       make([]int64, len(uriStatBuckets)+1),
+			FailedHistogram: make([]int64, len(uriStatBuckets)+1),
+		}
+		uriStats[uri] = stat
+	}
+
+	bucket := uriStatBucket(elapsed)
+	stat.Count++
+	stat.TotalTime += elapsed
+	if stat.MaxTime < elapsed {
+		stat.MaxTime = elapsed
+	}
+	stat.Histogram[bucket]++
+
+	if failed {
+		stat.ErrorCount++
+		stat.FailedTotalTime += elapsed
+		if stat.FailedMaxTime < elapsed {
+			stat.FailedMaxTime = elapsed
+		}
+		stat.FailedHistogram[bucket]++
+	}
+}
+
+func uriStatBucket(elapsed int64) int {
+	for i, b := range uriStatBuckets {
+		if elapsed <= b {
+			return i
+		}
+	}
+	return len(uriStatBuckets)
+}
+
+// takeUriStats returns the stats collected since the previous call, sorted by URI.
+func takeUriStats() []UriStat {
+	uriStatMux.Lock()
+	collected := uriStats
+	uriStats = make(map[string]*UriStat)
+	uriStatMux.Unlock()
+
+	stats := make([]UriStat, 0, len(collected))
+	for _, stat := range collected {
+		stats = append(stats, *stat)
+	}
+	sort.Slice(stats, func(i, j int) bool { return stats[i].Uri < stats[j].Uri })
+	return stats
+}
@@ -0,0 +1,167 @@
+package pinpoint
+
+import (
+	"encoding/hex"
+	"fmt"
+	"hash/fnv"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// The headers of the W3C Trace Context, https://www.w3.org/TR/trace-context/
+const (
+	W3CTraceParent = "traceparent"
+	W3CTraceState  = "tracestate"
+
+	// W3CAgentId is the agent id of the transaction ids mapped from the W3C trace ids.
+	W3CAgentId = "w3c"
+
+	w3cStateKey = "pinpoint"
+)
+
+type traceParent struct {
+	traceId  string //32 lowercase hex
+	parentId string //16 lowercase hex
+	sampled  bool
+}
+
+// parseTraceParent parses the traceparent header in the form of version-traceid-parentid-flags.
+func parseTraceParent(s string) (traceParent, bool) {
+	var tp traceParent
+
+	f := strings.Split(strings.TrimSpace(s), "-")
+	if len(f) < 4 || len(f[0]) != 2 || f[0] == "ff" || (f[0] == "00" && len(f) != 4) {
+		return tp, false
+	}
+	if !isLowerHex(f[1], 32) || !isLowerHex(f[2], 16) || !isLowerHex(f[3], 2) {
+		return tp, false
+	}
+	if f[1] == strings.Repeat("0", 32) || f[2] == strings.Repeat("0", 16) {
+		return tp, false
+	}
+
+	flags, _ := strconv.ParseUint(f[3], 16, 8)
+	tp.traceId = f[1]
+	tp.parentId = f[2]
+	tp.sampled = flags&0x1 != 0
+	return tp, true
+}
+
+func isLowerHex(s string, n int) bool {
+	if len(s) != n {
+		return false
+	}
+	for _, c := range s {
+		if !(c >= '0' && c <= '9' || c >= 'a' && c <= 'f') {
+			return false
+		}
+	}
+	return true
+}
+
+// hexToInt63 decodes a hex encoded id into an int64 without the sign bit.
+// It returns defaultValue if s is empty or not hex encoded.
+func hexToInt63(s string, defaultValue int64) int64 {
+	b, err := hex.DecodeString(s)
+	if err != nil || len(b) == 0 {
+		return defaultValue
+	}
+
+	var v uint64
+	for _, c := range b {
+		v = v<<8 | uint64(c)
+	}
+	return int64(v & math.MaxInt64)
+}
+
+// w3cTransactionId maps a W3C trace id to a transaction id, whose agent id is W3CAgentId,
+// start time is the upper 64 bits and sequence the lower 64 bits of the trace id, without their top bits.
+func w3cTransactionId(traceId string) TransactionId {
+	return TransactionId{W3CAgentId, hexToInt63(traceId[:16], 0), hexToInt63(traceId[16:], 0)}
+}
+
+// w3cTraceId maps a transaction id to a W3C trace id, whose upper 64 bits are the FNV-1a hash of
+// the agent id and the start time, and lower 64 bits the sequence.
+func w3cTraceId(txId TransactionId) string {
+	h := fnv.New64a()
+	h.Write([]byte(txId.AgentId + "^" + strconv.FormatInt(txId.StartTime, 10)))
+	return fmt.Sprintf("%016x%016x", h.Sum64(), uint64(txId.Sequence))
+}
+
+// w3cStateTransactionId returns the transaction id in the pinpoint entry of the tracestate header,
+// which is set by a Pinpoint agent so that the transaction continues with its id across the services traced by W3C only.
+func w3cStateTransactionId(state string) (TransactionId, bool) {
+	for _, member := range strings.Split(state, ",") {
+		kv := strings.SplitN(strings.TrimSpace(member), "=", 2)
+		if len(kv) == 2 && kv[0] == w3cStateKey {
+			return ParseTransactionId(kv[1])
+		}
+	}
+	return TransactionId{}, false
+}
+
+// w3cTraceState puts the pinpoint entry with the transaction id at the front of the tracestate header,
+// keeping the entries of the other vendors.
+func w3cTraceState(txId TransactionId, state string) string {
+	members := []string{w3cStateKey + "=" + txId.String()}
+	for _, member := range strings.Split(state, ",") {
+		member = strings.TrimSpace(member)
+		if member != "" && !strings.HasPrefix(member, w3cStateKey+"=") && len(members) < 32 {
+			members = append(members, member)
+		}
+	}
+	return strings.Join(members, ",")
+}
+
+// w3cReader reads the W3C Trace Context as the pinpoint headers if the request has no pinpoint headers,
+// so that a transaction started by a service traced by W3C only, such as an OpenTelemetry service, continues.
+type w3cReader struct {
+	reader DistributedTracingContextReader
+	parent traceParent
+	txId   TransactionId
+}
+
+func newW3CReader(reader DistributedTracingContextReader) DistributedTracingContextReader {
+	if reader.Get(HttpTraceId) != "" {
+		return reader
+	}
+
+	tp, ok := parseTraceParent(reader.Get(W3CTraceParent))
+	if !ok {
+		return reader
+	}
+
+	txId, ok := w3cStateTransactionId(reader.Get(W3CTraceState))
+	if !ok {
+		txId = w3cTransactionId(tp.traceId)
+	}
+	return &w3cReader{reader, tp, txId}
+}
+
+func (r *w3cReader) Get(key string) string {
+	switch key {
+	case HttpTraceId:
+		return r.txId.String()
+	case HttpParentSpanId:
+		return strconv.FormatInt(hexToInt63(r.parent.parentId, 0), 10)
+	case HttpSampled:
+		if !r.parent.sampled {
+			return "s0"
+		}
+		return r.reader.Get(key)
+	}
+	return r.reader.Get(key)
+}
+
+// injectW3C writes the W3C Trace Context of the call to the next span.
+// The trace id of the W3C caller is kept, otherwise it is mapped from the transaction id.
+func (span *span) injectW3C(writer DistributedTracingContextWriter, nextSpanId int64) {
+	traceId := span.w3cTraceId
+	if traceId == "" {
+		traceId = w3cTraceId(span.txId)
+	}
+
+	writer.Set(W3CTraceParent, fmt.Sprintf("00-%s-%016x-01", traceId, uint64(nextSpanId)))
+	writer.Set(W3CTraceState, w3cTraceState(span.txId, span.w3cTraceState))
+}
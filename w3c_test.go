@@ -0,0 +1,143 @@
+package pinpoint
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_parseTraceParent(t *testing.T) {
+	tests := []struct {
+		name    string
+		header  string
+		ok      bool
+		sampled bool
+	}{
+		{"sampled", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", true, true},
+		{"not sampled", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00", true, false},
+		{"future version", "01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra", true, true},
+		{"empty", "", false, false},
+		{"invalid version", "ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", false, false},
+		{"uppercase", "00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01", false, false},
+		{"zero trace id", "00-00000000000000000000000000000000-00f067aa0ba902b7-01", false, false},
+		{"zero parent id", "00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01", false, false},
+		{"short", "00-4bf92f3577b34da6a3ce929d0e0e4736-01", false, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tp, ok := parseTraceParent(tt.header)
+			assert.Equal(t, tt.ok, ok, "ok")
+			if ok {
+				assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", tp.traceId, "traceId")
+				assert.Equal(t, "00f067aa0ba902b7", tp.parentId, "parentId")
+				assert.Equal(t, tt.sampled, tp.sampled, "sampled")
+			}
+		})
+	}
+}
+
+func Test_w3cTransactionId(t *testing.T) {
+	txId := w3cTransactionId("4bf92f3577b34da6a3ce929d0e0e4736")
+	assert.Equal(t, TransactionId{W3CAgentId, 0x4bf92f3577b34da6, 0x23ce929d0e0e4736}, txId, "txId")
+	assert.Equal(t, txId, w3cTransactionId("4bf92f3577b34da6a3ce929d0e0e4736"), "deterministic")
+
+	id := TransactionId{"agent", 1000, 7}
+	assert.Equal(t, w3cTraceId(id), w3cTraceId(id), "deterministic")
+	assert.Equal(t, 32, len(w3cTraceId(id)), "length")
+	assert.Equal(t, "0000000000000007", w3cTraceId(id)[16:], "sequence")
+}
+
+func Test_w3cTraceState(t *testing.T) {
+	txId := TransactionId{"agent", 1000, 7}
+	state := w3cTraceState(txId, "rojo=00f067aa0ba902b7, pinpoint=old^1^1,congo=t61rcWkgMzE")
+	assert.Equal(t, "pinpoint=agent^1000^7,rojo=00f067aa0ba902b7,congo=t61rcWkgMzE", state, "state")
+
+	got, ok := w3cStateTransactionId(state)
+	assert.True(t, ok, "ok")
+	assert.Equal(t, txId, got, "txId")
+
+	_, ok = w3cStateTransactionId("rojo=00f067aa0ba902b7")
+	assert.False(t, ok, "no pinpoint entry")
+}
+
+func Test_newW3CReader(t *testing.T) {
+	tests := []struct {
+		name    string
+		header  map[string]string
+		tid     string
+		pspanid string
+		sampled string
+	}{
+		{"w3c", map[string]string{W3CTraceParent: "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"},
+			"w3c^5474458728733560230^2580160839773210422", "67667974448284343", ""},
+		{"w3c not sampled", map[string]string{W3CTraceParent: "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00"},
+			"w3c^5474458728733560230^2580160839773210422", "67667974448284343", "s0"},
+		{"w3c with pinpoint state", map[string]string{W3CTraceParent: "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", W3CTraceState: "pinpoint=agent^1000^7"},
+			"agent^1000^7", "67667974448284343", ""},
+		{"pinpoint", map[string]string{W3CTraceParent: "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", HttpTraceId: "agent^1000^9", HttpParentSpanId: "5"},
+			"agent^1000^9", "5", ""},
+		{"none", map[string]string{}, "", "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := http.Header{}
+			for k, v := range tt.header {
+				h.Set(k, v)
+			}
+
+			r := newW3CReader(HttpHeaderReader(h))
+			assert.Equal(t, tt.tid, r.Get(HttpTraceId), "tid")
+			assert.Equal(t, tt.pspanid, r.Get(HttpParentSpanId), "pspanid")
+			assert.Equal(t, tt.sampled, r.Get(HttpSampled), "sampled")
+		})
+	}
+}
+
+func Test_span_InjectW3C(t *testing.T) {
+	c, _ := NewConfig(WithAppName("test"), WithAgentId("testagent"), WithPropagationW3C(true))
+	c.OffGrpc = true
+	a, _ := NewAgent(c)
+	agent := a.(*agent)
+	agent.enable = true
+
+	h := http.Header{}
+	h.Set(W3CTraceParent, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	h.Set(W3CTraceState, "rojo=00f067aa0ba902b7")
+	tracer := agent.NewSpanTracerWithReader("test", HttpHeaderReader(h))
+	s := tracer.(*span)
+	assert.Equal(t, TransactionId{W3CAgentId, 0x4bf92f3577b34da6, 0x23ce929d0e0e4736}, s.txId, "txId")
+
+	tracer.NewSpanEvent("call")
+	out := http.Header{}
+	tracer.Inject(HttpHeaderWriter(out))
+	tracer.EndSpanEvent()
+
+	tp, ok := parseTraceParent(out.Get(W3CTraceParent))
+	assert.True(t, ok, "traceparent")
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", tp.traceId, "trace id kept")
+	assert.Equal(t, "pinpoint=w3c^5474458728733560230^2580160839773210422,rojo=00f067aa0ba902b7", out.Get(W3CTraceState), "tracestate")
+	assert.Equal(t, s.txId.String(), out.Get(HttpTraceId), "pinpoint header")
+}
+
+func Test_hexToInt63(t *testing.T) {
+	type args struct {
+		id        string
+		defaultId int64
+	}
+	tests := []struct {
+		name string
+		args args
+		want int64
+	}{
+		{"1", args{"00000000000000ff", -1}, 255},
+		{"2", args{"", -1}, -1},
+		{"3", args{"zz", -1}, -1},
+		{"4", args{"ffffffffffffffff", -1}, 0x7fffffffffffffff},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, hexToInt63(tt.args.id, tt.args.defaultId), "hexToInt63")
+		})
+	}
+}